@@ -0,0 +1,36 @@
+// gmsgidgen 根据服务器导出的路由表(RouteItemMgr.ExportJSON)生成TypeScript、C#消息ID常量文件
+//
+// 用法: gmsgidgen -in routes.json -out ./client/proto -namespace Game.Proto -class MsgId
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Ravior/gserver/net/gnet/gnetgen"
+	"os"
+)
+
+func main() {
+	in := flag.String("in", "routes.json", "路由表JSON文件")
+	out := flag.String("out", ".", "输出目录")
+	namespace := flag.String("namespace", "", "C#命名空间")
+	className := flag.String("class", "MsgId", "常量类/枚举名称")
+	flag.Parse()
+
+	f, err := os.Open(*in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	routes, err := gnetgen.LoadRoutes(f)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := gnetgen.WriteFiles(routes, *out, gnetgen.Option{Namespace: *namespace, ClassName: *className}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
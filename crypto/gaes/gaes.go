@@ -155,6 +155,54 @@ func DecryptCFB(cipherText []byte, key []byte, unPadding int, iv ...[]byte) ([]b
 	return plainText, nil
 }
 
+// NewGCM creates an AES-GCM AEAD using <key>.
+// Note that the key must be 16/24/32 bit length.
+// The returned AEAD can be reused to seal/open many messages with different nonces.
+func NewGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptGCM encrypts and authenticates <plainText> using GCM mode.
+// Note that the key must be 16/24/32 bit length and the nonce must be 12 bytes.
+// A nonce must never be reused with the same key.
+// The optional parameter <additionalData> is authenticated but not encrypted.
+func EncryptGCM(plainText []byte, key []byte, nonce []byte, additionalData ...[]byte) ([]byte, error) {
+	aead, err := NewGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, gerror.NewCode(gcode.CodeInvalidParameter, "invalid nonce size")
+	}
+	var ad []byte
+	if len(additionalData) > 0 {
+		ad = additionalData[0]
+	}
+	return aead.Seal(nil, nonce, plainText, ad), nil
+}
+
+// DecryptGCM decrypts and verifies <cipherText> using GCM mode.
+// Note that the key must be 16/24/32 bit length and the nonce must be 12 bytes.
+// It returns an error if the cipherText or additionalData has been tampered with.
+func DecryptGCM(cipherText []byte, key []byte, nonce []byte, additionalData ...[]byte) ([]byte, error) {
+	aead, err := NewGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, gerror.NewCode(gcode.CodeInvalidParameter, "invalid nonce size")
+	}
+	var ad []byte
+	if len(additionalData) > 0 {
+		ad = additionalData[0]
+	}
+	return aead.Open(nil, nonce, cipherText, ad)
+}
+
 func ZeroPadding(cipherText []byte, blockSize int) ([]byte, int) {
 	padding := blockSize - len(cipherText)%blockSize
 	padText := bytes.Repeat([]byte{byte(0)}, padding)
@@ -17,3 +17,27 @@ func Test_Encrypt(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_EncryptGCM(t *testing.T) {
+	sourceStr := "gserver"
+	key := []byte("1234567812345678")
+	nonce := []byte("123456781234")
+	encryptStr, err := EncryptGCM([]byte(sourceStr), key, nonce, []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryptStr, err := DecryptGCM(encryptStr, key, nonce, []byte("ad"))
+	if err != nil || sourceStr != string(decryptStr) {
+		t.Fail()
+	}
+
+	// Tampered cipherText or additionalData must fail.
+	encryptStr[0] ^= 1
+	if _, err := DecryptGCM(encryptStr, key, nonce, []byte("ad")); err == nil {
+		t.Fail()
+	}
+	encryptStr[0] ^= 1
+	if _, err := DecryptGCM(encryptStr, key, nonce, []byte("other")); err == nil {
+		t.Fail()
+	}
+}
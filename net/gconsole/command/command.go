@@ -40,6 +40,6 @@ func NewCommandMgr() *commandMgr {
 		commands: make([]Command, 0),
 	}
 	// 系统命令
-	mgr.commands = append(mgr.commands, &CommandHelp{}, &CommandSysinfo{}, &CommandProf{}, &CommandCPUProf{})
+	mgr.commands = append(mgr.commands, &CommandHelp{}, &CommandSysinfo{}, &CommandProf{}, &CommandCPUProf{}, &CommandMetrics{})
 	return mgr
 }
@@ -0,0 +1,84 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Ravior/gserver/net/gnet"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 默认输出请求数最多的消息ID数量
+const metricsDefaultTop = 20
+
+type CommandMetrics struct{}
+
+func (c *CommandMetrics) Name() string {
+	return "metrics"
+}
+
+func (c *CommandMetrics) Help() string {
+	return "获取链接数量及消息ID的请求数、耗时、流量等指标"
+}
+
+func (c *CommandMetrics) usage() string {
+	return "Usage: metrics [top N|prom|reset]\r\n" +
+		"  top N - 输出请求数最多的N个消息ID(默认20)\r\n" +
+		"  prom  - 按Prometheus文本格式输出全部指标\r\n" +
+		"  reset - 清空消息ID指标"
+}
+
+func (c *CommandMetrics) Run(args []string) string {
+	top := metricsDefaultTop
+	if len(args) > 0 {
+		switch args[0] {
+		case "top":
+			if len(args) < 2 {
+				return c.usage()
+			}
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return c.usage()
+			}
+			top = n
+		case "prom":
+			buf := &bytes.Buffer{}
+			if err := gnet.MetricsMgr.WritePrometheus(buf); err != nil {
+				return err.Error()
+			}
+			return strings.ReplaceAll(strings.TrimSuffix(buf.String(), "\n"), "\n", "\r\n")
+		case "reset":
+			gnet.MetricsMgr.Reset()
+			return "ok"
+		default:
+			return c.usage()
+		}
+	}
+
+	output := "---------------- 链接数量 -----------------------------\r\n"
+	for _, s := range gnet.MetricsMgr.GetConnStats() {
+		output += fmt.Sprintf("%s %s(%d): 链接数:%d 已绑定用户:%d\r\n", s.Protocol, s.Server, s.Id, s.Conns, s.Bound)
+	}
+
+	stats := gnet.MetricsMgr.GetMsgIdStats()
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Requests > stats[j].Requests
+	})
+	if len(stats) > top {
+		stats = stats[:top]
+	}
+
+	output += "---------------- 消息指标 -----------------------------\r\n"
+	output += fmt.Sprintf("%-10s %-24s %8s %6s %6s %10s %10s %10s %10s %10s\r\n",
+		"MsgId", "Route", "Requests", "Errors", "Panics", "Avg", "P99", "QueueAvg", "BytesIn", "BytesOut")
+	for _, s := range stats {
+		output += fmt.Sprintf("%-10d %-24s %8d %6d %6d %10s %10s %10s %10d %10d\r\n",
+			s.MsgId, s.Route, s.Requests, s.Errors, s.Panics,
+			s.HandleTime.Avg().Round(time.Microsecond), s.HandleTime.Quantile(0.99), s.QueueWait.Avg().Round(time.Microsecond),
+			s.BytesIn, s.BytesOut)
+	}
+	output += "-------------------------------------------------------"
+	return output
+}
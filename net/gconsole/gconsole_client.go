@@ -5,9 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Ravior/gserver/net/gnet"
-	"github.com/Ravior/gserver/net/gtcp"
 	"github.com/Ravior/gserver/os/glog"
-	"io"
 	"net"
 	"os"
 )
@@ -18,6 +16,7 @@ type Client struct {
 	remotePort int32
 	conn       *net.TCPConn
 	reader     *bufio.Reader
+	dataPack   gnet.IDataPack
 }
 
 func NewClient(remoteIP string, remotePort int32) *Client {
@@ -25,9 +24,15 @@ func NewClient(remoteIP string, remotePort int32) *Client {
 		ipVersion:  "tcp4",
 		remoteIP:   remoteIP,
 		remotePort: remotePort,
+		dataPack:   newDataPack(),
 	}
 }
 
+// SetDataPack 设置封包格式(需与Console Server一致)
+func (c *Client) SetDataPack(dataPack gnet.IDataPack) {
+	c.dataPack = dataPack
+}
+
 func (c *Client) Start() {
 	addr, err := net.ResolveTCPAddr(c.ipVersion, fmt.Sprintf("%s:%d", c.remoteIP, c.remotePort))
 	if err != nil {
@@ -50,26 +55,11 @@ func (c *Client) Start() {
 
 func (c *Client) StartTcpReader() {
 	for {
-		headData := make([]byte, gtcp.MsgPack.GetHeadLen())
-
-		if _, err := io.ReadFull(c.conn, headData); err != nil {
-			break
-		}
-
-		msg, err := gtcp.MsgPack.Unpack(headData)
+		msg, err := gnet.ReadMsg(c.dataPack, c.conn)
 		if err != nil {
 			break
 		}
 
-		var data []byte
-		if msg.GetDataLen() > 0 {
-			data = make([]byte, msg.GetDataLen())
-			if _, err := io.ReadFull(c.conn, data); err != nil {
-				break
-			}
-		}
-
-		msg.SetData(data)
 		line := string(msg.Data)
 		fmt.Println(line)
 		fmt.Print(">> 请输入命令继续，或输入【exit】退出终端...\r\n\r\n")
@@ -103,7 +93,7 @@ func (c *Client) Run() {
 func (c *Client) SendMsg(data []byte) error {
 	// 将data封包，并且发送
 	p := gnet.NewMsg(0, data)
-	msg, err := gtcp.MsgPack.Pack(p)
+	msg, err := c.dataPack.Pack(p)
 
 	if err != nil {
 		glog.Errorf("connection pack message fail，msgData:%v, err:%s", data, err.Error())
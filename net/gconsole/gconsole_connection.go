@@ -5,9 +5,7 @@ import (
 	"fmt"
 	"github.com/Ravior/gserver/net/gconsole/command"
 	"github.com/Ravior/gserver/net/gnet"
-	"github.com/Ravior/gserver/net/gtcp"
 	"github.com/Ravior/gserver/os/glog"
-	"io"
 	"net"
 	"strings"
 )
@@ -34,29 +32,12 @@ func (c *Connection) StartReader() {
 	defer c.Stop()
 
 	for {
-		// 读取客户端的Msg head
-		headData := make([]byte, gtcp.MsgPack.GetHeadLen())
-
-		if _, err := io.ReadFull(c.conn, headData); err != nil {
-			break
-		}
-
-		// 普通socket拆包，得到nameLen 和 dataLen 放在msg中
-		msg, err := gtcp.MsgPack.Unpack(headData)
+		// 按封包格式读取客户端的Msg
+		msg, err := gnet.ReadMsg(c.server.GetDataPack(), c.conn)
 		if err != nil {
 			break
 		}
 
-		// 根据 nameLen bodyLen 读取 CaveList
-		var data []byte
-		if msg.GetDataLen() > 0 {
-			data = make([]byte, msg.GetDataLen())
-			if _, err := io.ReadFull(c.conn, data); err != nil {
-				break
-			}
-		}
-		msg.SetData(data)
-
 		line := string(msg.Data)
 
 		args := strings.Fields(line)
@@ -118,7 +99,7 @@ func (c *Connection) RemoteAddr() net.Addr {
 func (c *Connection) SendMsg(data []byte) error {
 	// 将data封包，并且发送
 	p := gnet.NewMsg(0, data)
-	msg, err := gtcp.MsgPack.Pack(p)
+	msg, err := c.server.GetDataPack().Pack(p)
 
 	if err != nil {
 		glog.Errorf("connection pack message fail，msgData:%v, err:%s, connId:%d, addr:%s", data, err.Error(), c.connID, c.RemoteAddr())
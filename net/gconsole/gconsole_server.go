@@ -10,6 +10,16 @@ import (
 	"sync/atomic"
 )
 
+// defaultMaxPacketSize 控制台消息的最大包长度，与原gtcp封包格式保持一致
+var defaultMaxPacketSize uint32 = 2048
+
+// newDataPack 创建控制台默认封包格式 dataLen(4字节)|msgId(4字节)|body
+func newDataPack() *gnet.DataPack {
+	dp := gnet.NewDataPack()
+	dp.SetMaxPacketSize(defaultMaxPacketSize)
+	return dp
+}
+
 // ConnCallback 连接回调
 type ConnCallback func(conn *Connection)
 
@@ -21,6 +31,7 @@ type Server struct {
 
 	listener *net.TCPListener // 服务器TCP监听器
 	exit     chan bool        // 退出通道
+	dataPack gnet.IDataPack   // 封包格式
 
 	onConnStart ConnCallback // 有新的客户端链接时触发的Hook函数
 	onConnStop  ConnCallback // 当客户端链接断开时触发的Hook函数
@@ -32,6 +43,7 @@ func NewServer() *Server {
 		ip:        gconfig.Global.Console.IP,
 		port:      gconfig.Global.Console.Port,
 		exit:      make(chan bool, 1),
+		dataPack:  newDataPack(),
 	}
 	return server
 }
@@ -100,6 +112,16 @@ func (s *Server) GetRouter() *gnet.Router {
 	return nil
 }
 
+// GetDataPack 获取封包格式
+func (s *Server) GetDataPack() gnet.IDataPack {
+	return s.dataPack
+}
+
+// SetDataPack 设置封包格式
+func (s *Server) SetDataPack(dataPack gnet.IDataPack) {
+	s.dataPack = dataPack
+}
+
 // SetOnConnStart 设置服务器有新的链接Hook函数
 func (s *Server) SetOnConnStart(connCallback ConnCallback) {
 	s.onConnStart = connCallback
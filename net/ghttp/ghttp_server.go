@@ -2,6 +2,7 @@ package ghttp
 
 import (
 	"fmt"
+	"github.com/Ravior/gserver/net/gnet"
 	"github.com/Ravior/gserver/os/glog"
 	"github.com/Ravior/gserver/util/gconfig"
 	"net/http"
@@ -14,27 +15,43 @@ const (
 )
 
 type Server struct {
-	status int       // Status of current server.
-	port   int32     // 端口
-	name   string    // 服务器名称
-	id     string    // 服务器ID
-	ip     string    // Host
-	exit   chan bool // 退出通道
-	router *Router   // 消息路由器
+	status      int            // Status of current server.
+	port        int32          // 端口
+	name        string         // 服务器名称
+	id          string         // 服务器ID
+	ip          string         // Host
+	metricsPath string         // 网络层指标的访问路径(为空表示不开启)
+	exit        chan bool      // 退出通道
+	router      *Router        // 消息路由器
+	mux         *http.ServeMux // 服务器独立的ServeMux(不使用全局DefaultServeMux)
+	server      *http.Server   // Http服务器
 }
 
 func NewServer() *Server {
 	return &Server{
-		name:   gconfig.Global.ServerId,
-		id:     gconfig.Global.ServerName,
-		ip:     gconfig.Global.HttpServer.IP,
-		port:   gconfig.Global.HttpServer.Port,
-		status: ServerStatusStopped,
-		exit:   make(chan bool, 1),
-		router: NewRouter(),
+		name:        gconfig.Global.ServerId,
+		id:          gconfig.Global.ServerName,
+		ip:          gconfig.Global.HttpServer.IP,
+		port:        gconfig.Global.HttpServer.Port,
+		metricsPath: gconfig.Global.HttpServer.MetricsPath,
+		status:      ServerStatusStopped,
+		exit:        make(chan bool, 1),
+		router:      NewRouter(),
+		mux:         http.NewServeMux(),
 	}
 }
 
+// GetServeMux 获取服务器的ServeMux，可挂载其他Handler(如gwebsocket.Server)与Http服务共用端口
+func (s *Server) GetServeMux() *http.ServeMux {
+	return s.mux
+}
+
+// ServeHTTP 实现http.Handler，将请求交给路由处理
+func (s *Server) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	request := NewRequest(req, resp)
+	s.router.Run(request)
+}
+
 // 获取服务器名称
 func (s *Server) GetName() string {
 	return s.name
@@ -64,18 +81,22 @@ func (s *Server) Start() {
 	// 标记服务器状态为运行中
 	s.status = ServerStatusRunning
 
-	// 启动全局监听
-	http.HandleFunc("/", func(resp http.ResponseWriter, req *http.Request) {
-		request := NewRequest(req, resp)
-		s.router.Run(request)
-	})
+	// 注册到服务器独立的ServeMux，同一进程中可与其他Http服务共存
+	s.mux.Handle("/", s)
+	// 挂载网络层(gtcp、gwebsocket、gkcp)的消息及链接数量指标
+	if s.metricsPath != "" {
+		s.mux.Handle(s.metricsPath, gnet.MetricsMgr)
+	}
+	s.server = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", s.ip, s.port),
+		Handler: s.mux,
+	}
 
 	// 开启一个Go协程去监听服务器端口
 	go func() {
-		addr := fmt.Sprintf("%s:%d", s.ip, s.port)
 		// ListenAndServe会阻塞进程
-		err := http.ListenAndServe(addr, nil)
-		if err != nil {
+		err := s.server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
 			// 标记服务器状态为停止
 			s.status = ServerStatusStopped
 			glog.Errorf("启动Http服务器失败， %+v, 程序即将退出", err)
@@ -89,6 +110,10 @@ func (s *Server) Stop() {
 	if s.status == ServerStatusStopped {
 		return
 	}
+	s.status = ServerStatusStopped
+	if s.server != nil {
+		_ = s.server.Close()
+	}
 	s.exit <- true
 }
 
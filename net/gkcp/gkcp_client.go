@@ -0,0 +1,157 @@
+package gkcp
+
+import (
+	"context"
+	"fmt"
+	"github.com/Ravior/gserver/net/gnet"
+	"github.com/Ravior/gserver/os/glog"
+	"github.com/golang/protobuf/proto"
+)
+
+var (
+	defaultWorkerPoolSize uint32 = 1
+	defaultWorkerTaskSize uint32 = 10
+	defaultMaxMsgChanLen  uint32 = 10
+)
+
+// Client KCP(可靠UDP)客户端
+type Client struct {
+	name       string
+	id         string
+	remoteIP   string
+	remotePort int32
+	options    Options // KCP会话参数
+	msgHandler *gnet.MsgHandler
+	router     *gnet.Router   // 消息路由器
+	callMgr    *gnet.CallMgr  // 请求/响应关联管理器
+	dataPack   gnet.IDataPack // 封包格式
+
+	connMgr     *gnet.ConnManager
+	onConnStart gnet.ConnCallback
+	onConnStop  gnet.ConnCallback
+}
+
+func NewClient(clientId string, clientName string, remoteIP string, remotePort int32) *Client {
+	client := &Client{
+		id:         clientId,
+		name:       clientName,
+		remoteIP:   remoteIP,
+		remotePort: remotePort,
+		options:    DefaultOptions(),
+		router:     &gnet.Router{},
+		msgHandler: gnet.NewMsgHandler(defaultWorkerPoolSize, defaultWorkerTaskSize),
+		connMgr:    gnet.NewConnManager(),
+		callMgr:    gnet.NewCallMgr(),
+		dataPack:   gnet.NewDataPack(),
+	}
+	client.msgHandler.SetRouter(client.router)
+	client.msgHandler.SetCallMgr(client.callMgr)
+	return client
+}
+
+//============== 实现 interfaces.ISocket 里的全部接口方法 ========
+
+// GetName 获取客户端名称
+func (c *Client) GetName() string {
+	return c.name
+}
+
+// GetId 获取客户端ID
+func (c *Client) GetId() string {
+	return c.id
+}
+
+func (c *Client) GetHost() string {
+	return c.remoteIP
+}
+
+func (c *Client) GetPort() int32 {
+	return c.remotePort
+}
+
+// SetOptions 设置KCP会话参数(需与服务器一致，在Run之前设置)
+func (c *Client) SetOptions(options Options) {
+	c.options = options
+}
+
+// Start 开启
+func (c *Client) Start() {
+	c.msgHandler.StartWorkerPool()
+}
+
+// Stop 关闭
+func (c *Client) Stop() {
+	c.msgHandler.StopWorkerPool()
+	c.connMgr.ClearConn()
+}
+
+func (c *Client) Run() {
+	c.Start()
+
+	session, err := Dial(fmt.Sprintf("%s:%d", c.GetHost(), c.GetPort()), c.options)
+	if err != nil {
+		glog.Warnf("Connect To Server Fail, Addr: %s:%d, Err:%v", c.GetHost(), c.GetPort(), err.Error())
+		conn := NewConnection(c, nil, 0, c.msgHandler, defaultMaxMsgChanLen)
+		c.CallOnConnStop(conn)
+		return
+	}
+
+	// 保证Client的时候只有一个Conn
+	c.connMgr.ClearConn()
+	conn := NewConnection(c, session, 0, c.msgHandler, defaultMaxMsgChanLen)
+	conn.Start()
+}
+
+func (c *Client) GetRouter() *gnet.Router {
+	return c.router
+}
+
+func (c *Client) GetConn() gnet.IConnection {
+	conn, err := c.connMgr.Get(0)
+	if err == nil {
+		return conn
+	} else {
+		return nil
+	}
+}
+
+// Call 发送请求并阻塞等待匹配的响应消息，直到响应到达或者ctx超时(需开启封包格式的序列号扩展包头)
+func (c *Client) Call(ctx context.Context, msgId uint32, req proto.Message, resp proto.Message) error {
+	return c.callMgr.Call(ctx, c.GetConn(), msgId, req, resp)
+}
+
+// GetDataPack 获取封包格式
+func (c *Client) GetDataPack() gnet.IDataPack {
+	return c.dataPack
+}
+
+// SetDataPack 设置封包格式
+func (c *Client) SetDataPack(dataPack gnet.IDataPack) {
+	c.dataPack = dataPack
+}
+
+func (c *Client) GetConnMgr() *gnet.ConnManager {
+	return c.connMgr
+}
+
+func (c *Client) SetOnConnStart(connCallback gnet.ConnCallback) {
+	c.onConnStart = connCallback
+}
+
+func (c *Client) SetOnConnStop(connCallback gnet.ConnCallback) {
+	c.onConnStop = connCallback
+}
+
+func (c *Client) CallOnConnStart(conn gnet.IConnection) {
+	if c.onConnStart != nil {
+		c.onConnStart(conn)
+	}
+}
+
+func (c *Client) CallOnConnStop(conn gnet.IConnection) {
+	// 链接断开，取消全部等待中的请求
+	c.callMgr.CancelAll()
+	if c.onConnStop != nil {
+		c.onConnStop(conn)
+	}
+}
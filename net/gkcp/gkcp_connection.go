@@ -0,0 +1,294 @@
+package gkcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Ravior/gserver/net/gnet"
+	"github.com/Ravior/gserver/os/glog"
+	"github.com/gorilla/websocket"
+	"net"
+	"sync/atomic"
+)
+
+type Connection struct {
+	gnet.ConnProperty                    // 链接自定义属性
+	isClosed          int32              // 当前链接的关闭状态(采用原子操作处理)
+	pending           int32              // 缓冲管道中还未写出的消息数量
+	connID            uint32             // 当前链接的ID, 也可以称作为SessionID，ID全局唯一
+	msgChan           chan gnet.Buffer   // 缓冲管道，用于读、写两个goroutine之间的消息通信
+	msgHandler        *gnet.MsgHandler   // 消息处理模块
+	dataPack          gnet.IDataPack     // 封包格式
+	socket            gnet.ISocket       // 当前链接关联的Socket
+	session           *Session           // 当前链接的KCP会话
+	ctx               context.Context    // 告知该链接已经退出/停止的channel
+	cancel            context.CancelFunc // cancelFunc
+}
+
+// NewConnection 创建新的链接对象
+func NewConnection(socket gnet.ISocket, session *Session, connID uint32, msgHandler *gnet.MsgHandler, maxMsgChanLen uint32) *Connection {
+	c := &Connection{
+		socket:     socket,
+		session:    session,
+		connID:     connID,
+		isClosed:   0,
+		msgHandler: msgHandler,
+		dataPack:   socket.GetDataPack(),
+		msgChan:    make(chan gnet.Buffer, maxMsgChanLen),
+	}
+	// 加入链接管理器后可能在Start之前被Stop(如Shutdown、顶号)，ctx需提前创建
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	if session != nil {
+		// 将新创建的Conn添加到链接管理器
+		c.socket.GetConnMgr().Add(c)
+	} else {
+		c.isClosed = 1
+	}
+
+	return c
+}
+
+// StartWriter 写消息Goroutine， 用户将数据发送给客户端
+func (c *Connection) StartWriter() {
+	defer func() {
+		glog.Infof("Connection Writer Close, ConnId:%d", c.connID)
+		if err := recover(); err != nil {
+			e := fmt.Sprintf("%v", err)
+			glog.Errorf("Connection write loop has error:%v, ConnId:%d, Addr:%s", e, c.connID, c.RemoteAddr())
+		}
+	}()
+
+	defer c.Stop()
+
+	for {
+		select {
+		case data, ok := <-c.msgChan:
+			if ok {
+				// 有数据要写给客户端
+				_, err := c.session.Write(data.B)
+				data.Release()
+				if err != nil {
+					glog.Warnf("Connection write message has error: %s, ConnId:%d, Addr:%s 即将断开", err.Error(), c.connID, c.RemoteAddr())
+					return
+				}
+				atomic.AddInt32(&c.pending, -1)
+			} else {
+				glog.Warnf("MsgChan has been closed, ConnId:%d, Addr:%s 即将断开", c.connID, c.RemoteAddr())
+				break
+			}
+		case <-c.ctx.Done():
+			glog.Debugf("Connection Context Is Cancel, Stop Writer, ConnId:%d, Addr:%s 即将断开", c.connID, c.RemoteAddr())
+			return
+		}
+	}
+}
+
+// StartReader 读消息Goroutine，用于从客户端中读取数据
+func (c *Connection) StartReader() {
+	defer func() {
+		glog.Infof("Connection Reader Close, ConnId:%d", c.connID)
+		if err := recover(); err != nil {
+			e := fmt.Sprintf("%v", err)
+			glog.Errorf("Connection read loop has error:%v, ConnId:%d", e, c.connID)
+		}
+	}()
+
+	defer c.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			glog.Debugf("Connection Context Is Cancel, Stop Reader, ConnId:%d, Addr:%s 即将断开", c.connID, c.RemoteAddr())
+			return
+		default:
+			// 按封包格式读取客户端的Msg
+			msg, err := gnet.ReadMsg(c.dataPack, c.session)
+			if err != nil {
+				glog.Warnf("Connection read message has error: %s, ConnId:%d, (%s)即将断开", err.Error(), c.connID, c.RemoteAddr())
+				return
+			}
+
+			// 得到当前客户端请求的Request数据
+			req := gnet.NewRequest(c, msg)
+			// 将收到消息交给Worker处理
+			c.msgHandler.SendMsgToTaskQueue(req)
+		}
+	}
+}
+
+//============== 实现 interfaces.IConnection 里的全部接口方法 ========
+
+func (c *Connection) GetProtocolType() gnet.ProtocolType {
+	return gnet.Kcp
+}
+
+func (c *Connection) Start() {
+	if c.session != nil {
+		// 开启一个Go协程，从客户端读取数据
+		go c.StartReader()
+		// 开启一个Go协程，写回数据到客户端
+		go c.StartWriter()
+
+		// 触发Socket中Conn Start钩子方法
+		c.socket.CallOnConnStart(c)
+	}
+}
+
+// Stop 停止连接，结束当前连接状态
+func (c *Connection) Stop() {
+	glog.Debugf("停止连接, ConnId:%d, Addr:%s", c.connID, c.RemoteAddr())
+
+	// 标记为已关闭状态, 如果已经关闭则不执行任何操作
+	if c.SetClosed() == false {
+		return
+	}
+
+	glog.Infof("执行关闭链接操作, ConnId:%d, Addr:%s, IsClosed:%v", c.connID, c.RemoteAddr(), c.isClosed)
+
+	c.cancel()
+
+	// 缓冲管道不关闭，写协程通过ctx退出，避免并发发送消息时向已关闭的管道写入
+
+	// 关闭KCP会话
+	_ = c.session.Close()
+
+	// 将链接从连接管理器中删除
+	c.socket.GetConnMgr().Remove(c)
+
+	// 触发Socket中Conn Stop钩子方法(放在go内，防止回调出现死锁）
+	c.socket.GetConnMgr().GoCallback(c, c.socket.CallOnConnStop)
+}
+
+func (c *Connection) GetConnID() uint32 {
+	return c.connID
+}
+
+func (c *Connection) SetClosed() bool {
+	return atomic.SwapInt32(&c.isClosed, 1) == 0
+}
+
+func (c *Connection) IsClosed() bool {
+	return atomic.LoadInt32(&c.isClosed) == 1
+}
+
+func (c *Connection) GetTcpConnection() *net.TCPConn {
+	return nil
+}
+
+func (c *Connection) GetNetConnection() net.Conn {
+	if c.session != nil {
+		return c.session
+	}
+	return nil
+}
+
+func (c *Connection) GetWsConnection() *websocket.Conn {
+	return nil
+}
+
+// GetSession 获取链接的KCP会话
+func (c *Connection) GetSession() *Session {
+	return c.session
+}
+
+func (c *Connection) GetSocket() gnet.ISocket {
+	return c.socket
+}
+
+func (c *Connection) RemoteAddr() net.Addr {
+	if c.session != nil {
+		return c.session.RemoteAddr()
+	}
+	return nil
+}
+
+// GetDataPack 获取链接的封包格式
+func (c *Connection) GetDataPack() gnet.IDataPack {
+	return c.dataPack
+}
+
+// SetDataPack 设置链接的封包格式(需在Start之前设置)
+func (c *Connection) SetDataPack(dataPack gnet.IDataPack) {
+	c.dataPack = dataPack
+}
+
+func (c *Connection) SendMsg(msgId uint32, data []byte) error {
+	return c.SendSeqMsg(msgId, 0, data)
+}
+
+// SendSeqMsg 发送携带请求序列号的消息
+func (c *Connection) SendSeqMsg(msgId uint32, seqId uint32, data []byte) error {
+	if data == nil {
+		return errors.New("connection send nil msg")
+	}
+
+	// 将data封包，并且发送
+	p := gnet.NewMsg(msgId, data).WithSeqId(seqId)
+	msg, err := gnet.PackBuffer(c.dataPack, p)
+	if err != nil {
+		glog.Errorf("Connection pack message fail，msgId:%d, msgData:%v, err:%s, ConnId:%d, Addr:%s", msgId, data, err.Error(), c.connID, c.RemoteAddr())
+		return errors.New(fmt.Sprintf("connection pack message fail, err:%v", err))
+	}
+
+	if err := c.writeMsgChan(msgId, msg); err != nil {
+		return err
+	}
+	gnet.MetricsMgr.OnSend(msgId, len(data))
+	return nil
+}
+
+// SendPackedMsg 发送已按链接封包格式封包好的数据(广播时只封包一次)
+func (c *Connection) SendPackedMsg(data []byte) error {
+	if data == nil {
+		return errors.New("connection send nil msg")
+	}
+	return c.writeMsgChan(0, gnet.NewBuffer(data))
+}
+
+// Flush 等待缓冲管道中的数据全部写出(链接关闭或ctx超时返回)
+func (c *Connection) Flush(ctx context.Context) error {
+	return gnet.WaitUntil(ctx, func() bool {
+		return c.IsClosed() || atomic.LoadInt32(&c.pending) <= 0
+	})
+}
+
+// writeMsgChan 将封包好的数据写入缓冲管道
+func (c *Connection) writeMsgChan(msgId uint32, msg gnet.Buffer) error {
+	// 未写入缓冲管道的数据放回缓冲池
+	queued := false
+	defer func() {
+		if !queued {
+			msg.Release()
+		}
+	}()
+
+	// 链接已关闭
+	if c.IsClosed() {
+		glog.Warnf("Connection has been closed when send msg, ConnId:%d, Addr:%s", c.connID, c.RemoteAddr())
+		return errors.New("connection has been closed when send msg")
+	}
+
+	// 检测通道关闭Panic
+	defer func() {
+		if err := recover(); err != nil {
+			e := fmt.Sprintf("%v", err)
+			glog.Errorf("Connection SendMsg has error:%v, ConnId:%d, Addr:%s", e, c.connID, c.RemoteAddr())
+		}
+	}()
+
+	atomic.AddInt32(&c.pending, 1)
+	select {
+	case c.msgChan <- msg:
+		queued = true
+	case <-c.ctx.Done():
+		glog.Debugf("Connection Context Done, ConnId:%d, Addr:%s", c.connID, c.RemoteAddr())
+		atomic.AddInt32(&c.pending, -1)
+	default:
+		atomic.AddInt32(&c.pending, -1)
+		glog.Warnf("Connection Send Msg Error, I/O Buff Is Full Or Can't Write Msg To Client, MsgId:%d, ConnId:%d, Addr:%s", msgId, c.connID, c.RemoteAddr())
+		return errors.New("I/O Buff Is Full Or Can't Write Msg To Client")
+	}
+
+	return nil
+}
@@ -0,0 +1,625 @@
+package gkcp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+//|--------------------------------segment head---------------------------------|---body---|
+//|--4 bytes--|-1 byte-|-1 byte-|-2 bytes-|--4 bytes--|--4 bytes--|--4 bytes--|--4 bytes--|---len----|
+//|--------------------------------------------------------------------------------------------------|
+//|---conv----|--cmd---|--frg---|--wnd----|----ts-----|----sn-----|----una----|----len----|---data---|
+//|--------------------------------------------------------------------------------------------------|
+
+const (
+	cmdPush  uint8 = 81 // 数据分片
+	cmdAck   uint8 = 82 // 确认
+	cmdWins  uint8 = 84 // 窗口通告
+	cmdPing  uint8 = 85 // 心跳
+	cmdClose uint8 = 86 // 关闭通知
+)
+
+const (
+	segmentOverhead = 24    // 分片头长度
+	defaultMtu      = 1400  // 默认MTU
+	defaultSndWnd   = 128   // 默认发送窗口
+	defaultRcvWnd   = 128   // 默认接收窗口
+	defaultInterval = 40    // 默认flush间隔(毫秒)
+	rtoNoDelay      = 30    // nodelay模式最小RTO(毫秒)
+	rtoMin          = 100   // 普通模式最小RTO(毫秒)
+	rtoDefault      = 200   // 默认RTO(毫秒)
+	rtoMax          = 60000 // 最大RTO(毫秒)
+	deadLinkXmit    = 20    // 同一分片最大重传次数，超过则认为链路断开
+	threshInit      = 2     // 初始慢启动阈值
+	threshMin       = 2     // 最小慢启动阈值
+)
+
+var (
+	errConvMismatch = errors.New("kcp: conv mismatch")
+	errInvalidData  = errors.New("kcp: invalid segment data")
+	errInvalidCmd   = errors.New("kcp: invalid segment cmd")
+)
+
+// 计算两个时间戳/序号的差值(考虑回绕)
+func timeDiff(later, earlier uint32) int32 {
+	return int32(later - earlier)
+}
+
+type segment struct {
+	conv     uint32
+	cmd      uint8
+	wnd      uint16
+	ts       uint32
+	sn       uint32
+	una      uint32
+	resendTs uint32
+	rto      uint32
+	fastAck  uint32
+	xmit     uint32
+	data     []byte
+}
+
+// encode 将分片编码追加到buf
+func (seg *segment) encode(buf []byte) []byte {
+	var head [segmentOverhead]byte
+	binary.LittleEndian.PutUint32(head[0:], seg.conv)
+	head[4] = seg.cmd
+	head[5] = 0 // frg, 流模式下不使用
+	binary.LittleEndian.PutUint16(head[6:], seg.wnd)
+	binary.LittleEndian.PutUint32(head[8:], seg.ts)
+	binary.LittleEndian.PutUint32(head[12:], seg.sn)
+	binary.LittleEndian.PutUint32(head[16:], seg.una)
+	binary.LittleEndian.PutUint32(head[20:], uint32(len(seg.data)))
+	buf = append(buf, head[:]...)
+	return append(buf, seg.data...)
+}
+
+type ackItem struct {
+	sn uint32
+	ts uint32
+}
+
+// kcp ARQ协议实现(流模式)，非线程安全，由Session加锁调用
+type kcp struct {
+	conv       uint32
+	mtu        uint32
+	mss        uint32
+	sndUna     uint32 // 第一个未确认的分片序号
+	sndNxt     uint32 // 下一个待发送的分片序号
+	rcvNxt     uint32 // 下一个待接收的分片序号
+	ssthresh   uint32 // 慢启动阈值
+	cwnd       uint32 // 拥塞窗口
+	incr       uint32
+	rxSrtt     int32
+	rxRttVar   int32
+	rxRto      uint32
+	rxMinRto   uint32
+	sndWnd     uint32 // 发送窗口
+	rcvWnd     uint32 // 接收窗口
+	rmtWnd     uint32 // 对端接收窗口
+	current    uint32 // 当前时间(毫秒)
+	interval   uint32 // flush间隔(毫秒)
+	tsFlush    uint32 // 下次flush时间
+	noDelay    bool   // 是否开启nodelay模式
+	fastResend uint32 // 快速重传阈值
+	noCwnd     bool   // 是否关闭拥塞控制
+	probeWins  bool   // 是否需要发送窗口通告
+	deadLink   bool   // 链路是否已断开
+	sndQueue   []*segment
+	sndBuf     []*segment
+	rcvBuf     []*segment
+	rcvQueue   [][]byte
+	acks       []ackItem
+	buffer     []byte
+	output     func(buf []byte) // 输出UDP数据
+}
+
+func newKcp(conv uint32, output func(buf []byte)) *kcp {
+	k := &kcp{
+		conv:     conv,
+		mtu:      defaultMtu,
+		mss:      defaultMtu - segmentOverhead,
+		sndWnd:   defaultSndWnd,
+		rcvWnd:   defaultRcvWnd,
+		rmtWnd:   defaultRcvWnd,
+		rxRto:    rtoDefault,
+		rxMinRto: rtoMin,
+		interval: defaultInterval,
+		tsFlush:  defaultInterval,
+		ssthresh: threshInit,
+		cwnd:     1,
+		output:   output,
+	}
+	k.incr = k.mss
+	k.buffer = make([]byte, 0, k.mtu)
+	return k
+}
+
+// setNoDelay 设置nodelay模式、flush间隔、快速重传阈值以及是否关闭拥塞控制
+func (k *kcp) setNoDelay(noDelay bool, interval uint32, resend int, noCwnd bool) {
+	k.noDelay = noDelay
+	if noDelay {
+		k.rxMinRto = rtoNoDelay
+	} else {
+		k.rxMinRto = rtoMin
+	}
+	if interval > 0 {
+		if interval < 10 {
+			interval = 10
+		} else if interval > 5000 {
+			interval = 5000
+		}
+		k.interval = interval
+	}
+	if resend >= 0 {
+		k.fastResend = uint32(resend)
+	}
+	k.noCwnd = noCwnd
+}
+
+// setWndSize 设置发送/接收窗口
+func (k *kcp) setWndSize(sndWnd, rcvWnd uint32) {
+	if sndWnd > 0 {
+		k.sndWnd = sndWnd
+	}
+	if rcvWnd > 0 {
+		k.rcvWnd = rcvWnd
+	}
+}
+
+// setMtu 设置MTU
+func (k *kcp) setMtu(mtu int) {
+	if mtu <= segmentOverhead+50 {
+		return
+	}
+	k.mtu = uint32(mtu)
+	k.mss = k.mtu - segmentOverhead
+	k.buffer = make([]byte, 0, k.mtu)
+}
+
+// send 写入待发送数据(流模式下会合并到队尾未满的分片中)
+func (k *kcp) send(data []byte) {
+	if n := len(k.sndQueue); n > 0 {
+		last := k.sndQueue[n-1]
+		if space := int(k.mss) - len(last.data); space > 0 {
+			c := len(data)
+			if c > space {
+				c = space
+			}
+			last.data = append(last.data, data[:c]...)
+			data = data[c:]
+		}
+	}
+
+	for len(data) > 0 {
+		c := len(data)
+		if c > int(k.mss) {
+			c = int(k.mss)
+		}
+		k.sndQueue = append(k.sndQueue, &segment{data: append([]byte(nil), data[:c]...)})
+		data = data[c:]
+	}
+}
+
+// recv 读取已按序到达的数据
+func (k *kcp) recv(b []byte) int {
+	full := uint32(len(k.rcvQueue)) >= k.rcvWnd
+	n := 0
+	for n < len(b) && len(k.rcvQueue) > 0 {
+		c := copy(b[n:], k.rcvQueue[0])
+		n += c
+		if c < len(k.rcvQueue[0]) {
+			k.rcvQueue[0] = k.rcvQueue[0][c:]
+		} else {
+			k.rcvQueue[0] = nil
+			k.rcvQueue = k.rcvQueue[1:]
+		}
+	}
+
+	k.moveRcvBuf()
+
+	// 接收窗口从满变为可用，通知对端
+	if full && uint32(len(k.rcvQueue)) < k.rcvWnd {
+		k.probeWins = true
+	}
+	return n
+}
+
+// peekSize 可读取的数据长度
+func (k *kcp) peekSize() int {
+	n := 0
+	for _, data := range k.rcvQueue {
+		n += len(data)
+	}
+	return n
+}
+
+// waitSnd 等待发送(含未确认)的分片数量
+func (k *kcp) waitSnd() int {
+	return len(k.sndBuf) + len(k.sndQueue)
+}
+
+func (k *kcp) wndUnused() uint16 {
+	if uint32(len(k.rcvQueue)) < k.rcvWnd {
+		return uint16(k.rcvWnd - uint32(len(k.rcvQueue)))
+	}
+	return 0
+}
+
+// moveRcvBuf 将连续到达的分片移入接收队列
+func (k *kcp) moveRcvBuf() {
+	for len(k.rcvBuf) > 0 {
+		seg := k.rcvBuf[0]
+		if seg.sn != k.rcvNxt || uint32(len(k.rcvQueue)) >= k.rcvWnd {
+			break
+		}
+		k.rcvQueue = append(k.rcvQueue, seg.data)
+		k.rcvBuf[0] = nil
+		k.rcvBuf = k.rcvBuf[1:]
+		k.rcvNxt++
+	}
+}
+
+// updateAck 根据RTT更新RTO
+func (k *kcp) updateAck(rtt int32) {
+	if k.rxSrtt == 0 {
+		k.rxSrtt = rtt
+		k.rxRttVar = rtt / 2
+	} else {
+		delta := rtt - k.rxSrtt
+		if delta < 0 {
+			delta = -delta
+		}
+		k.rxRttVar = (3*k.rxRttVar + delta) / 4
+		k.rxSrtt = (7*k.rxSrtt + rtt) / 8
+		if k.rxSrtt < 1 {
+			k.rxSrtt = 1
+		}
+	}
+
+	rto := uint32(k.rxSrtt)
+	if varRto := uint32(4 * k.rxRttVar); varRto > k.interval {
+		rto += varRto
+	} else {
+		rto += k.interval
+	}
+	if rto < k.rxMinRto {
+		rto = k.rxMinRto
+	} else if rto > rtoMax {
+		rto = rtoMax
+	}
+	k.rxRto = rto
+}
+
+func (k *kcp) shrinkBuf() {
+	if len(k.sndBuf) > 0 {
+		k.sndUna = k.sndBuf[0].sn
+	} else {
+		k.sndUna = k.sndNxt
+	}
+}
+
+// parseAck 删除已被确认的分片
+func (k *kcp) parseAck(sn uint32) {
+	if timeDiff(sn, k.sndUna) < 0 || timeDiff(sn, k.sndNxt) >= 0 {
+		return
+	}
+	for i, seg := range k.sndBuf {
+		if seg.sn == sn {
+			k.sndBuf = append(k.sndBuf[:i], k.sndBuf[i+1:]...)
+			break
+		}
+		if timeDiff(sn, seg.sn) < 0 {
+			break
+		}
+	}
+}
+
+// parseUna 删除una之前的全部分片(累计确认)
+func (k *kcp) parseUna(una uint32) {
+	count := 0
+	for _, seg := range k.sndBuf {
+		if timeDiff(una, seg.sn) <= 0 {
+			break
+		}
+		count++
+	}
+	if count > 0 {
+		k.sndBuf = k.sndBuf[count:]
+	}
+}
+
+// parseFastAck 统计被跳过确认的次数，用于快速重传
+func (k *kcp) parseFastAck(sn uint32) {
+	if timeDiff(sn, k.sndUna) < 0 || timeDiff(sn, k.sndNxt) >= 0 {
+		return
+	}
+	for _, seg := range k.sndBuf {
+		if timeDiff(sn, seg.sn) < 0 {
+			break
+		} else if sn != seg.sn {
+			seg.fastAck++
+		}
+	}
+}
+
+// parseData 按序号有序插入接收缓冲区，丢弃重复分片
+func (k *kcp) parseData(newSeg *segment) {
+	sn := newSeg.sn
+	if timeDiff(sn, k.rcvNxt+k.rcvWnd) >= 0 || timeDiff(sn, k.rcvNxt) < 0 {
+		return
+	}
+
+	idx := len(k.rcvBuf)
+	for idx > 0 {
+		seg := k.rcvBuf[idx-1]
+		if seg.sn == sn {
+			return
+		}
+		if timeDiff(sn, seg.sn) > 0 {
+			break
+		}
+		idx--
+	}
+	k.rcvBuf = append(k.rcvBuf, nil)
+	copy(k.rcvBuf[idx+1:], k.rcvBuf[idx:])
+	k.rcvBuf[idx] = newSeg
+
+	k.moveRcvBuf()
+}
+
+// input 处理收到的UDP数据，返回对端是否通知关闭
+func (k *kcp) input(data []byte) (closed bool, err error) {
+	prevUna := k.sndUna
+	var maxAck uint32
+	hasAck := false
+
+	for len(data) >= segmentOverhead {
+		conv := binary.LittleEndian.Uint32(data[0:])
+		if conv != k.conv {
+			return closed, errConvMismatch
+		}
+		cmd := data[4]
+		wnd := binary.LittleEndian.Uint16(data[6:])
+		ts := binary.LittleEndian.Uint32(data[8:])
+		sn := binary.LittleEndian.Uint32(data[12:])
+		una := binary.LittleEndian.Uint32(data[16:])
+		length := binary.LittleEndian.Uint32(data[20:])
+		data = data[segmentOverhead:]
+		if uint32(len(data)) < length {
+			return closed, errInvalidData
+		}
+		if cmd != cmdPush && cmd != cmdAck && cmd != cmdWins && cmd != cmdPing && cmd != cmdClose {
+			return closed, errInvalidCmd
+		}
+
+		k.rmtWnd = uint32(wnd)
+		k.parseUna(una)
+		k.shrinkBuf()
+
+		switch cmd {
+		case cmdAck:
+			if rtt := timeDiff(k.current, ts); rtt >= 0 {
+				k.updateAck(rtt)
+			}
+			k.parseAck(sn)
+			k.shrinkBuf()
+			if !hasAck || timeDiff(sn, maxAck) > 0 {
+				hasAck = true
+				maxAck = sn
+			}
+		case cmdPush:
+			if timeDiff(sn, k.rcvNxt+k.rcvWnd) < 0 {
+				k.acks = append(k.acks, ackItem{sn: sn, ts: ts})
+				if timeDiff(sn, k.rcvNxt) >= 0 {
+					k.parseData(&segment{
+						conv: conv,
+						cmd:  cmd,
+						sn:   sn,
+						ts:   ts,
+						data: append([]byte(nil), data[:length]...),
+					})
+				}
+			}
+		case cmdClose:
+			closed = true
+		}
+
+		data = data[length:]
+	}
+
+	if hasAck {
+		k.parseFastAck(maxAck)
+	}
+
+	// 有新的分片被确认，扩大拥塞窗口
+	if !k.noCwnd && timeDiff(k.sndUna, prevUna) > 0 && k.cwnd < k.rmtWnd {
+		if k.cwnd < k.ssthresh {
+			k.cwnd++
+			k.incr += k.mss
+		} else {
+			if k.incr < k.mss {
+				k.incr = k.mss
+			}
+			k.incr += (k.mss*k.mss)/k.incr + k.mss/16
+			if (k.cwnd+1)*k.mss <= k.incr {
+				k.cwnd++
+			}
+		}
+		if k.cwnd > k.rmtWnd {
+			k.cwnd = k.rmtWnd
+			k.incr = k.rmtWnd * k.mss
+		}
+	}
+
+	return closed, nil
+}
+
+// flush 发送ACK、窗口通告以及需要(重新)发送的数据分片
+func (k *kcp) flush() {
+	current := k.current
+	buf := k.buffer[:0]
+	emit := func(seg *segment) {
+		if len(buf)+segmentOverhead+len(seg.data) > int(k.mtu) && len(buf) > 0 {
+			k.output(buf)
+			buf = buf[:0]
+		}
+		buf = seg.encode(buf)
+	}
+
+	seg := segment{
+		conv: k.conv,
+		cmd:  cmdAck,
+		wnd:  k.wndUnused(),
+		una:  k.rcvNxt,
+	}
+
+	// 发送ACK
+	for _, ack := range k.acks {
+		seg.sn, seg.ts = ack.sn, ack.ts
+		emit(&seg)
+	}
+	k.acks = k.acks[:0]
+
+	// 发送窗口通告
+	if k.probeWins {
+		seg.cmd, seg.sn, seg.ts = cmdWins, 0, 0
+		emit(&seg)
+		k.probeWins = false
+	}
+
+	// 计算可发送窗口，对端窗口为0时仍允许一个分片在途，用于窗口探测
+	cwnd := k.sndWnd
+	if k.rmtWnd < cwnd {
+		cwnd = k.rmtWnd
+	}
+	if !k.noCwnd && k.cwnd < cwnd {
+		cwnd = k.cwnd
+	}
+	if cwnd == 0 {
+		cwnd = 1
+	}
+
+	// 将发送队列中的分片移入发送缓冲区
+	for len(k.sndQueue) > 0 && timeDiff(k.sndNxt, k.sndUna+cwnd) < 0 {
+		newSeg := k.sndQueue[0]
+		k.sndQueue[0] = nil
+		k.sndQueue = k.sndQueue[1:]
+		newSeg.conv = k.conv
+		newSeg.cmd = cmdPush
+		newSeg.sn = k.sndNxt
+		k.sndNxt++
+		k.sndBuf = append(k.sndBuf, newSeg)
+	}
+
+	resent := k.fastResend
+	if resent == 0 {
+		resent = 0xffffffff
+	}
+	var rtoMinDelay uint32
+	if !k.noDelay {
+		rtoMinDelay = k.rxRto >> 3
+	}
+
+	change, lost := false, false
+	for _, s := range k.sndBuf {
+		needSend := false
+		if s.xmit == 0 {
+			// 首次发送
+			needSend = true
+			s.rto = k.rxRto
+			s.resendTs = current + s.rto + rtoMinDelay
+		} else if timeDiff(current, s.resendTs) >= 0 {
+			// 超时重传
+			needSend = true
+			if k.noDelay {
+				s.rto += s.rto / 2
+			} else if s.rto > k.rxRto {
+				s.rto += s.rto
+			} else {
+				s.rto += k.rxRto
+			}
+			if s.rto > rtoMax {
+				s.rto = rtoMax
+			}
+			s.resendTs = current + s.rto
+			lost = true
+		} else if s.fastAck >= resent {
+			// 快速重传
+			needSend = true
+			s.fastAck = 0
+			s.resendTs = current + s.rto
+			change = true
+		}
+
+		if needSend {
+			s.xmit++
+			s.ts = current
+			s.wnd = seg.wnd
+			s.una = k.rcvNxt
+			emit(s)
+			if s.xmit >= deadLinkXmit {
+				k.deadLink = true
+			}
+		}
+	}
+
+	if len(buf) > 0 {
+		k.output(buf)
+	}
+	k.buffer = buf[:0]
+
+	// 拥塞控制
+	if !k.noCwnd {
+		if change {
+			inflight := k.sndNxt - k.sndUna
+			k.ssthresh = inflight / 2
+			if k.ssthresh < threshMin {
+				k.ssthresh = threshMin
+			}
+			k.cwnd = k.ssthresh + resent
+			k.incr = k.cwnd * k.mss
+		}
+		if lost {
+			k.ssthresh = cwnd / 2
+			if k.ssthresh < threshMin {
+				k.ssthresh = threshMin
+			}
+			k.cwnd = 1
+			k.incr = k.mss
+		}
+		if k.cwnd < 1 {
+			k.cwnd = 1
+			k.incr = k.mss
+		}
+	}
+}
+
+// update 驱动定时flush，current为当前时间(毫秒)
+func (k *kcp) update(current uint32) {
+	k.current = current
+	slap := timeDiff(current, k.tsFlush)
+	if slap >= 10000 || slap < -10000 {
+		k.tsFlush = current
+		slap = 0
+	}
+	if slap >= 0 {
+		k.tsFlush += k.interval
+		if timeDiff(current, k.tsFlush) >= 0 {
+			k.tsFlush = current + k.interval
+		}
+		k.flush()
+	}
+}
+
+// encodeCmd 编码不可靠的控制分片(心跳/关闭通知)
+func (k *kcp) encodeCmd(cmd uint8) []byte {
+	seg := segment{
+		conv: k.conv,
+		cmd:  cmd,
+		wnd:  k.wndUnused(),
+		ts:   k.current,
+		una:  k.rcvNxt,
+	}
+	return seg.encode(nil)
+}
@@ -0,0 +1,145 @@
+package gkcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+)
+
+var (
+	ErrListenerClosed = errors.New("kcp listener closed")
+	acceptBacklog     = 128
+)
+
+// Listener KCP监听器，按会话ID(conv)将UDP数据分发到对应的会话
+type Listener struct {
+	conn      net.PacketConn
+	options   Options
+	ownConn   bool
+	mu        sync.Mutex
+	sessions  map[uint32]*Session
+	chAccept  chan *Session
+	die       chan struct{}
+	closeOnce sync.Once
+}
+
+// Listen 监听UDP地址
+func Listen(addr string, options Options) (*Listener, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	l := ServeConn(conn, options)
+	l.ownConn = true
+	return l, nil
+}
+
+// ServeConn 在指定UDP套接字上创建监听器
+func ServeConn(conn net.PacketConn, options Options) *Listener {
+	l := &Listener{
+		conn:     conn,
+		options:  options,
+		sessions: make(map[uint32]*Session),
+		chAccept: make(chan *Session, acceptBacklog),
+		die:      make(chan struct{}),
+	}
+	go l.readLoop()
+	return l
+}
+
+// AcceptSession 阻塞等待新的会话
+func (l *Listener) AcceptSession() (*Session, error) {
+	select {
+	case s := <-l.chAccept:
+		return s, nil
+	case <-l.die:
+		return nil, ErrListenerClosed
+	}
+}
+
+// Accept 实现 net.Listener 接口
+func (l *Listener) Accept() (net.Conn, error) {
+	return l.AcceptSession()
+}
+
+// Close 关闭监听器以及全部会话
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.die)
+
+		l.mu.Lock()
+		sessions := make([]*Session, 0, len(l.sessions))
+		for _, s := range l.sessions {
+			sessions = append(sessions, s)
+		}
+		l.mu.Unlock()
+
+		for _, s := range sessions {
+			_ = s.Close()
+		}
+		if l.ownConn {
+			_ = l.conn.Close()
+		}
+	})
+	return nil
+}
+
+// Addr 监听地址
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// SessionLen 当前会话数量
+func (l *Listener) SessionLen() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.sessions)
+}
+
+func (l *Listener) remove(conv uint32) {
+	l.mu.Lock()
+	delete(l.sessions, conv)
+	l.mu.Unlock()
+}
+
+func (l *Listener) readLoop() {
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			_ = l.Close()
+			return
+		}
+		if n < segmentOverhead {
+			continue
+		}
+
+		conv := binary.LittleEndian.Uint32(buf)
+		l.mu.Lock()
+		s, ok := l.sessions[conv]
+		if !ok {
+			// 只有数据分片可以创建新会话，忽略已关闭会话的残留ACK/心跳
+			if buf[4] != cmdPush || len(l.chAccept) >= cap(l.chAccept) {
+				l.mu.Unlock()
+				continue
+			}
+			select {
+			case <-l.die:
+				l.mu.Unlock()
+				return
+			default:
+			}
+			s = newSession(conv, l.conn, addr, l, l.options)
+			l.sessions[conv] = s
+			l.chAccept <- s
+		}
+		l.mu.Unlock()
+
+		s.input(buf[:n], addr)
+	}
+}
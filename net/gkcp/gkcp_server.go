@@ -0,0 +1,295 @@
+package gkcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Ravior/gserver/net/gnet"
+	"github.com/Ravior/gserver/os/glog"
+	"github.com/Ravior/gserver/util/gconfig"
+	"sync/atomic"
+	"time"
+)
+
+// Server KCP(可靠UDP)服务器，会话以会话ID(conv)区分
+type Server struct {
+	name        string            // 服务器名称
+	id          string            // 服务器ID
+	ip          string            // Host
+	port        int32             // 端口
+	exit        chan bool         // 退出通道
+	options     Options           // KCP会话参数
+	listener    *Listener         // 服务器KCP监听器
+	connMgr     *gnet.ConnManager // 链接管理器
+	router      *gnet.Router      // 消息路由器
+	msgHandler  *gnet.MsgHandler  // 当前Server的消息管理模块，用来绑定消息ID和对应的处理方法
+	dataPack    gnet.IDataPack    // 封包格式
+	onConnStart gnet.ConnCallback // 有新的客户端链接时触发的Hook函数
+	onConnStop  gnet.ConnCallback // 当客户端链接断开时触发的Hook函数
+	closing     int32             // 是否正在关闭(采用原子操作处理)
+	closingId   uint32            // 服务器关闭时广播给客户端的消息ID
+	closingMsg  []byte            // 服务器关闭时广播给客户端的消息
+	metricsId   uint32            // 链接数量指标的注册ID
+}
+
+func NewServer() *Server {
+	server := &Server{
+		id:         gconfig.Global.ServerId,
+		name:       gconfig.Global.ServerName,
+		ip:         gconfig.Global.KcpServer.IP,
+		port:       gconfig.Global.KcpServer.Port,
+		options:    NewOptions(gconfig.Global.KcpServer),
+		connMgr:    gnet.NewConnManager(),
+		router:     &gnet.Router{},
+		exit:       make(chan bool, 1),
+		dataPack:   gnet.NewDataPack(),
+		msgHandler: gnet.NewMsgHandler(gconfig.Global.KcpServer.WorkerPoolSize, gconfig.Global.KcpServer.WorkerTaskLen),
+	}
+	server.msgHandler.SetRouter(server.router)
+	server.metricsId = gnet.MetricsMgr.RegisterConnMgr("kcp", server.name, server.connMgr)
+	return server
+}
+
+// NewOptions 根据配置生成KCP会话参数，未配置的项使用默认值
+func NewOptions(config gconfig.KcpServerConfig) Options {
+	options := DefaultOptions()
+	options.NoDelay = config.NoDelay
+	options.Resend = config.Resend
+	options.NoCongestion = config.NoCongestion
+	if config.Interval > 0 {
+		options.Interval = config.Interval
+	}
+	if config.SndWnd > 0 {
+		options.SndWnd = config.SndWnd
+	}
+	if config.RcvWnd > 0 {
+		options.RcvWnd = config.RcvWnd
+	}
+	if config.Mtu > 0 {
+		options.Mtu = config.Mtu
+	}
+	if config.HeartBeat > 0 {
+		options.HeartBeat = time.Duration(config.HeartBeat) * time.Second
+	}
+	if config.Timeout > 0 {
+		options.Timeout = time.Duration(config.Timeout) * time.Second
+	}
+	return options
+}
+
+//============== 实现 interfaces.INetEndPoint 里的全部接口方法 ========
+
+// GetName 获取服务器名称
+func (s *Server) GetName() string {
+	return s.name
+}
+
+// GetId 获取服务器ID
+func (s *Server) GetId() string {
+	return s.id
+}
+
+// GetHost 获取服务器IP地址
+func (s *Server) GetHost() string {
+	return s.ip
+}
+
+// GetPort 获取服务器端口
+func (s *Server) GetPort() int32 {
+	return s.port
+}
+
+// SetOptions 设置KCP会话参数(需在Start之前设置)
+func (s *Server) SetOptions(options Options) {
+	s.options = options
+}
+
+// Start 启动服务器，监听失败时记录错误并退出进程(需要处理启动错误时先调用Listen)
+func (s *Server) Start() {
+	glog.Infof("Server: %s StartWork", s.GetName())
+	// 在Start返回前完成监听，启动失败不会被静默忽略
+	if err := s.Listen(); err != nil {
+		glog.Fatalf("Kcp Server: %s start fail, Error:%s", s.GetName(), err.Error())
+	}
+	// 启动消息Worker工作池(在Start返回前完成，Stop可以立即调用)
+	s.msgHandler.StartWorkerPool()
+
+	listener := s.listener
+	// 开启一个Go协程去处理KCP会话
+	go func() {
+		var connID uint32 = 0
+
+		// 处理KCP会话
+		for {
+			// 阻塞等待新的会话
+			session, err := listener.AcceptSession()
+			if err != nil {
+				return
+			}
+
+			// 服务器正在关闭，不再接收新会话
+			if atomic.LoadInt32(&s.closing) == 1 {
+				_ = session.Close()
+				continue
+			}
+
+			// 最大连接数判断
+			if gconfig.Global.KcpServer.MaxConn > 0 && s.GetConnMgr().Len() >= gconfig.Global.KcpServer.MaxConn {
+				_ = session.Close()
+				continue
+			}
+
+			// 创建链接对象
+			dealConn := NewConnection(s, session, connID, s.msgHandler, gconfig.Global.KcpServer.MaxMsgChanLen)
+
+			// 原子+1
+			atomic.AddUint32(&connID, 1)
+
+			// 启动当前链接的处理业务
+			go dealConn.Start()
+		}
+	}()
+}
+
+// Listen 监听服务器地址，失败时返回错误；已监听时直接返回
+// 需在Start之前调用，未调用时由Start调用
+func (s *Server) Listen() error {
+	if s.listener != nil {
+		return nil
+	}
+	listener, err := Listen(fmt.Sprintf("%s:%d", s.ip, s.port), s.options)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	return nil
+}
+
+// Stop 停止服务器
+func (s *Server) Stop() {
+	if !atomic.CompareAndSwapInt32(&s.closing, 0, 1) {
+		return
+	}
+	gnet.MetricsMgr.UnregisterConnMgr(s.metricsId)
+	//关闭worker工作池
+	s.msgHandler.StopWorkerPool()
+	s.connMgr.ClearConn()
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+
+	s.exit <- true
+}
+
+// SetClosingMsg 设置服务器关闭(Shutdown)时广播给客户端的消息
+func (s *Server) SetClosingMsg(msgId uint32, data []byte) {
+	s.closingId = msgId
+	s.closingMsg = data
+}
+
+// Shutdown 优雅关闭服务器: 停止接收新会话、广播关闭消息、等待队列中的消息处理完成以及缓冲管道中的数据写出、
+// 停止全部链接并执行OnConnStop。全部完成后返回，ctx超时/取消后不再等待并返回ctx的错误
+func (s *Server) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&s.closing, 0, 1) {
+		return errors.New("server is closing")
+	}
+	defer gnet.MetricsMgr.UnregisterConnMgr(s.metricsId)
+
+	// 广播服务器关闭消息
+	if s.closingId > 0 {
+		s.connMgr.BroadcastMsg(s.closingId, s.closingMsg)
+	}
+
+	err := gnet.DrainConns(ctx, s.connMgr, s.msgHandler)
+
+	// 监听器关闭时会关闭全部会话，需在链接排空后关闭
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+
+	//关闭worker工作池
+	s.msgHandler.StopWorkerPool()
+
+	s.exit <- true
+	return err
+}
+
+// Run 运行服务器
+func (s *Server) Run() {
+	s.Start()
+	// 阻塞,否则主Go退出， listener的go将会退出
+	select {
+	case exit := <-s.exit:
+		if exit {
+			return
+		}
+	}
+}
+
+func (s *Server) GetRouter() *gnet.Router {
+	return s.router
+}
+
+// GetConnMgr 获取链接管理器
+func (s *Server) GetConnMgr() *gnet.ConnManager {
+	return s.connMgr
+}
+
+// GetDataPack 获取封包格式
+func (s *Server) GetDataPack() gnet.IDataPack {
+	return s.dataPack
+}
+
+// SetDataPack 设置封包格式，新建链接将使用该格式
+func (s *Server) SetDataPack(dataPack gnet.IDataPack) {
+	s.dataPack = dataPack
+}
+
+// SetRateLimiter 设置链接限流器(nil表示不限流)
+func (s *Server) SetRateLimiter(limiter *gnet.RateLimiter) {
+	s.msgHandler.SetLimiter(limiter)
+}
+
+// SetOverflow 设置Worker队列溢出处理策略
+func (s *Server) SetOverflow(option gnet.OverflowOption) {
+	s.msgHandler.SetOverflow(option)
+}
+
+// SetOnQueueEvent 设置Worker队列高水位/溢出事件Hook函数
+func (s *Server) SetOnQueueEvent(onQueueEvent gnet.QueueEventFunc) {
+	s.msgHandler.SetOnQueueEvent(onQueueEvent)
+}
+
+// SetDispatchKey 设置消息分发Key函数，Key相同的消息由同一个Worker按顺序处理(需在Start之前设置)
+func (s *Server) SetDispatchKey(dispatchKey gnet.DispatchKeyFunc) {
+	s.msgHandler.SetDispatchKey(dispatchKey)
+}
+
+// SetWorldMsgIds 设置由单独的world worker串行处理的消息ID(需在Start之前设置)
+func (s *Server) SetWorldMsgIds(msgIds ...uint32) {
+	s.msgHandler.SetWorldMsgIds(msgIds...)
+}
+
+// SetOnConnStart 设置服务器有新的链接Hook函数
+func (s *Server) SetOnConnStart(connCallback gnet.ConnCallback) {
+	s.onConnStart = connCallback
+}
+
+// SetOnConnStop 设置服务器有链接断开Hook函数
+func (s *Server) SetOnConnStop(connCallback gnet.ConnCallback) {
+	s.onConnStop = connCallback
+}
+
+// CallOnConnStart 调用连接OnConnStart Hook函数
+func (s *Server) CallOnConnStart(conn gnet.IConnection) {
+	if s.onConnStart != nil {
+		s.onConnStart(conn)
+	}
+}
+
+// CallOnConnStop 调用连接OnConnStop Hook函数
+func (s *Server) CallOnConnStop(conn gnet.IConnection) {
+	if s.onConnStop != nil {
+		s.onConnStop(conn)
+	}
+}
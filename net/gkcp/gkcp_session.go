@@ -0,0 +1,376 @@
+package gkcp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSessionTimeout = errors.New("kcp session timeout")
+	ErrDeadLink       = errors.New("kcp session dead link")
+)
+
+// 会话内部时钟起点
+var startTime = time.Now()
+
+func currentMs() uint32 {
+	return uint32(time.Since(startTime) / time.Millisecond)
+}
+
+// timeoutError 读写超时错误，实现 net.Error 接口
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// Options KCP会话参数
+type Options struct {
+	NoDelay      bool          // 是否开启nodelay模式(更小的最小RTO，更激进的超时重传)
+	Interval     uint32        // 内部flush间隔(毫秒)
+	Resend       int           // 快速重传阈值(分片被跳过确认的次数，0表示关闭)
+	NoCongestion bool          // 是否关闭拥塞控制
+	SndWnd       uint32        // 发送窗口(分片数)
+	RcvWnd       uint32        // 接收窗口(分片数)
+	Mtu          int           // 最大传输单元
+	HeartBeat    time.Duration // 心跳间隔，超过该时长未发送数据则发送心跳(0表示不发送)
+	Timeout      time.Duration // 会话超时，超过该时长未收到任何数据则关闭会话(0表示不检测)
+}
+
+// DefaultOptions 默认会话参数(普通模式)
+func DefaultOptions() Options {
+	return Options{
+		Interval:  defaultInterval,
+		SndWnd:    defaultSndWnd,
+		RcvWnd:    defaultRcvWnd,
+		Mtu:       defaultMtu,
+		HeartBeat: 10 * time.Second,
+		Timeout:   30 * time.Second,
+	}
+}
+
+// FastOptions 极速模式会话参数(nodelay、10ms间隔、2次快速重传、关闭拥塞控制)
+func FastOptions() Options {
+	options := DefaultOptions()
+	options.NoDelay = true
+	options.Interval = 10
+	options.Resend = 2
+	options.NoCongestion = true
+	return options
+}
+
+// Session KCP会话，以会话ID(conv)区分，实现 net.Conn 接口(流模式)
+type Session struct {
+	conv          uint32
+	kcp           *kcp
+	mu            sync.Mutex
+	conn          net.PacketConn // UDP套接字
+	remote        net.Addr       // 对端地址(服务端会话会随对端地址变化而更新)
+	listener      *Listener      // 所属监听器，客户端会话为nil
+	options       Options
+	lastRecv      time.Time // 最后一次收到数据时间
+	lastSend      time.Time // 最后一次发送数据时间
+	readDeadline  time.Time
+	writeDeadline time.Time
+	closeErr      error
+	chRead        chan struct{}
+	chWrite       chan struct{}
+	die           chan struct{}
+	closeOnce     sync.Once
+}
+
+func newSession(conv uint32, conn net.PacketConn, remote net.Addr, listener *Listener, options Options) *Session {
+	s := &Session{
+		conv:     conv,
+		conn:     conn,
+		remote:   remote,
+		listener: listener,
+		options:  options,
+		lastRecv: time.Now(),
+		lastSend: time.Now(),
+		chRead:   make(chan struct{}, 1),
+		chWrite:  make(chan struct{}, 1),
+		die:      make(chan struct{}),
+	}
+	s.kcp = newKcp(conv, s.output)
+	s.kcp.setNoDelay(options.NoDelay, options.Interval, options.Resend, options.NoCongestion)
+	s.kcp.setWndSize(options.SndWnd, options.RcvWnd)
+	s.kcp.setMtu(options.Mtu)
+
+	go s.updateLoop()
+	return s
+}
+
+// Dial 创建客户端会话，会话ID随机生成
+func Dial(addr string, options Options) (*Session, error) {
+	remote, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewSession(randConv(), conn, remote, options), nil
+}
+
+// NewSession 在指定UDP套接字上创建客户端会话，会话关闭时会同时关闭该套接字
+func NewSession(conv uint32, conn net.PacketConn, remote net.Addr, options Options) *Session {
+	s := newSession(conv, conn, remote, nil, options)
+	go s.readLoop()
+	return s
+}
+
+func randConv() uint32 {
+	var b [4]byte
+	for {
+		_, _ = rand.Read(b[:])
+		if conv := binary.LittleEndian.Uint32(b[:]); conv != 0 {
+			return conv
+		}
+	}
+}
+
+// GetConv 获取会话ID
+func (s *Session) GetConv() uint32 {
+	return s.conv
+}
+
+// Read 读取按序到达的数据
+func (s *Session) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	for {
+		s.mu.Lock()
+		if n := s.kcp.recv(b); n > 0 {
+			if s.kcp.probeWins {
+				s.kcp.flush()
+			}
+			s.mu.Unlock()
+			return n, nil
+		}
+		deadline := s.readDeadline
+		s.mu.Unlock()
+
+		if err := s.wait(s.chRead, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write 写入待发送数据，发送缓冲区已满时阻塞等待
+func (s *Session) Write(b []byte) (int, error) {
+	for {
+		select {
+		case <-s.die:
+			return 0, s.closeErr
+		default:
+		}
+
+		s.mu.Lock()
+		if s.kcp.waitSnd() < int(s.kcp.sndWnd)*2 {
+			s.kcp.current = currentMs()
+			s.kcp.send(b)
+			s.kcp.flush()
+			s.mu.Unlock()
+			return len(b), nil
+		}
+		deadline := s.writeDeadline
+		s.mu.Unlock()
+
+		if err := s.wait(s.chWrite, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (s *Session) wait(ch chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return timeoutError{}
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-s.die:
+		return s.closeErr
+	case <-timeout:
+		return timeoutError{}
+	}
+}
+
+// Close 关闭会话，并通知对端
+func (s *Session) Close() error {
+	s.closeWithErr(io.EOF, true)
+	return nil
+}
+
+func (s *Session) closeWithErr(err error, notify bool) {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closeErr = err
+		if notify {
+			s.output(s.kcp.encodeCmd(cmdClose))
+		}
+		s.mu.Unlock()
+
+		close(s.die)
+		if s.listener != nil {
+			s.listener.remove(s.conv)
+		} else {
+			_ = s.conn.Close()
+		}
+	})
+}
+
+// IsClosed 会话是否已关闭
+func (s *Session) IsClosed() bool {
+	select {
+	case <-s.die:
+		return true
+	default:
+		return false
+	}
+}
+
+// LocalAddr 本地地址
+func (s *Session) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// RemoteAddr 对端地址
+func (s *Session) RemoteAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remote
+}
+
+// SetDeadline 设置读写超时时间
+func (s *Session) SetDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readDeadline = t
+	s.writeDeadline = t
+	return nil
+}
+
+// SetReadDeadline 设置读超时时间
+func (s *Session) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline 设置写超时时间
+func (s *Session) SetWriteDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeDeadline = t
+	return nil
+}
+
+// output 输出UDP数据(调用方需持有锁)
+func (s *Session) output(buf []byte) {
+	s.lastSend = time.Now()
+	_, _ = s.conn.WriteTo(buf, s.remote)
+}
+
+// input 处理收到的UDP数据
+func (s *Session) input(data []byte, addr net.Addr) {
+	s.mu.Lock()
+	s.kcp.current = currentMs()
+	closed, err := s.kcp.input(data)
+	// 只有携带合法分片的数据才刷新活跃时间和对端地址，防止伪造的数据报劫持会话或维持已失效的会话
+	if err == nil && len(data) >= segmentOverhead {
+		s.lastRecv = time.Now()
+		// 对端地址变化(如移动网络切换)，以会话ID为准更新地址
+		if addr != nil && addr.String() != s.remote.String() {
+			s.remote = addr
+		}
+	}
+	readable := s.kcp.peekSize() > 0
+	writable := s.kcp.waitSnd() < int(s.kcp.sndWnd)*2
+	s.mu.Unlock()
+
+	if err != nil {
+		return
+	}
+	if readable {
+		notify(s.chRead)
+	}
+	if writable {
+		notify(s.chWrite)
+	}
+	if closed {
+		s.closeWithErr(io.EOF, false)
+	}
+}
+
+// updateLoop 定时驱动kcp，检测心跳和超时
+func (s *Session) updateLoop() {
+	ticker := time.NewTicker(time.Duration(s.kcp.interval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.die:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.kcp.update(currentMs())
+			if s.options.HeartBeat > 0 && time.Since(s.lastSend) >= s.options.HeartBeat {
+				s.output(s.kcp.encodeCmd(cmdPing))
+			}
+			deadLink := s.kcp.deadLink
+			timeout := s.options.Timeout > 0 && time.Since(s.lastRecv) > s.options.Timeout
+			writable := s.kcp.waitSnd() < int(s.kcp.sndWnd)*2
+			s.mu.Unlock()
+
+			if writable {
+				notify(s.chWrite)
+			}
+			if deadLink {
+				s.closeWithErr(ErrDeadLink, true)
+			} else if timeout {
+				s.closeWithErr(ErrSessionTimeout, true)
+			}
+		}
+	}
+}
+
+// readLoop 客户端会话读取UDP数据
+func (s *Session) readLoop() {
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			s.closeWithErr(err, false)
+			return
+		}
+		if n < segmentOverhead || binary.LittleEndian.Uint32(buf) != s.conv {
+			continue
+		}
+		s.input(buf[:n], addr)
+	}
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,91 @@
+package gkcp
+
+import (
+	"context"
+	"github.com/Ravior/gserver/net/gnet"
+	"github.com/Ravior/gserver/util/gconfig"
+	"github.com/gogo/protobuf/types"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_Server_Call(t *testing.T) {
+	// 获取一个空闲UDP端口
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	_ = conn.Close()
+
+	gconfig.Global.KcpServer.IP = "127.0.0.1"
+	gconfig.Global.KcpServer.Port = int32(port)
+	gconfig.Global.KcpServer.MaxMsgChanLen = 16
+
+	dataPack := gnet.NewDataPack()
+	dataPack.SetSeqEnabled(true)
+
+	server := NewServer()
+	server.SetOptions(FastOptions())
+	server.SetDataPack(dataPack)
+	server.GetRouter().Group("kcp").AddRoute("echo", func(req *gnet.Request, msg *types.StringValue) {
+		_ = req.Reply(&types.StringValue{Value: msg.Value + "-reply"})
+	})
+	server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	client := NewClient("1", "kcp-client", "127.0.0.1", int32(port))
+	client.SetOptions(FastOptions())
+	client.SetDataPack(dataPack)
+	client.Run()
+	defer client.Stop()
+
+	msgId := gnet.RouteItemMgr.GetMsgId("google.protobuf.StringValue")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp := &types.StringValue{}
+	if err := client.Call(ctx, msgId, &types.StringValue{Value: "gserver"}, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Value != "gserver-reply" {
+		t.Fatal(resp.Value)
+	}
+	if server.GetConnMgr().Len() != 1 {
+		t.Fatal("server conn num mismatch")
+	}
+}
+
+func Test_Connection_StopBeforeStart(t *testing.T) {
+	gconfig.Global.KcpServer.MaxMsgChanLen = 16
+	server := NewServer()
+
+	remote, _ := net.ResolveUDPAddr("udp", "127.0.0.1:9")
+	session := NewSession(2001, newLossyConn(t, 0), remote, FastOptions())
+	conn := NewConnection(server, session, 1, server.msgHandler, 16)
+
+	// 未Start的链接可以发送(进入缓冲管道)和停止
+	if err := conn.SendMsg(1, []byte("gserver")); err != nil {
+		t.Fatal(err)
+	}
+	server.GetConnMgr().ClearConn()
+	if !conn.IsClosed() || server.GetConnMgr().Len() != 0 {
+		t.Fatal("connection not stopped")
+	}
+}
+
+func Test_Server_ListenError(t *testing.T) {
+	// 端口已被占用时返回错误
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	server := NewServer()
+	server.ip, server.port = "127.0.0.1", int32(pc.LocalAddr().(*net.UDPAddr).Port)
+	if err := server.Listen(); err == nil {
+		t.Fatal("listen error ignored")
+	}
+}
@@ -0,0 +1,189 @@
+package gkcp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lossyConn 模拟丢包的UDP套接字
+type lossyConn struct {
+	net.PacketConn
+	mu   sync.Mutex
+	rand *rand.Rand
+	loss float64
+}
+
+func newLossyConn(t *testing.T, loss float64) *lossyConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &lossyConn{PacketConn: conn, rand: rand.New(rand.NewSource(1)), loss: loss}
+}
+
+func (c *lossyConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	drop := c.rand.Float64() < c.loss
+	c.mu.Unlock()
+	if drop {
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func Test_Session_Loopback(t *testing.T) {
+	options := FastOptions()
+	options.SndWnd = 32
+	options.RcvWnd = 32
+
+	serverConn := newLossyConn(t, 0.2)
+	listener := ServeConn(serverConn, options)
+	defer listener.Close()
+	defer serverConn.Close()
+
+	client := NewSession(1001, newLossyConn(t, 0.2), listener.Addr(), options)
+	defer client.Close()
+
+	const count = 500
+	go func() {
+		for i := 0; i < count; i++ {
+			if _, err := fmt.Fprintf(client, "gserver-%d\n", i); err != nil {
+				return
+			}
+		}
+	}()
+
+	session, err := listener.AcceptSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.GetConv() != 1001 {
+		t.Fatal("conv mismatch")
+	}
+	_ = session.SetReadDeadline(time.Now().Add(20 * time.Second))
+
+	reader := bufio.NewReader(session)
+	for i := 0; i < count; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		if line != fmt.Sprintf("gserver-%d\n", i) {
+			t.Fatalf("unexpected line %d: %s", i, line)
+		}
+	}
+}
+
+func Test_Session_Timeout(t *testing.T) {
+	options := FastOptions()
+	options.HeartBeat = 0
+	options.Timeout = 200 * time.Millisecond
+
+	// 对端不存在，会话在超时后关闭
+	remote, _ := net.ResolveUDPAddr("udp", "127.0.0.1:9")
+	client := NewSession(1002, newLossyConn(t, 0), remote, options)
+	_, _ = client.Write([]byte("gserver"))
+
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.Read(make([]byte, 16)); err != ErrSessionTimeout {
+		t.Fatal(err)
+	}
+}
+
+func Test_Session_HeartBeat(t *testing.T) {
+	options := FastOptions()
+	options.HeartBeat = 50 * time.Millisecond
+	options.Timeout = 300 * time.Millisecond
+
+	listener, err := Listen("127.0.0.1:0", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := Dial(listener.Addr().String(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	_, _ = client.Write([]byte("gserver"))
+
+	session, err := listener.AcceptSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 空闲期间依靠心跳保持会话
+	time.Sleep(time.Second)
+	if client.IsClosed() || session.IsClosed() {
+		t.Fatal("session closed while heartbeat enabled")
+	}
+
+	// 客户端关闭后，服务端会话收到关闭通知
+	_ = client.Close()
+	_ = session.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 16)
+	for {
+		if _, err := session.Read(buf); err != nil {
+			break
+		}
+	}
+	if !session.IsClosed() {
+		t.Fatal("session not closed")
+	}
+}
+
+func Test_Session_SpoofedInput(t *testing.T) {
+	options := FastOptions()
+	listener, err := Listen("127.0.0.1:0", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := Dial(listener.Addr().String(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	_, _ = client.Write([]byte("gserver"))
+
+	session, err := listener.AcceptSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := session.RemoteAddr().String()
+
+	// 从另一个地址发送会话ID相同的非法数据
+	attacker, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer attacker.Close()
+	garbage := make([]byte, segmentOverhead+8)
+	binary.LittleEndian.PutUint32(garbage, session.GetConv())
+	garbage[4] = 0xFF
+	for i := 0; i < 10; i++ {
+		_, _ = attacker.WriteTo(garbage, listener.Addr())
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if session.RemoteAddr().String() != remote {
+		t.Fatal("remote addr changed by garbage", session.RemoteAddr())
+	}
+	// 会话仍然可以与原客户端通信
+	if _, err := session.Write([]byte("reply")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := client.Read(buf); err != nil || string(buf[:n]) != "reply" {
+		t.Fatal(err, string(buf[:n]))
+	}
+}
@@ -1,8 +1,10 @@
 package gnet
 
 import (
+	"context"
 	"github.com/gorilla/websocket"
 	"net"
+	"time"
 )
 
 // ProtocolType 协议类型
@@ -14,25 +16,38 @@ type ConnCallback func(conn IConnection)
 // HeartBeatTime 心跳时长 单位:秒
 const HeartBeatTime = 300
 
+// waitCheckInterval 等待条件满足的检测间隔
+var waitCheckInterval = 10 * time.Millisecond
+
 const (
 	Tcp = iota
 	WebSocket
 	Http
+	Kcp
 )
 
 // IConnection 定义连接接口
 type IConnection interface {
-	Start()                                  // 启动连接，让当前连接开始工作
-	Stop()                                   // 停止连接，结束当前连接状态
-	GetTcpConnection() *net.TCPConn          // 从当前连接获取原始的socket TCPConn
-	GetWsConnection() *websocket.Conn        // 从当前连接获取原始的websocket conn
-	GetProtocolType() ProtocolType           // 获取链接协议类型, TCP/WebSocket
-	GetSocket() ISocket                      // 获取链接的Socket对象
-	GetConnID() uint32                       // 获取当前连接ID
-	IsClosed() bool                          // 当前链接是否已关闭
-	SetClosed() bool                         // 设置关闭状态，设置成功返回true,已关闭则返回false
-	RemoteAddr() net.Addr                    // 获取远程客户端地址信息
-	SendMsg(msgId uint32, data []byte) error // 发送消息
+	Start()                                                   // 启动连接，让当前连接开始工作
+	Stop()                                                    // 停止连接，结束当前连接状态
+	GetTcpConnection() *net.TCPConn                           // 从当前连接获取原始的socket TCPConn(非TCP链接返回nil)
+	GetNetConnection() net.Conn                               // 从当前连接获取原始的网络链接(TCP、TLS、Unix socket等)
+	GetWsConnection() *websocket.Conn                         // 从当前连接获取原始的websocket conn
+	GetProtocolType() ProtocolType                            // 获取链接协议类型, TCP/WebSocket/KCP
+	GetSocket() ISocket                                       // 获取链接的Socket对象
+	GetConnID() uint32                                        // 获取当前连接ID
+	IsClosed() bool                                           // 当前链接是否已关闭
+	SetClosed() bool                                          // 设置关闭状态，设置成功返回true,已关闭则返回false
+	RemoteAddr() net.Addr                                     // 获取远程客户端地址信息
+	SendMsg(msgId uint32, data []byte) error                  // 发送消息
+	SendSeqMsg(msgId uint32, seqId uint32, data []byte) error // 发送携带请求序列号的消息
+	SendPackedMsg(data []byte) error                          // 发送已按链接封包格式封包好的数据
+	Flush(ctx context.Context) error                          // 等待缓冲管道中的数据全部写出(链接关闭或ctx超时返回)
+	GetDataPack() IDataPack                                   // 获取链接的封包格式
+	SetDataPack(dataPack IDataPack)                           // 设置链接的封包格式(需在Start之前设置)
+	SetProperty(key string, value interface{})                // 设置链接属性
+	GetProperty(key string) (interface{}, bool)               // 获取链接属性
+	RemoveProperty(key string)                                // 删除链接属性
 }
 
 // ISocket Socket抽象接口，可以是Sever端/Client端
@@ -46,8 +61,31 @@ type ISocket interface {
 	Run()                                      // 运行
 	GetRouter() *Router                        // 获取消息路由器
 	GetConnMgr() *ConnManager                  // 获取链接管理器(Client的ConnMgr只会有一个Conn)
+	GetDataPack() IDataPack                    // 获取封包格式(新建链接默认使用该格式)
+	SetDataPack(dataPack IDataPack)            // 设置封包格式
 	SetOnConnStart(startCallBack ConnCallback) // 设置有新的链接Hook函数
 	SetOnConnStop(stopCallback ConnCallback)   // 设置有链接断开Hook函数
 	CallOnConnStart(conn IConnection)          // 调用链接OnConnStart Hook函数
 	CallOnConnStop(conn IConnection)           // 调用链接OnConnStop Hook函数
 }
+
+// WaitUntil 阻塞等待直到cond返回true或者ctx超时/取消
+func WaitUntil(ctx context.Context, cond func() bool) error {
+	if cond() {
+		return nil
+	}
+
+	ticker := time.NewTicker(waitCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if cond() {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package gnet
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Ravior/gserver/os/glog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrServerFull = errors.New("server is full")
+	ErrIpLimit    = errors.New("too many connections from the same ip")
+	ErrIpDenied   = errors.New("ip is not allowed")
+)
+
+// AdmissionPolicy 链接准入策略: 最大连接数、单IP最大连接数、CIDR白名单/黑名单，均可在运行时修改
+type AdmissionPolicy struct {
+	lock         sync.RWMutex
+	maxConn      int32        // 最大连接数(0表示不限制)
+	maxConnPerIp int32        // 单IP最大连接数(0表示不限制)
+	allow        []*net.IPNet // 白名单(为空表示不限制)
+	deny         []*net.IPNet // 黑名单，优先于白名单
+	connLock     sync.Mutex
+	connNum      int32            // 已准入的连接数
+	ipConns      map[string]int32 // IP => 当前连接数
+}
+
+// NewAdmissionPolicy 创建链接准入策略
+func NewAdmissionPolicy() *AdmissionPolicy {
+	return &AdmissionPolicy{
+		ipConns: make(map[string]int32),
+	}
+}
+
+// SetMaxConn 设置最大连接数(0表示不限制)
+func (p *AdmissionPolicy) SetMaxConn(maxConn int32) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.maxConn = maxConn
+}
+
+// SetMaxConnPerIp 设置单IP最大连接数(0表示不限制)
+func (p *AdmissionPolicy) SetMaxConnPerIp(maxConnPerIp int32) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.maxConnPerIp = maxConnPerIp
+}
+
+// SetCIDRs 设置CIDR白名单和黑名单(如 10.0.0.0/8、192.168.1.1)，全部解析成功后才会替换，可在运行时重新加载
+func (p *AdmissionPolicy) SetCIDRs(allow []string, deny []string) error {
+	allowNets, err := parseCIDRs(allow)
+	if err != nil {
+		return err
+	}
+	denyNets, err := parseCIDRs(deny)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.allow, p.deny = allowNets, denyNets
+	return nil
+}
+
+// parseCIDRs 解析CIDR列表，单个IP视为/32(IPv6为/128)
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, errors.New(fmt.Sprintf("invalid ip: %s", cidr))
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func containsIp(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Admit 判断是否允许新链接接入，允许时占用一个连接名额(判断与占用是原子的，链接断开后需调用Release)
+// ip为nil(如Unix socket链接)时只判断最大连接数
+func (p *AdmissionPolicy) Admit(ip net.IP) error {
+	p.lock.RLock()
+	maxConn, maxConnPerIp := p.maxConn, p.maxConnPerIp
+	denied := ip != nil && (containsIp(p.deny, ip) || (len(p.allow) > 0 && !containsIp(p.allow, ip)))
+	p.lock.RUnlock()
+
+	if denied {
+		return ErrIpDenied
+	}
+
+	p.connLock.Lock()
+	defer p.connLock.Unlock()
+
+	if maxConn > 0 && p.connNum >= maxConn {
+		return ErrServerFull
+	}
+	if ip != nil {
+		key := ip.String()
+		if maxConnPerIp > 0 && p.ipConns[key] >= maxConnPerIp {
+			return ErrIpLimit
+		}
+		p.ipConns[key]++
+	}
+	p.connNum++
+	return nil
+}
+
+// Release 链接断开，释放Admit占用的连接名额
+func (p *AdmissionPolicy) Release(ip net.IP) {
+	p.connLock.Lock()
+	defer p.connLock.Unlock()
+
+	if p.connNum > 0 {
+		p.connNum--
+	}
+	if ip == nil {
+		return
+	}
+	key := ip.String()
+	if p.ipConns[key] <= 1 {
+		delete(p.ipConns, key)
+		return
+	}
+	p.ipConns[key]--
+}
+
+// GetConnNum 获取已准入的连接数
+func (p *AdmissionPolicy) GetConnNum() int32 {
+	p.connLock.Lock()
+	defer p.connLock.Unlock()
+	return p.connNum
+}
+
+// GetIpConnNum 获取IP的当前连接数
+func (p *AdmissionPolicy) GetIpConnNum(ip net.IP) int32 {
+	p.connLock.Lock()
+	defer p.connLock.Unlock()
+	return p.ipConns[ip.String()]
+}
+
+// AddrIp 获取链接地址的IP
+func AddrIp(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	case nil:
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return net.ParseIP(addr.String())
+	}
+	return net.ParseIP(host)
+}
+
+// WatchAuth 链接在timeout内未绑定用户(未登录)时断开链接，返回的定时器可用于提前取消
+func WatchAuth(connMgr *ConnManager, conn IConnection, timeout time.Duration) *time.Timer {
+	return time.AfterFunc(timeout, func() {
+		if conn.IsClosed() {
+			return
+		}
+		if _, ok := connMgr.GetUid(conn); !ok {
+			glog.Warnf("链接登录超时, ConnId:%d, Addr:%s", conn.GetConnID(), conn.RemoteAddr())
+			conn.Stop()
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package gnet
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	minBufferClassBits = 8  // 最小缓冲池规格 256字节
+	maxBufferClassBits = 16 // 最大缓冲池规格 64K字节，超出时直接分配
+)
+
+// bufferPools 按2的幂次划分规格的缓冲池
+var bufferPools [maxBufferClassBits - minBufferClassBits + 1]sync.Pool
+
+func init() {
+	for i := range bufferPools {
+		size := 1 << (minBufferClassBits + i)
+		bufferPools[i].New = func() interface{} {
+			b := make([]byte, size)
+			return &b
+		}
+	}
+}
+
+// bufferClass 获取能容纳size字节的最小缓冲池规格，超出最大规格时返回-1
+func bufferClass(size int) int {
+	if size <= 1<<minBufferClassBits {
+		return 0
+	}
+	class := bits.Len(uint(size-1)) - minBufferClassBits
+	if class >= len(bufferPools) {
+		return -1
+	}
+	return class
+}
+
+// Buffer 字节缓冲，来自缓冲池时使用完毕后需调用Release放回缓冲池(放回后不能再使用B)
+type Buffer struct {
+	B   []byte
+	ptr *[]byte // 缓冲池中的切片(为nil表示不是来自缓冲池)
+}
+
+// GetBuffer 从缓冲池中获取长度为size的字节缓冲
+func GetBuffer(size int) Buffer {
+	class := bufferClass(size)
+	if class < 0 {
+		return Buffer{B: make([]byte, size)}
+	}
+	ptr := bufferPools[class].Get().(*[]byte)
+	return Buffer{B: (*ptr)[:size], ptr: ptr}
+}
+
+// NewBuffer 包装不来自缓冲池的数据(Release时不做任何操作)
+func NewBuffer(data []byte) Buffer {
+	return Buffer{B: data}
+}
+
+// Release 放回缓冲池
+func (b Buffer) Release() {
+	if b.ptr == nil {
+		return
+	}
+	if class := bufferClass(cap(*b.ptr)); class >= 0 {
+		bufferPools[class].Put(b.ptr)
+	}
+}
+
+// IBufferPacker 支持封包到缓冲池的封包格式实现该接口，减少频繁发送消息时的内存分配
+type IBufferPacker interface {
+	PackBuffer(msg *Msg) (Buffer, error)
+}
+
+// PackBuffer 按封包格式封包，封包格式支持时封包到缓冲池，写出后需调用Buffer.Release
+func PackBuffer(dp IDataPack, msg *Msg) (Buffer, error) {
+	if bp, ok := dp.(IBufferPacker); ok {
+		return bp.PackBuffer(msg)
+	}
+	data, err := dp.Pack(msg)
+	if err != nil {
+		return Buffer{}, err
+	}
+	return NewBuffer(data), nil
+}
@@ -0,0 +1,104 @@
+package gnet
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/atomic"
+	"sync"
+)
+
+var (
+	ErrCallConnClosed = errors.New("call failed, connection has been closed")
+	ErrCallNoConn     = errors.New("call failed, connection not found")
+	ErrCallNoSeq      = errors.New("call failed, seq header of data pack is not enabled")
+)
+
+// CallMgr 请求/响应关联管理器，通过请求序列号将响应消息与发起的请求一一对应
+type CallMgr struct {
+	seq     atomic.Uint32 // 请求序列号
+	pending sync.Map      // 等待响应的请求 seqId => chan *Msg
+}
+
+// NewCallMgr 创建请求/响应关联管理器
+func NewCallMgr() *CallMgr {
+	return &CallMgr{}
+}
+
+// NextSeq 生成下一个请求序列号(跳过0, 0表示非请求/响应消息)
+func (m *CallMgr) NextSeq() uint32 {
+	seqId := m.seq.Inc()
+	if seqId == 0 {
+		seqId = m.seq.Inc()
+	}
+	return seqId
+}
+
+// Call 发送请求并阻塞等待对应的响应消息，直到响应到达或者ctx超时/取消
+func (m *CallMgr) Call(ctx context.Context, conn IConnection, msgId uint32, req proto.Message, resp proto.Message) error {
+	if conn == nil || conn.IsClosed() {
+		return ErrCallNoConn
+	}
+	if !IsSeqEnabled(conn.GetDataPack()) {
+		return ErrCallNoSeq
+	}
+
+	codec := GetCodec(conn)
+	data, err := codec.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	seqId := m.NextSeq()
+	replyChan := make(chan *Msg, 1)
+	m.pending.Store(seqId, replyChan)
+	defer m.pending.Delete(seqId)
+
+	if err := conn.SendSeqMsg(msgId, seqId, data); err != nil {
+		return err
+	}
+
+	select {
+	case msg, ok := <-replyChan:
+		if !ok || msg == nil {
+			return ErrCallConnClosed
+		}
+		// 对方返回标准错误消息
+		if msg.GetMsgId() == ErrorMsgId {
+			errMsg, err := decodeErrorMsg(codec, msg.GetData())
+			if err != nil {
+				return err
+			}
+			return errMsg
+		}
+		if resp == nil {
+			return nil
+		}
+		return codec.Unmarshal(msg.GetData(), resp)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dispatch 将收到的消息交给等待中的请求，若消息被消费则返回true
+func (m *CallMgr) Dispatch(msg *Msg) bool {
+	if msg == nil || msg.GetSeqId() == 0 {
+		return false
+	}
+	v, ok := m.pending.LoadAndDelete(msg.GetSeqId())
+	if !ok {
+		return false
+	}
+	v.(chan *Msg) <- msg
+	return true
+}
+
+// CancelAll 取消全部等待中的请求(链接断开时调用)
+func (m *CallMgr) CancelAll() {
+	m.pending.Range(func(k, v interface{}) bool {
+		if _, ok := m.pending.LoadAndDelete(k); ok {
+			close(v.(chan *Msg))
+		}
+		return true
+	})
+}
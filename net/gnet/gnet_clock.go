@@ -0,0 +1,37 @@
+package gnet
+
+import "time"
+
+// Clock 时钟接口，心跳等依赖时间的组件通过该接口获取时间，测试时可替换为可控时钟(见gnettest.FakeClock)
+type Clock interface {
+	Now() time.Time                 // 当前时间
+	NewTimer(d time.Duration) Timer // 创建定时器
+}
+
+// Timer 定时器接口
+type Timer interface {
+	C() <-chan time.Time        // 定时器到期通道
+	Stop() bool                 // 停止定时器
+	Reset(d time.Duration) bool // 重置定时器
+}
+
+// SystemClock 系统时钟
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return &systemTimer{Timer: time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t *systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
@@ -0,0 +1,84 @@
+package gnet
+
+import (
+	"github.com/Ravior/gserver/util/gserialize"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// codecPropertyKey 链接消息体编解码器保存在链接属性中
+const codecPropertyKey = "gnet.codec"
+
+// 编解码器名称(WebSocket握手时通过子协议 gserver.<name> 或者查询参数 codec=<name> 选择)
+const (
+	CodecProtobuf = "protobuf"
+	CodecJson     = "json"
+)
+
+// ICodec 消息体编解码器，同一个Handler可同时处理不同编码的消息
+type ICodec interface {
+	GetName() string                                // 编解码器名称
+	Marshal(msg proto.Message) ([]byte, error)      // 编码
+	Unmarshal(data []byte, msg proto.Message) error // 解码
+}
+
+var (
+	ProtobufCodec ICodec = protobufCodec{} // Protobuf编解码器(默认)
+	JsonCodec     ICodec = jsonCodec{}     // ProtoJSON编解码器，适用于浏览器、GM工具
+)
+
+// protobufCodec Protobuf编解码器
+type protobufCodec struct{}
+
+func (protobufCodec) GetName() string {
+	return CodecProtobuf
+}
+
+func (protobufCodec) Marshal(msg proto.Message) ([]byte, error) {
+	return gserialize.Protobuf.Marshal(msg)
+}
+
+func (protobufCodec) Unmarshal(data []byte, msg proto.Message) error {
+	return gserialize.Protobuf.Unmarshal(data, msg)
+}
+
+// jsonCodec ProtoJSON编解码器(字段名使用lowerCamelCase，解码时忽略未知字段)
+type jsonCodec struct{}
+
+func (jsonCodec) GetName() string {
+	return CodecJson
+}
+
+func (jsonCodec) Marshal(msg proto.Message) ([]byte, error) {
+	return protojson.Marshal(proto.MessageV2(msg))
+}
+
+func (jsonCodec) Unmarshal(data []byte, msg proto.Message) error {
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, proto.MessageV2(msg))
+}
+
+// GetCodecByName 根据名称获取编解码器
+func GetCodecByName(name string) (ICodec, bool) {
+	switch name {
+	case CodecProtobuf:
+		return ProtobufCodec, true
+	case CodecJson:
+		return JsonCodec, true
+	}
+	return nil, false
+}
+
+// SetCodec 设置链接的消息体编解码器，请求解码与响应编码均使用该编解码器
+func SetCodec(conn IConnection, codec ICodec) {
+	conn.SetProperty(codecPropertyKey, codec)
+}
+
+// GetCodec 获取链接的消息体编解码器，未设置时使用Protobuf
+func GetCodec(conn IConnection) ICodec {
+	if conn != nil {
+		if v, ok := conn.GetProperty(codecPropertyKey); ok {
+			return v.(ICodec)
+		}
+	}
+	return ProtobufCodec
+}
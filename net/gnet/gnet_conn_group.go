@@ -0,0 +1,190 @@
+package gnet
+
+import (
+	"errors"
+	"github.com/Ravior/gserver/os/glog"
+)
+
+var (
+	ErrGroupInvalid = errors.New("group name is invalid")
+)
+
+// JoinGroup 链接加入分组(公会聊天、战斗房间、地图频道等)，链接断开时自动退出全部分组
+func (c *ConnManager) JoinGroup(group string, conn IConnection) error {
+	if group == "" {
+		return ErrGroupInvalid
+	}
+	if conn == nil {
+		return ErrConnNotFound
+	}
+
+	c.groupLock.Lock()
+	defer c.groupLock.Unlock()
+
+	// 在锁内判断关闭状态，保证已关闭的链接不会残留在分组中
+	if conn.IsClosed() {
+		return ErrConnNotFound
+	}
+
+	members, ok := c.groups[group]
+	if !ok {
+		members = make(map[uint32]IConnection)
+		c.groups[group] = members
+	}
+	members[conn.GetConnID()] = conn
+
+	groups, ok := c.connGroups[conn.GetConnID()]
+	if !ok {
+		groups = make(map[string]struct{})
+		c.connGroups[conn.GetConnID()] = groups
+	}
+	groups[group] = struct{}{}
+	return nil
+}
+
+// LeaveGroup 链接退出分组
+func (c *ConnManager) LeaveGroup(group string, conn IConnection) {
+	c.groupLock.Lock()
+	defer c.groupLock.Unlock()
+
+	c.leaveGroup(group, conn.GetConnID())
+}
+
+// LeaveAllGroups 链接退出全部分组
+func (c *ConnManager) LeaveAllGroups(conn IConnection) {
+	c.groupLock.Lock()
+	defer c.groupLock.Unlock()
+
+	for group := range c.connGroups[conn.GetConnID()] {
+		c.leaveGroup(group, conn.GetConnID())
+	}
+}
+
+// leaveGroup 退出分组，分组为空时删除分组(调用方需持有锁)
+func (c *ConnManager) leaveGroup(group string, connID uint32) {
+	if members, ok := c.groups[group]; ok {
+		delete(members, connID)
+		if len(members) == 0 {
+			delete(c.groups, group)
+		}
+	}
+	if groups, ok := c.connGroups[connID]; ok {
+		delete(groups, group)
+		if len(groups) == 0 {
+			delete(c.connGroups, connID)
+		}
+	}
+}
+
+// IsInGroup 链接是否在分组中
+func (c *ConnManager) IsInGroup(group string, connID uint32) bool {
+	c.groupLock.RLock()
+	defer c.groupLock.RUnlock()
+
+	_, ok := c.groups[group][connID]
+	return ok
+}
+
+// GetGroupConns 获取分组内全部链接
+func (c *ConnManager) GetGroupConns(group string) []IConnection {
+	c.groupLock.RLock()
+	defer c.groupLock.RUnlock()
+
+	conns := make([]IConnection, 0, len(c.groups[group]))
+	for _, conn := range c.groups[group] {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// GetConnGroups 获取链接加入的全部分组
+func (c *ConnManager) GetConnGroups(connID uint32) []string {
+	c.groupLock.RLock()
+	defer c.groupLock.RUnlock()
+
+	groups := make([]string, 0, len(c.connGroups[connID]))
+	for group := range c.connGroups[connID] {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// GroupLen 分组内链接数量
+func (c *ConnManager) GroupLen(group string) int {
+	c.groupLock.RLock()
+	defer c.groupLock.RUnlock()
+	return len(c.groups[group])
+}
+
+// GroupCount 当前分组数量
+func (c *ConnManager) GroupCount() int {
+	c.groupLock.RLock()
+	defer c.groupLock.RUnlock()
+	return len(c.groups)
+}
+
+// BroadcastToGroup 向分组内链接广播数据，exclude为不需要发送的链接ID
+func (c *ConnManager) BroadcastToGroup(group string, msgId uint32, data []byte, exclude ...uint32) {
+	if data == nil || msgId == 0 {
+		return
+	}
+
+	// 在锁外发送，防止发送失败关闭链接时回调Remove造成死锁
+	conns := c.GetGroupConns(group)
+	packer := newBroadcastPacker(msgId, data)
+	for _, conn := range conns {
+		if isExcluded(conn.GetConnID(), exclude) {
+			continue
+		}
+		packer.send(conn)
+	}
+}
+
+func isExcluded(connID uint32, exclude []uint32) bool {
+	for _, id := range exclude {
+		if id == connID {
+			return true
+		}
+	}
+	return false
+}
+
+// packedData 广播封包结果
+type packedData struct {
+	data []byte
+	err  error
+}
+
+// broadcastPacker 广播封包器，同一封包格式的链接只封包一次
+type broadcastPacker struct {
+	msg    *Msg
+	packed map[IDataPack]packedData
+}
+
+func newBroadcastPacker(msgId uint32, data []byte) *broadcastPacker {
+	return &broadcastPacker{
+		msg:    NewMsg(msgId, data),
+		packed: make(map[IDataPack]packedData),
+	}
+}
+
+// send 按链接的封包格式发送广播数据
+func (b *broadcastPacker) send(conn IConnection) {
+	dataPack := conn.GetDataPack()
+	if dataPack == nil {
+		_ = conn.SendMsg(b.msg.GetMsgId(), b.msg.GetData())
+		return
+	}
+
+	p, ok := b.packed[dataPack]
+	if !ok {
+		p.data, p.err = dataPack.Pack(b.msg)
+		if p.err != nil {
+			glog.Errorf("Broadcast pack message fail, msgId:%d, err:%s", b.msg.GetMsgId(), p.err.Error())
+		}
+		b.packed[dataPack] = p
+	}
+	if p.err == nil && conn.SendPackedMsg(p.data) == nil {
+		MetricsMgr.OnSend(b.msg.GetMsgId(), len(b.msg.GetData()))
+	}
+}
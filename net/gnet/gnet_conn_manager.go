@@ -1,20 +1,51 @@
 package gnet
 
 import (
+	"context"
 	"errors"
 	"go.uber.org/atomic"
 	"sync"
 )
 
+var (
+	ErrUidBound     = errors.New("uid has been bound by another connection")
+	ErrUidInvalid   = errors.New("uid is invalid")
+	ErrConnNotFound = errors.New("connection not found")
+)
+
+// DuplicatePolicy 重复登录处理策略
+type DuplicatePolicy uint8
+
+const (
+	KickOld   DuplicatePolicy = iota // 踢掉旧链接，绑定新链接
+	RejectNew                        // 保留旧链接，拒绝新链接绑定
+)
+
+// DuplicateLoginFunc 重复登录Hook函数，返回该次重复登录的处理策略
+type DuplicateLoginFunc func(uid uint64, oldConn IConnection, newConn IConnection) DuplicatePolicy
+
 // ConnManager 链接管理器
 type ConnManager struct {
-	connections sync.Map
-	connNum     atomic.Int32 // 当前连接数
+	connections    sync.Map
+	callbackWg     sync.WaitGroup                    // 执行中的链接回调
+	connNum        atomic.Int32                      // 当前连接数
+	bindLock       sync.RWMutex                      // 用户绑定锁
+	uidConns       map[uint64]IConnection            // 用户ID => 链接
+	connUids       map[uint32]uint64                 // 链接ID => 用户ID
+	duplicateLogin DuplicateLoginFunc                // 重复登录Hook函数
+	groupLock      sync.RWMutex                      // 分组锁
+	groups         map[string]map[uint32]IConnection // 分组名 => 链接ID => 链接
+	connGroups     map[uint32]map[string]struct{}    // 链接ID => 加入的分组
 }
 
 // NewConnManager 创建新的链接管理器
 func NewConnManager() *ConnManager {
-	return &ConnManager{}
+	return &ConnManager{
+		uidConns:   make(map[uint64]IConnection),
+		connUids:   make(map[uint32]uint64),
+		groups:     make(map[string]map[uint32]IConnection),
+		connGroups: make(map[uint32]map[string]struct{}),
+	}
 }
 
 // Add 添加链接
@@ -25,8 +56,9 @@ func (c *ConnManager) Add(conn IConnection) {
 	c.connNum.Inc()
 }
 
-// Remove 删除链接
+// Remove 删除链接(同时解除用户绑定、退出全部分组)
 func (c *ConnManager) Remove(conn IConnection) {
+	c.release(conn)
 	if _, ok := c.connections.Load(conn.GetConnID()); ok {
 		// 链接数-1
 		c.connNum.Dec()
@@ -39,7 +71,7 @@ func (c *ConnManager) Get(connID uint32) (IConnection, error) {
 	if _conn, ok := c.connections.Load(connID); ok {
 		return _conn.(IConnection), nil
 	} else {
-		return nil, errors.New("connection not found")
+		return nil, ErrConnNotFound
 	}
 }
 
@@ -51,6 +83,7 @@ func (c *ConnManager) ClearConn() {
 			c.connNum.Dec()
 		}
 		if conn, ok := v.(IConnection); ok {
+			c.release(conn)
 			conn.Stop()
 		}
 		return true
@@ -65,20 +98,168 @@ func (c *ConnManager) Len() int32 {
 func (c *ConnManager) ClearOneConn(connID uint32) {
 	conn, _ := c.Get(connID)
 	if conn != nil {
+		c.release(conn)
 		c.connNum.Dec()
 		conn.Stop()
 	}
 	c.connections.Delete(connID)
 }
 
+// Range 遍历全部链接，f返回false时停止遍历
+func (c *ConnManager) Range(f func(conn IConnection) bool) {
+	c.connections.Range(func(k interface{}, v interface{}) bool {
+		if conn, ok := v.(IConnection); ok {
+			return f(conn)
+		}
+		return true
+	})
+}
+
+// GoCallback 在新的Go协程中执行链接回调(防止回调出现死锁)，可通过WaitCallbacks等待执行完成
+func (c *ConnManager) GoCallback(conn IConnection, callback ConnCallback) {
+	c.callbackWg.Add(1)
+	go func() {
+		defer c.callbackWg.Done()
+		callback(conn)
+	}()
+}
+
+// WaitCallbacks 等待全部执行中的链接回调完成或者ctx超时/取消
+func (c *ConnManager) WaitCallbacks(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.callbackWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // BroadcastMsg 广播数据
 func (c *ConnManager) BroadcastMsg(msgId uint32, data []byte) {
 	if data != nil && msgId > 0 {
+		packer := newBroadcastPacker(msgId, data)
 		c.connections.Range(func(k interface{}, v interface{}) bool {
 			if conn, ok := v.(IConnection); ok {
-				conn.SendMsg(msgId, data)
+				packer.send(conn)
 			}
 			return true
 		})
 	}
 }
+
+// SetDuplicateLogin 设置重复登录Hook函数，未设置时默认踢掉旧链接(Hook函数内不能调用ConnManager的绑定相关方法)
+func (c *ConnManager) SetDuplicateLogin(duplicateLogin DuplicateLoginFunc) {
+	c.bindLock.Lock()
+	defer c.bindLock.Unlock()
+	c.duplicateLogin = duplicateLogin
+}
+
+// Bind 将用户ID与链接绑定，用户已绑定其他链接时按重复登录策略处理
+func (c *ConnManager) Bind(uid uint64, conn IConnection) error {
+	if uid == 0 {
+		return ErrUidInvalid
+	}
+	if conn == nil {
+		return ErrConnNotFound
+	}
+
+	c.bindLock.Lock()
+	// 在锁内判断关闭状态，链接关闭时先标记关闭再释放绑定，保证已关闭的链接不会残留绑定
+	if conn.IsClosed() {
+		c.bindLock.Unlock()
+		return ErrConnNotFound
+	}
+	oldConn, ok := c.uidConns[uid]
+	if ok && oldConn.GetConnID() == conn.GetConnID() {
+		c.bindLock.Unlock()
+		return nil
+	}
+	if ok {
+		policy := KickOld
+		if c.duplicateLogin != nil {
+			policy = c.duplicateLogin(uid, oldConn, conn)
+		}
+		if policy == RejectNew {
+			c.bindLock.Unlock()
+			return ErrUidBound
+		}
+		delete(c.connUids, oldConn.GetConnID())
+	} else {
+		oldConn = nil
+	}
+
+	// 链接之前绑定了其他用户ID，先解除
+	if oldUid, ok := c.connUids[conn.GetConnID()]; ok {
+		delete(c.uidConns, oldUid)
+	}
+	c.uidConns[uid] = conn
+	c.connUids[conn.GetConnID()] = uid
+	c.bindLock.Unlock()
+
+	// 在锁外停止旧链接，防止Stop内回调Remove造成死锁
+	if oldConn != nil {
+		oldConn.Stop()
+	}
+	return nil
+}
+
+// Unbind 解除用户ID的绑定
+func (c *ConnManager) Unbind(uid uint64) {
+	c.bindLock.Lock()
+	defer c.bindLock.Unlock()
+
+	if conn, ok := c.uidConns[uid]; ok {
+		delete(c.connUids, conn.GetConnID())
+		delete(c.uidConns, uid)
+	}
+}
+
+// GetByUid 根据用户ID获取链接
+func (c *ConnManager) GetByUid(uid uint64) (IConnection, error) {
+	c.bindLock.RLock()
+	defer c.bindLock.RUnlock()
+
+	if conn, ok := c.uidConns[uid]; ok {
+		return conn, nil
+	}
+	return nil, ErrConnNotFound
+}
+
+// GetUid 获取链接绑定的用户ID
+func (c *ConnManager) GetUid(conn IConnection) (uint64, bool) {
+	c.bindLock.RLock()
+	defer c.bindLock.RUnlock()
+
+	uid, ok := c.connUids[conn.GetConnID()]
+	return uid, ok
+}
+
+// BindLen 当前已绑定用户数量
+func (c *ConnManager) BindLen() int {
+	c.bindLock.RLock()
+	defer c.bindLock.RUnlock()
+	return len(c.uidConns)
+}
+
+// release 释放链接关联的数据(用户绑定、分组)
+func (c *ConnManager) release(conn IConnection) {
+	c.unbindConn(conn)
+	c.LeaveAllGroups(conn)
+}
+
+// unbindConn 解除链接的用户绑定
+func (c *ConnManager) unbindConn(conn IConnection) {
+	c.bindLock.Lock()
+	defer c.bindLock.Unlock()
+
+	if uid, ok := c.connUids[conn.GetConnID()]; ok {
+		delete(c.uidConns, uid)
+		delete(c.connUids, conn.GetConnID())
+	}
+}
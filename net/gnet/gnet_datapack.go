@@ -0,0 +1,222 @@
+package gnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+//|------------head-------------|-----body-------|
+//|---4 bytes---|----4 bytes----|-----dataLen----|
+//|----------------------------------------------|
+//|---dataLen---|-----msgId-----|-------body-----|
+//|----------------------------------------------|
+
+// 开启序列号扩展包头后:
+//|--------------------head---------------------|-----body-------|
+//|---4 bytes---|----4 bytes----|----4 bytes----|-----dataLen----|
+//|--------------------------------------------------------------|
+//|---dataLen---|-----msgId-----|-----seqId-----|-------body-----|
+//|--------------------------------------------------------------|
+
+var (
+	defaultMaxPacketSize uint32 = 4096
+	seqHeaderLen         uint32 = 4 // 序列号扩展包头长度
+)
+
+// IDataPack 数据包 拆包/封包 接口，Server/Client/Connection均可单独指定
+type IDataPack interface {
+	GetHeadLen() uint32                   // 获取包头长度
+	Pack(msg *Msg) ([]byte, error)        // 封包方法
+	Unpack(headData []byte) (*Msg, error) // 拆包方法(只解析包头，不能持有headData)
+}
+
+// IMsgReader 包头长度不固定的封包格式(如varint)实现该接口，自行从数据流中读取完整消息
+type IMsgReader interface {
+	ReadMsg(r io.Reader) (*Msg, error)
+}
+
+// ISeqDataPack 支持序列号扩展包头的封包格式实现该接口
+type ISeqDataPack interface {
+	IsSeqEnabled() bool
+}
+
+// ReadMsg 按指定封包格式从数据流中读取一条完整消息
+func ReadMsg(dp IDataPack, r io.Reader) (*Msg, error) {
+	if mr, ok := dp.(IMsgReader); ok {
+		return mr.ReadMsg(r)
+	}
+
+	// 读取Msg head(包头只在拆包时使用，使用缓冲池)
+	head := GetBuffer(int(dp.GetHeadLen()))
+	defer head.Release()
+	if _, err := io.ReadFull(r, head.B); err != nil {
+		return nil, err
+	}
+
+	// 拆包，得到dataLen和msgId
+	msg, err := dp.Unpack(head.B)
+	if err != nil {
+		return nil, err
+	}
+
+	// 根据dataLen读取body
+	if err := readMsgData(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// checkHeadLen 判断包头数据是否完整
+func checkHeadLen(headData []byte, headLen uint32) error {
+	if uint32(len(headData)) < headLen {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// IsSeqEnabled 判断封包格式是否开启了序列号扩展包头
+func IsSeqEnabled(dp IDataPack) bool {
+	if sp, ok := dp.(ISeqDataPack); ok {
+		return sp.IsSeqEnabled()
+	}
+	return false
+}
+
+func readMsgData(r io.Reader, msg *Msg) error {
+	var data []byte
+	if msg.GetDataLen() > 0 {
+		data = make([]byte, msg.GetDataLen())
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+	}
+	msg.SetData(data)
+	return nil
+}
+
+// dataPackOption 封包格式公共配置(字节序、最大包长度、序列号扩展包头)
+type dataPackOption struct {
+	maxPacketSize uint32
+	byteOrder     binary.ByteOrder
+	seqEnabled    bool
+}
+
+func newDataPackOption() dataPackOption {
+	return dataPackOption{
+		maxPacketSize: defaultMaxPacketSize,
+		byteOrder:     binary.BigEndian,
+	}
+}
+
+// SetByteOrder 设置大小端
+func (o *dataPackOption) SetByteOrder(littleEndian bool) {
+	if littleEndian {
+		o.byteOrder = binary.LittleEndian
+	} else {
+		o.byteOrder = binary.BigEndian
+	}
+}
+
+// SetMaxPacketSize 设置最大包体长度
+func (o *dataPackOption) SetMaxPacketSize(maxPacketSize uint32) {
+	if maxPacketSize > 0 {
+		o.maxPacketSize = maxPacketSize
+	}
+}
+
+// SetSeqEnabled 设置是否开启序列号扩展包头(收发双方必须一致)
+func (o *dataPackOption) SetSeqEnabled(seqEnabled bool) {
+	o.seqEnabled = seqEnabled
+}
+
+// IsSeqEnabled 是否开启序列号扩展包头
+func (o *dataPackOption) IsSeqEnabled() bool {
+	return o.seqEnabled
+}
+
+func (o *dataPackOption) seqLen() uint32 {
+	if o.seqEnabled {
+		return seqHeaderLen
+	}
+	return 0
+}
+
+// checkPacketSize 判断包长度是否超出允许的最大包长度
+func (o *dataPackOption) checkPacketSize(headLen uint32, dataLen uint32) error {
+	if o.maxPacketSize > 0 && headLen+dataLen > o.maxPacketSize {
+		return errors.New(fmt.Sprintf("Too Long Msg Received, Limit Size:%d, Received Msg Size:%d", o.maxPacketSize, headLen+dataLen))
+	}
+	return nil
+}
+
+// DataPack 默认封包格式 dataLen(4字节)|msgId(4字节)|[seqId(4字节)]|body
+type DataPack struct {
+	dataPackOption
+}
+
+// NewDataPack 创建默认封包格式
+func NewDataPack() *DataPack {
+	return &DataPack{
+		dataPackOption: newDataPackOption(),
+	}
+}
+
+// GetHeadLen 获取包头长度方法
+func (dp *DataPack) GetHeadLen() uint32 {
+	// dataLen uint32(4字节) + msgId uint32(4字节) [+ seqId uint32(4字节)]
+	return 8 + dp.seqLen()
+}
+
+// Pack 封包方法
+func (dp *DataPack) Pack(msg *Msg) ([]byte, error) {
+	data := make([]byte, dp.GetHeadLen()+msg.GetDataLen())
+	dp.encode(data, msg)
+	return data, nil
+}
+
+// PackBuffer 封包到缓冲池
+func (dp *DataPack) PackBuffer(msg *Msg) (Buffer, error) {
+	buf := GetBuffer(int(dp.GetHeadLen() + msg.GetDataLen()))
+	dp.encode(buf.B, msg)
+	return buf, nil
+}
+
+// encode 将消息写入长度为 包头长度+dataLen 的dst
+func (dp *DataPack) encode(dst []byte, msg *Msg) {
+	// 写dataLen
+	dp.byteOrder.PutUint32(dst, msg.GetDataLen())
+	// 写msgId
+	dp.byteOrder.PutUint32(dst[4:], msg.GetMsgId())
+	// 写seqId
+	if dp.seqEnabled {
+		dp.byteOrder.PutUint32(dst[8:], msg.GetSeqId())
+	}
+	// 写data数据
+	copy(dst[dp.GetHeadLen():], msg.GetData())
+}
+
+// Unpack 拆包方法
+func (dp *DataPack) Unpack(headData []byte) (*Msg, error) {
+	if err := checkHeadLen(headData, dp.GetHeadLen()); err != nil {
+		return nil, err
+	}
+
+	// 只解压head的信息，得到dataLen和msgID
+	msg := &Msg{
+		DataLen: dp.byteOrder.Uint32(headData),
+		ID:      dp.byteOrder.Uint32(headData[4:]),
+	}
+	if dp.seqEnabled {
+		msg.SeqId = dp.byteOrder.Uint32(headData[8:])
+	}
+
+	// 判断dataLen的长度是否超出我们允许的最大包长度
+	if err := dp.checkPacketSize(dp.GetHeadLen(), msg.GetDataLen()); err != nil {
+		return nil, err
+	}
+
+	// 这里只需要把head的数据拆包出来就可以了，然后再通过head的长度，再从conn读取一次数据
+	return msg, nil
+}
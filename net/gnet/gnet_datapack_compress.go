@@ -0,0 +1,217 @@
+package gnet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"github.com/golang/snappy"
+	"io"
+	"io/ioutil"
+)
+
+// 消息标志位
+const (
+	FlagCompressSnappy uint16 = 1 << 0 // 消息体使用snappy压缩
+	FlagCompressZlib   uint16 = 1 << 1 // 消息体使用zlib压缩
+
+	flagCompressMask = FlagCompressSnappy | FlagCompressZlib
+)
+
+var (
+	defaultCompressThreshold  uint32 = 1024    // 默认超过1KB的消息体进行压缩
+	defaultMaxDecompressedLen uint32 = 4 << 20 // 默认解压后消息体最大4MB
+)
+
+// ICompressor 消息体压缩算法
+type ICompressor interface {
+	GetFlag() uint16                                       // 压缩算法对应的标志位
+	Compress(data []byte) ([]byte, error)                  // 压缩
+	Decompress(data []byte, maxLen uint32) ([]byte, error) // 解压，解压后长度超过maxLen返回错误
+}
+
+// SnappyCompressor snappy压缩，速度快，适合实时消息
+type SnappyCompressor struct{}
+
+// GetFlag 压缩算法对应的标志位
+func (SnappyCompressor) GetFlag() uint16 {
+	return FlagCompressSnappy
+}
+
+// Compress 压缩
+func (SnappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+// Decompress 解压
+func (SnappyCompressor) Decompress(data []byte, maxLen uint32) ([]byte, error) {
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if maxLen > 0 && uint32(n) > maxLen {
+		return nil, errDecompressedTooLong(maxLen)
+	}
+	return snappy.Decode(nil, data)
+}
+
+// ZlibCompressor zlib压缩，压缩率高，适合背包、邮件、地图快照等大消息
+type ZlibCompressor struct {
+	Level int // 压缩等级，0表示默认等级
+}
+
+// GetFlag 压缩算法对应的标志位
+func (ZlibCompressor) GetFlag() uint16 {
+	return FlagCompressZlib
+}
+
+// Compress 压缩
+func (c ZlibCompressor) Compress(data []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = zlib.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	w, err := zlib.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress 解压
+func (ZlibCompressor) Decompress(data []byte, maxLen uint32) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var reader io.Reader = r
+	if maxLen > 0 {
+		// 多读1个字节用于判断是否超出长度限制
+		reader = io.LimitReader(r, int64(maxLen)+1)
+	}
+	out, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if maxLen > 0 && uint32(len(out)) > maxLen {
+		return nil, errDecompressedTooLong(maxLen)
+	}
+	return out, nil
+}
+
+func errDecompressedTooLong(maxLen uint32) error {
+	return errors.New(fmt.Sprintf("Too Long Msg Decompressed, Limit Size:%d", maxLen))
+}
+
+// CompressDataPack 支持消息体压缩的封包格式，在携带标志位的封包格式基础上，
+// 消息体超过阈值时自动压缩并设置压缩标志位，读取消息时根据标志位自动解压(收发双方均需使用该格式)
+type CompressDataPack struct {
+	*FlagDataPack
+	compressor         ICompressor
+	threshold          uint32
+	maxDecompressedLen uint32
+}
+
+// NewCompressDataPack 创建支持消息体压缩的封包格式，compressor为nil时使用snappy
+func NewCompressDataPack(compressor ICompressor) *CompressDataPack {
+	if compressor == nil {
+		compressor = SnappyCompressor{}
+	}
+	return &CompressDataPack{
+		FlagDataPack:       NewFlagDataPack(),
+		compressor:         compressor,
+		threshold:          defaultCompressThreshold,
+		maxDecompressedLen: defaultMaxDecompressedLen,
+	}
+}
+
+// SetThreshold 设置压缩阈值，消息体长度不小于该值时进行压缩
+func (dp *CompressDataPack) SetThreshold(threshold uint32) {
+	dp.threshold = threshold
+}
+
+// SetMaxDecompressedLen 设置解压后消息体最大长度(防止解压炸弹)
+func (dp *CompressDataPack) SetMaxDecompressedLen(maxLen uint32) {
+	dp.maxDecompressedLen = maxLen
+}
+
+// Pack 封包方法，消息体超过阈值且压缩后更小时发送压缩数据
+func (dp *CompressDataPack) Pack(msg *Msg) ([]byte, error) {
+	compressed, err := dp.compress(msg)
+	if err != nil {
+		return nil, err
+	}
+	return dp.FlagDataPack.Pack(compressed)
+}
+
+// PackBuffer 封包到缓冲池，与Pack相同消息体超过阈值且压缩后更小时发送压缩数据
+func (dp *CompressDataPack) PackBuffer(msg *Msg) (Buffer, error) {
+	compressed, err := dp.compress(msg)
+	if err != nil {
+		return Buffer{}, err
+	}
+	return dp.FlagDataPack.PackBuffer(compressed)
+}
+
+// compress 消息体超过阈值且压缩后更小时返回压缩后的消息，否则返回原消息
+func (dp *CompressDataPack) compress(msg *Msg) (*Msg, error) {
+	if msg.GetDataLen() < dp.threshold || msg.GetFlags()&flagCompressMask != 0 {
+		return msg, nil
+	}
+
+	data, err := dp.compressor.Compress(msg.GetData())
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(data)) >= msg.GetDataLen() {
+		return msg, nil
+	}
+
+	// 不修改原消息，广播时同一消息会被多次封包
+	compressed := NewMsg(msg.GetMsgId(), data).WithSeqId(msg.GetSeqId())
+	compressed.SetFlags(msg.GetFlags() | dp.compressor.GetFlag())
+	return compressed, nil
+}
+
+// ReadMsg 读取一条完整消息，并根据标志位解压消息体
+func (dp *CompressDataPack) ReadMsg(r io.Reader) (*Msg, error) {
+	msg, err := ReadMsg(dp.FlagDataPack, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := dp.decompress(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// decompress 根据标志位解压消息体，并清除压缩标志位
+func (dp *CompressDataPack) decompress(msg *Msg) error {
+	var compressor ICompressor
+	switch {
+	case msg.GetFlags()&FlagCompressSnappy != 0:
+		compressor = SnappyCompressor{}
+	case msg.GetFlags()&FlagCompressZlib != 0:
+		compressor = ZlibCompressor{}
+	default:
+		return nil
+	}
+
+	data, err := compressor.Decompress(msg.GetData(), dp.maxDecompressedLen)
+	if err != nil {
+		return err
+	}
+	msg.SetData(data)
+	msg.SetFlags(msg.GetFlags() &^ flagCompressMask)
+	return nil
+}
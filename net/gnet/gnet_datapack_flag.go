@@ -0,0 +1,77 @@
+package gnet
+
+//|-------------------head--------------------|-----body-------|
+//|---4 bytes---|----4 bytes----|---2 bytes---|-----dataLen----|
+//|------------------------------------------------------------|
+//|---dataLen---|-----msgId-----|----flags----|-------body-----|
+//|------------------------------------------------------------|
+
+// FlagDataPack 携带标志位的封包格式 dataLen(4字节)|msgId(4字节)|flags(2字节)|[seqId(4字节)]|body
+type FlagDataPack struct {
+	dataPackOption
+}
+
+// NewFlagDataPack 创建携带标志位的封包格式
+func NewFlagDataPack() *FlagDataPack {
+	return &FlagDataPack{
+		dataPackOption: newDataPackOption(),
+	}
+}
+
+// GetHeadLen 获取包头长度方法
+func (dp *FlagDataPack) GetHeadLen() uint32 {
+	// dataLen uint32(4字节) + msgId uint32(4字节) + flags uint16(2字节) [+ seqId uint32(4字节)]
+	return 10 + dp.seqLen()
+}
+
+// Pack 封包方法
+func (dp *FlagDataPack) Pack(msg *Msg) ([]byte, error) {
+	data := make([]byte, dp.GetHeadLen()+msg.GetDataLen())
+	dp.encode(data, msg)
+	return data, nil
+}
+
+// PackBuffer 封包到缓冲池
+func (dp *FlagDataPack) PackBuffer(msg *Msg) (Buffer, error) {
+	buf := GetBuffer(int(dp.GetHeadLen() + msg.GetDataLen()))
+	dp.encode(buf.B, msg)
+	return buf, nil
+}
+
+// encode 将消息写入长度为 包头长度+dataLen 的dst
+func (dp *FlagDataPack) encode(dst []byte, msg *Msg) {
+	// 写dataLen
+	dp.byteOrder.PutUint32(dst, msg.GetDataLen())
+	// 写msgId
+	dp.byteOrder.PutUint32(dst[4:], msg.GetMsgId())
+	// 写flags
+	dp.byteOrder.PutUint16(dst[8:], msg.GetFlags())
+	// 写seqId
+	if dp.seqEnabled {
+		dp.byteOrder.PutUint32(dst[10:], msg.GetSeqId())
+	}
+	// 写data数据
+	copy(dst[dp.GetHeadLen():], msg.GetData())
+}
+
+// Unpack 拆包方法
+func (dp *FlagDataPack) Unpack(headData []byte) (*Msg, error) {
+	if err := checkHeadLen(headData, dp.GetHeadLen()); err != nil {
+		return nil, err
+	}
+
+	msg := &Msg{
+		DataLen: dp.byteOrder.Uint32(headData),
+		ID:      dp.byteOrder.Uint32(headData[4:]),
+		Flags:   dp.byteOrder.Uint16(headData[8:]),
+	}
+	if dp.seqEnabled {
+		msg.SeqId = dp.byteOrder.Uint32(headData[10:])
+	}
+
+	if err := dp.checkPacketSize(dp.GetHeadLen(), msg.GetDataLen()); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,104 @@
+package gnet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// JSON信封封包格式，适用于浏览器客户端(WebSocket文本帧)，每一帧为一条消息:
+// {"id":消息ID, "route":"group.name", "seq":请求序列号, "data":{...}}
+// 请求时id与route任选其一(route优先)，响应时两者都会携带；data使用ProtoJSON编码
+
+var ErrJsonDataPackInvalid = errors.New("json data pack: msg data is not valid json")
+
+// JsonEnvelope JSON信封
+type JsonEnvelope struct {
+	Id    uint32          `json:"id"`
+	Route string          `json:"route,omitempty"`
+	Seq   uint32          `json:"seq,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// JsonDataPack JSON信封封包格式(需配合JsonCodec使用)
+type JsonDataPack struct {
+	maxPacketSize uint32
+}
+
+// NewJsonDataPack 创建JSON信封封包格式
+func NewJsonDataPack() *JsonDataPack {
+	return &JsonDataPack{
+		maxPacketSize: defaultMaxPacketSize,
+	}
+}
+
+// SetMaxPacketSize 设置单条消息最大长度(0表示不限制)
+func (dp *JsonDataPack) SetMaxPacketSize(maxPacketSize uint32) {
+	dp.maxPacketSize = maxPacketSize
+}
+
+// GetHeadLen JSON信封没有固定包头
+func (dp *JsonDataPack) GetHeadLen() uint32 {
+	return 0
+}
+
+// IsSeqEnabled JSON信封始终可以携带请求序列号
+func (dp *JsonDataPack) IsSeqEnabled() bool {
+	return true
+}
+
+// Pack 封包方法
+func (dp *JsonDataPack) Pack(msg *Msg) ([]byte, error) {
+	data := msg.GetData()
+	if len(data) == 0 {
+		data = []byte("{}")
+	} else if !json.Valid(data) {
+		return nil, ErrJsonDataPackInvalid
+	}
+	return json.Marshal(&JsonEnvelope{
+		Id:    msg.GetMsgId(),
+		Route: RouteItemMgr.GetRoute(msg.GetMsgId()),
+		Seq:   msg.GetSeqId(),
+		Data:  data,
+	})
+}
+
+// Unpack JSON信封不支持只解析包头，请使用ReadMsg
+func (dp *JsonDataPack) Unpack(headData []byte) (*Msg, error) {
+	return nil, errors.New("json data pack: unpack is not supported, use ReadMsg")
+}
+
+// ReadMsg 读取一条完整消息(一个WebSocket帧)
+func (dp *JsonDataPack) ReadMsg(r io.Reader) (*Msg, error) {
+	if dp.maxPacketSize > 0 {
+		// 多读1个字节用于判断是否超出长度限制
+		r = io.LimitReader(r, int64(dp.maxPacketSize)+1)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if dp.maxPacketSize > 0 && uint32(len(data)) > dp.maxPacketSize {
+		return nil, errors.New(fmt.Sprintf("Too Long Msg Received, Limit Size:%d", dp.maxPacketSize))
+	}
+
+	envelope := &JsonEnvelope{}
+	if err := json.Unmarshal(data, envelope); err != nil {
+		return nil, err
+	}
+
+	msgId := envelope.Id
+	if envelope.Route != "" {
+		// 路由不存在时消息ID保持不变，由Router按未注册消息处理
+		if id, ok := RouteItemMgr.GetMsgIdByRoute(envelope.Route); ok {
+			msgId = id
+		}
+	}
+	body := []byte(envelope.Data)
+	if len(body) == 0 || string(body) == "null" {
+		body = []byte("{}")
+	}
+	return NewMsg(msgId, body).WithSeqId(envelope.Seq), nil
+}
@@ -0,0 +1,93 @@
+package gnet
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+//|------------head-------------|-----body-------|
+//|---4 bytes---|----2 bytes----|-----dataLen----|
+//|----------------------------------------------|
+//|---dataLen---|-----msgId-----|-------body-----|
+//|----------------------------------------------|
+
+// ShortIdDataPack 16位消息ID封包格式 dataLen(4字节)|msgId(2字节)|[seqId(4字节)]|body，用于兼容旧版客户端
+type ShortIdDataPack struct {
+	dataPackOption
+}
+
+// NewShortIdDataPack 创建16位消息ID封包格式
+func NewShortIdDataPack() *ShortIdDataPack {
+	return &ShortIdDataPack{
+		dataPackOption: newDataPackOption(),
+	}
+}
+
+// GetHeadLen 获取包头长度方法
+func (dp *ShortIdDataPack) GetHeadLen() uint32 {
+	// dataLen uint32(4字节) + msgId uint16(2字节) [+ seqId uint32(4字节)]
+	return 6 + dp.seqLen()
+}
+
+// Pack 封包方法
+func (dp *ShortIdDataPack) Pack(msg *Msg) ([]byte, error) {
+	if err := dp.checkMsgId(msg); err != nil {
+		return nil, err
+	}
+	data := make([]byte, dp.GetHeadLen()+msg.GetDataLen())
+	dp.encode(data, msg)
+	return data, nil
+}
+
+// PackBuffer 封包到缓冲池
+func (dp *ShortIdDataPack) PackBuffer(msg *Msg) (Buffer, error) {
+	if err := dp.checkMsgId(msg); err != nil {
+		return Buffer{}, err
+	}
+	buf := GetBuffer(int(dp.GetHeadLen() + msg.GetDataLen()))
+	dp.encode(buf.B, msg)
+	return buf, nil
+}
+
+func (dp *ShortIdDataPack) checkMsgId(msg *Msg) error {
+	if msg.GetMsgId() > math.MaxUint16 {
+		return errors.New(fmt.Sprintf("msgId %d overflows uint16", msg.GetMsgId()))
+	}
+	return nil
+}
+
+// encode 将消息写入长度为 包头长度+dataLen 的dst
+func (dp *ShortIdDataPack) encode(dst []byte, msg *Msg) {
+	// 写dataLen
+	dp.byteOrder.PutUint32(dst, msg.GetDataLen())
+	// 写msgId
+	dp.byteOrder.PutUint16(dst[4:], uint16(msg.GetMsgId()))
+	// 写seqId
+	if dp.seqEnabled {
+		dp.byteOrder.PutUint32(dst[6:], msg.GetSeqId())
+	}
+	// 写data数据
+	copy(dst[dp.GetHeadLen():], msg.GetData())
+}
+
+// Unpack 拆包方法
+func (dp *ShortIdDataPack) Unpack(headData []byte) (*Msg, error) {
+	if err := checkHeadLen(headData, dp.GetHeadLen()); err != nil {
+		return nil, err
+	}
+
+	msg := &Msg{
+		DataLen: dp.byteOrder.Uint32(headData),
+		ID:      uint32(dp.byteOrder.Uint16(headData[4:])),
+	}
+	if dp.seqEnabled {
+		msg.SeqId = dp.byteOrder.Uint32(headData[6:])
+	}
+
+	if err := dp.checkPacketSize(dp.GetHeadLen(), msg.GetDataLen()); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,125 @@
+package gnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+//|-----------------head------------------|-----body-------|
+//|---1~5 bytes(varint)---|----4 bytes----|-----dataLen----|
+//|--------------------------------------------------------|
+//|--------dataLen--------|-----msgId-----|-------body-----|
+//|--------------------------------------------------------|
+
+// VarintDataPack varint长度前缀封包格式 dataLen(varint)|msgId(4字节)|[seqId(4字节)]|body
+// 包头长度不固定，需通过 ReadMsg 从数据流中读取消息
+type VarintDataPack struct {
+	dataPackOption
+}
+
+// NewVarintDataPack 创建varint长度前缀封包格式
+func NewVarintDataPack() *VarintDataPack {
+	return &VarintDataPack{
+		dataPackOption: newDataPackOption(),
+	}
+}
+
+// GetHeadLen 获取包头最大长度
+func (dp *VarintDataPack) GetHeadLen() uint32 {
+	// dataLen varint(最多5字节) + msgId uint32(4字节) [+ seqId uint32(4字节)]
+	return binary.MaxVarintLen32 + 4 + dp.seqLen()
+}
+
+// Pack 封包方法
+func (dp *VarintDataPack) Pack(msg *Msg) ([]byte, error) {
+	var lenBuf [binary.MaxVarintLen32]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(msg.GetDataLen()))
+	headLen := uint32(n) + 4 + dp.seqLen()
+
+	data := make([]byte, headLen+msg.GetDataLen())
+	// 写dataLen
+	copy(data, lenBuf[:n])
+	// 写msgId
+	dp.byteOrder.PutUint32(data[n:], msg.GetMsgId())
+	// 写seqId
+	if dp.seqEnabled {
+		dp.byteOrder.PutUint32(data[n+4:], msg.GetSeqId())
+	}
+	// 写data数据
+	copy(data[headLen:], msg.GetData())
+	return data, nil
+}
+
+// Unpack 拆包方法，headData需以完整的包头开始
+func (dp *VarintDataPack) Unpack(headData []byte) (*Msg, error) {
+	dataLen, n := binary.Uvarint(headData)
+	if n <= 0 {
+		return nil, errors.New("invalid varint dataLen")
+	}
+	return dp.unpack(dataLen, bytes.NewReader(headData[n:]), uint32(n))
+}
+
+// ReadMsg 从数据流中读取一条完整消息
+func (dp *VarintDataPack) ReadMsg(r io.Reader) (*Msg, error) {
+	dataLen, n, err := readUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := dp.unpack(dataLen, r, n)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := readMsgData(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (dp *VarintDataPack) unpack(dataLen uint64, r io.Reader, varintLen uint32) (*Msg, error) {
+	msg := &Msg{DataLen: uint32(dataLen)}
+
+	// 读msgId
+	if err := binary.Read(r, dp.byteOrder, &msg.ID); err != nil {
+		return nil, err
+	}
+
+	// 读seqId
+	if dp.seqEnabled {
+		if err := binary.Read(r, dp.byteOrder, &msg.SeqId); err != nil {
+			return nil, err
+		}
+	}
+
+	if dataLen > uint64(^uint32(0)) {
+		return nil, errors.New("varint dataLen overflows uint32")
+	}
+	if err := dp.checkPacketSize(varintLen+4+dp.seqLen(), msg.GetDataLen()); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// readUvarint 逐字节读取varint, 避免从数据流中多读
+func readUvarint(r io.Reader) (uint64, uint32, error) {
+	var (
+		x     uint64
+		shift uint
+		b     = make([]byte, 1)
+	)
+	for i := 0; i < binary.MaxVarintLen32; i++ {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return 0, 0, err
+		}
+		if b[0] < 0x80 {
+			return x | uint64(b[0])<<shift, uint32(i + 1), nil
+		}
+		x |= uint64(b[0]&0x7f) << shift
+		shift += 7
+	}
+	return 0, 0, errors.New("invalid varint dataLen")
+}
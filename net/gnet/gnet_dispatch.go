@@ -0,0 +1,104 @@
+package gnet
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// DispatchKeyFunc 消息分发Key函数，Key相同的消息固定由同一个Worker按顺序处理
+type DispatchKeyFunc func(req *Request) uint64
+
+// DispatchByConnId 按链接ID分发(默认)，链接重连后ID变化，消息可能落入不同Worker
+func DispatchByConnId(req *Request) uint64 {
+	return uint64(req.GetConnId())
+}
+
+// dispatchPropertyKey 链接的分发状态保存在链接属性中
+const dispatchPropertyKey = "gnet.dispatch"
+
+// dispatchState 链接的分发状态，记录当前分发Key及已分发但还未处理完成的消息数量
+type dispatchState struct {
+	lock    sync.Mutex
+	key     uint64
+	pending int
+}
+
+// DispatchByUid 按链接绑定的用户ID分发，玩家重连后消息仍由同一个Worker处理；
+// 链接未绑定用户ID时(如登录消息)按链接ID分发。绑定(或解绑)后，链接在原Worker中的消息全部处理完成前仍按原Key分发，
+// 保证同一链接的消息始终按顺序处理；用户ID与链接ID取模后可能落入同一个Worker，只影响负载分布，不影响顺序。
+// 注意: 只保证同一链接内的顺序，不保证新旧链接之间的顺序。玩家重连时，新链接绑定前后仍按链接ID分发的消息，
+// 可能与旧链接在用户ID Worker中尚未处理完成的消息同时执行；业务需在绑定时(如登录消息中)等待旧链接下线，或自行加锁
+func DispatchByUid(connMgr *ConnManager) DispatchKeyFunc {
+	return func(req *Request) uint64 {
+		key := DispatchByConnId(req)
+		if uid, ok := connMgr.GetUid(req.GetConnection()); ok {
+			key = uid
+		}
+		return pinDispatchKey(req, key)
+	}
+}
+
+// pinDispatchKey 将分发Key固定在链接上，链接还有消息未处理完成时沿用原Key，处理完成后才切换到新Key
+func pinDispatchKey(req *Request, key uint64) uint64 {
+	conn := req.GetConnection()
+	var state *dispatchState
+	if v, ok := conn.GetProperty(dispatchPropertyKey); ok {
+		state = v.(*dispatchState)
+	} else {
+		// 同一链接的消息由读取Goroutine顺序分发，不会并发创建
+		state = &dispatchState{key: key}
+		conn.SetProperty(dispatchPropertyKey, state)
+	}
+
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if state.pending == 0 {
+		state.key = key
+	}
+	state.pending++
+	req.done = func() {
+		state.lock.Lock()
+		state.pending--
+		state.lock.Unlock()
+	}
+	return state.key
+}
+
+// DispatchByProperty 按链接属性分发(如房间ID)，属性不存在时按链接ID分发
+func DispatchByProperty(key string) DispatchKeyFunc {
+	return func(req *Request) uint64 {
+		if value, ok := req.GetConnection().GetProperty(key); ok {
+			return DispatchKeyOf(value)
+		}
+		return DispatchByConnId(req)
+	}
+}
+
+// DispatchKeyOf 将整数、字符串等类型的值转换为分发Key
+func DispatchKeyOf(value interface{}) uint64 {
+	switch v := value.(type) {
+	case uint64:
+		return v
+	case int64:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case int32:
+		return uint64(v)
+	case uint:
+		return uint64(v)
+	case int:
+		return uint64(v)
+	case string:
+		return hashDispatchKey(v)
+	default:
+		return hashDispatchKey(fmt.Sprintf("%v", v))
+	}
+}
+
+func hashDispatchKey(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum64()
+}
@@ -0,0 +1,137 @@
+package gnet
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Ravior/gserver/errors/gcode"
+	"github.com/Ravior/gserver/errors/gerror"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ErrorMsgId 标准错误消息ID，Handler返回错误时发送给客户端(携带请求序列号)
+var ErrorMsgId uint32 = 0xFFFFFF00
+
+var errErrorMsgInvalid = errors.New("error msg is invalid")
+
+// ErrorMsg 标准错误消息，编码与以下Proto定义一致，客户端可直接使用Proto解码:
+//
+//	message ErrorMsg {
+//	    int32  code    = 1; // 错误码(gcode.Code)
+//	    string message = 2; // 错误信息
+//	    uint32 msg_id  = 3; // 出错的请求消息ID
+//	}
+//
+// 链接使用JsonCodec时编码为 {"code":53,"message":"参数错误","msgId":1001}
+type ErrorMsg struct {
+	Code    int32  `json:"code"`
+	Message string `json:"message"`
+	MsgId   uint32 `json:"msgId"`
+}
+
+// NewErrorMsg 根据Handler返回的错误创建标准错误消息，只携带最外层的错误信息(未设置时取错误码信息)，不携带被包装的错误链；
+// 未携带错误码的错误统一转换为 gcode.CodeInternalError，避免泄露服务器内部错误信息
+func NewErrorMsg(msgId uint32, err error) *ErrorMsg {
+	code := gerror.Code(err)
+	if code == nil || code == gcode.CodeNil {
+		return &ErrorMsg{Code: int32(gcode.CodeInternalError.Code()), Message: gcode.CodeInternalError.Message(), MsgId: msgId}
+	}
+	message := code.Message()
+	if e, ok := err.(interface{ Current() error }); ok {
+		if current := e.Current(); current != nil && current.Error() != "" {
+			message = current.Error()
+		}
+	}
+	return &ErrorMsg{Code: int32(code.Code()), Message: message, MsgId: msgId}
+}
+
+// Error 实现error接口，Call收到错误消息时作为错误返回
+func (m *ErrorMsg) Error() string {
+	return m.Message
+}
+
+// GetCode 获取错误码
+func (m *ErrorMsg) GetCode() gcode.Code {
+	return gcode.New(int(m.Code), m.Message, nil)
+}
+
+// Marshal 编码
+func (m *ErrorMsg) Marshal() []byte {
+	var data []byte
+	if m.Code != 0 {
+		data = protowire.AppendTag(data, 1, protowire.VarintType)
+		data = protowire.AppendVarint(data, uint64(m.Code))
+	}
+	if m.Message != "" {
+		data = protowire.AppendTag(data, 2, protowire.BytesType)
+		data = protowire.AppendString(data, m.Message)
+	}
+	if m.MsgId != 0 {
+		data = protowire.AppendTag(data, 3, protowire.VarintType)
+		data = protowire.AppendVarint(data, uint64(m.MsgId))
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data
+}
+
+// UnmarshalErrorMsg 解码标准错误消息
+func UnmarshalErrorMsg(data []byte) (*ErrorMsg, error) {
+	m := &ErrorMsg{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, errErrorMsgInvalid
+		}
+		data = data[n:]
+
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, errErrorMsgInvalid
+			}
+			m.Code, data = int32(v), data[n:]
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return nil, errErrorMsgInvalid
+			}
+			m.Message, data = v, data[n:]
+		case num == 3 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, errErrorMsgInvalid
+			}
+			m.MsgId, data = uint32(v), data[n:]
+		default:
+			// 跳过未知字段，兼容以后新增字段
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, errErrorMsgInvalid
+			}
+			data = data[n:]
+		}
+	}
+	return m, nil
+}
+
+// encodeErrorMsg 按链接的编解码器编码标准错误消息
+func encodeErrorMsg(codec ICodec, m *ErrorMsg) ([]byte, error) {
+	if codec.GetName() == CodecJson {
+		return json.Marshal(m)
+	}
+	return m.Marshal(), nil
+}
+
+// decodeErrorMsg 按链接的编解码器解码标准错误消息
+func decodeErrorMsg(codec ICodec, data []byte) (*ErrorMsg, error) {
+	if codec.GetName() == CodecJson {
+		m := &ErrorMsg{}
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	return UnmarshalErrorMsg(data)
+}
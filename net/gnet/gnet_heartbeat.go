@@ -0,0 +1,142 @@
+package gnet
+
+import (
+	"context"
+	"github.com/Ravior/gserver/os/glog"
+	"go.uber.org/atomic"
+	"time"
+)
+
+// HeartBeatOption 心跳配置
+type HeartBeatOption struct {
+	ReadIdle  time.Duration // 读空闲超时，超过该时长未收到对端数据则断开链接(0表示不检测)
+	WriteIdle time.Duration // 写空闲时长，超过该时长未发送数据则主动发送心跳消息(0表示不发送)
+	PingMsgId uint32        // 主动发送的心跳消息ID(0表示不发送)
+}
+
+// NewHeartBeatOption 根据配置创建心跳配置，readIdle、writeIdle单位为秒
+func NewHeartBeatOption(readIdle int, writeIdle int, pingMsgId uint32) HeartBeatOption {
+	return HeartBeatOption{
+		ReadIdle:  time.Duration(readIdle) * time.Second,
+		WriteIdle: time.Duration(writeIdle) * time.Second,
+		PingMsgId: pingMsgId,
+	}
+}
+
+// IsEnabled 是否开启了心跳检测
+func (o HeartBeatOption) IsEnabled() bool {
+	return o.ReadIdle > 0 || o.pingEnabled()
+}
+
+func (o HeartBeatOption) pingEnabled() bool {
+	return o.WriteIdle > 0 && o.PingMsgId > 0
+}
+
+// HeartBeat 链接心跳组件，检测读空闲超时并在写空闲时主动发送心跳消息
+type HeartBeat struct {
+	conn      IConnection
+	option    HeartBeatOption
+	clock     Clock
+	lastRead  atomic.Int64 // 最后一次收到数据时间(纳秒)
+	lastWrite atomic.Int64 // 最后一次发送数据时间(纳秒)
+}
+
+// NewHeartBeat 创建链接心跳组件
+func NewHeartBeat(conn IConnection, option HeartBeatOption) *HeartBeat {
+	h := &HeartBeat{
+		conn:   conn,
+		option: option,
+	}
+	h.SetClock(SystemClock)
+	return h
+}
+
+// SetClock 设置心跳使用的时钟(需在Run之前设置)，并以该时钟的当前时间重置读写活跃时间
+func (h *HeartBeat) SetClock(clock Clock) {
+	h.clock = clock
+	now := clock.Now().UnixNano()
+	h.lastRead.Store(now)
+	h.lastWrite.Store(now)
+}
+
+// GetOption 获取心跳配置
+func (h *HeartBeat) GetOption() HeartBeatOption {
+	return h.option
+}
+
+// SetOption 设置心跳配置(需在Run之前设置)
+func (h *HeartBeat) SetOption(option HeartBeatOption) {
+	h.option = option
+}
+
+// KeepAlive 收到对端数据，更新读活跃时间
+func (h *HeartBeat) KeepAlive() {
+	h.lastRead.Store(h.clock.Now().UnixNano())
+}
+
+// OnWrite 发送数据，更新写活跃时间
+func (h *HeartBeat) OnWrite() {
+	h.lastWrite.Store(h.clock.Now().UnixNano())
+}
+
+// IsAlive 链接是否活跃(未开启读空闲检测时始终活跃)
+func (h *HeartBeat) IsAlive() bool {
+	if h.option.ReadIdle <= 0 {
+		return true
+	}
+	return h.clock.Now().Sub(time.Unix(0, h.lastRead.Load())) < h.option.ReadIdle
+}
+
+// Run 阻塞执行心跳检测，直到链接读空闲超时或者ctx取消
+func (h *HeartBeat) Run(ctx context.Context) {
+	if !h.option.IsEnabled() {
+		return
+	}
+
+	timer := h.clock.NewTimer(h.check())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C():
+			if !h.IsAlive() {
+				// 心跳检测失败，结束连接
+				glog.Warnf("连接已关闭或者太久没有心跳, ConnId:%d, Addr:%s", h.conn.GetConnID(), h.conn.RemoteAddr())
+				h.conn.Stop()
+				return
+			}
+			timer.Reset(h.check())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check 写空闲时发送心跳消息，并返回距离下一次检测的时长
+func (h *HeartBeat) check() time.Duration {
+	now := h.clock.Now()
+	next := time.Duration(-1)
+
+	if h.option.ReadIdle > 0 {
+		next = h.option.ReadIdle - now.Sub(time.Unix(0, h.lastRead.Load()))
+		// 读空闲已超时，立即检测
+		if next <= 0 {
+			return time.Millisecond
+		}
+	}
+
+	if h.option.pingEnabled() {
+		writeIdle := now.Sub(time.Unix(0, h.lastWrite.Load()))
+		if writeIdle >= h.option.WriteIdle {
+			if err := h.conn.SendMsg(h.option.PingMsgId, []byte{}); err == nil {
+				h.OnWrite()
+			}
+			writeIdle = 0
+		}
+		if wait := h.option.WriteIdle - writeIdle; next < 0 || wait < next {
+			next = wait
+		}
+	}
+
+	return next
+}
@@ -0,0 +1,243 @@
+package gnet
+
+import (
+	"github.com/Ravior/gserver/os/glog"
+	"sync"
+	"time"
+)
+
+// limiterPropertyKey 链接限流状态保存在链接属性中，链接释放时随之释放
+const limiterPropertyKey = "gnet.limiter"
+
+// defaultLimitErrInterval 默认LimitSendError策略发送错误消息的最小间隔
+var defaultLimitErrInterval = time.Second
+
+// LimitPolicy 超出限流后的处理策略
+type LimitPolicy uint8
+
+const (
+	LimitDrop       LimitPolicy = iota // 丢弃消息
+	LimitSendError                     // 丢弃消息，并向客户端发送错误消息
+	LimitDisconnect                    // 断开链接
+)
+
+// LimitReason 触发限流的原因
+type LimitReason uint8
+
+const (
+	LimitMsgRate   LimitReason = iota + 1 // 超出每秒消息数限制
+	LimitByteRate                         // 超出每秒字节数限制
+	LimitMsgIdRate                        // 超出单个消息ID的每秒消息数限制
+)
+
+// LimitRule 令牌桶限流规则
+type LimitRule struct {
+	Rate  float64 // 每秒产生的令牌数(0表示不限制)
+	Burst float64 // 令牌桶容量(允许的突发量，0表示与Rate相同)
+}
+
+// IsEnabled 是否开启限流
+func (r LimitRule) IsEnabled() bool {
+	return r.Rate > 0
+}
+
+// LimitOption 链接限流配置
+type LimitOption struct {
+	MsgRate     LimitRule            // 每个链接每秒消息数限制
+	ByteRate    LimitRule            // 每个链接每秒字节数限制(Burst需不小于单条消息最大长度)
+	MsgIdRate   map[uint32]LimitRule // 每个链接按消息ID的每秒消息数限制
+	Policy      LimitPolicy          // 超出限流后的处理策略
+	ErrMsgId    uint32               // LimitSendError策略发送的错误消息ID
+	ErrMsg      []byte               // LimitSendError策略发送的错误消息
+	ErrInterval time.Duration        // LimitSendError策略发送错误消息的最小间隔，间隔内只发送一次(0表示默认1秒)
+}
+
+// LimitViolation 限流事件
+type LimitViolation struct {
+	Conn   IConnection // 触发限流的链接
+	MsgId  uint32      // 触发限流的消息ID
+	Reason LimitReason // 触发限流的原因
+	Policy LimitPolicy // 处理策略
+}
+
+// LimitViolationFunc 限流事件Hook函数(在链接读取Goroutine中同步调用，不能阻塞)
+type LimitViolationFunc func(violation *LimitViolation)
+
+// TokenBucket 令牌桶
+type TokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket 创建令牌桶，初始令牌数为桶容量
+func NewTokenBucket(rate float64, burst float64) *TokenBucket {
+	if burst <= 0 {
+		burst = rate
+	}
+	// 桶容量至少能容纳1个令牌
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Allow 取出n个令牌，令牌不足时返回false
+func (b *TokenBucket) Allow(n float64) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// refill 按流逝的时间补充令牌(需持有锁)
+func (b *TokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// limitCheck 一次限流检测中需要取出令牌的令牌桶
+type limitCheck struct {
+	bucket *TokenBucket
+	n      float64
+	reason LimitReason
+}
+
+// connLimiter 单个链接的限流状态
+type connLimiter struct {
+	msgBucket   *TokenBucket
+	byteBucket  *TokenBucket
+	msgIdBucket map[uint32]*TokenBucket
+	lastErrTime time.Time // 上一次发送限流错误消息的时间
+}
+
+// RateLimiter 链接限流器，防止单个链接刷消息占满Worker影响其他链接
+type RateLimiter struct {
+	option      LimitOption
+	onViolation LimitViolationFunc
+}
+
+// NewRateLimiter 创建链接限流器
+func NewRateLimiter(option LimitOption) *RateLimiter {
+	return &RateLimiter{
+		option: option,
+	}
+}
+
+// SetOnViolation 设置限流事件Hook函数，可用于记录日志、封禁
+func (l *RateLimiter) SetOnViolation(onViolation LimitViolationFunc) {
+	l.onViolation = onViolation
+}
+
+// Allow 判断消息是否允许进入Worker队列，不允许时按处理策略处理
+func (l *RateLimiter) Allow(req *Request) bool {
+	conn := req.GetConnection()
+	msg := req.GetMessage()
+
+	cl := l.getConnLimiter(conn)
+	reason := l.check(cl, msg)
+	if reason == 0 {
+		return true
+	}
+
+	glog.Warnf("Connection exceeds rate limit, Reason:%d, MsgId:%d, ConnId:%d, Addr:%s", reason, msg.GetMsgId(), conn.GetConnID(), conn.RemoteAddr())
+	if l.onViolation != nil {
+		l.onViolation(&LimitViolation{Conn: conn, MsgId: msg.GetMsgId(), Reason: reason, Policy: l.option.Policy})
+	}
+
+	switch l.option.Policy {
+	case LimitSendError:
+		if l.option.ErrMsgId > 0 && l.allowSendError(cl) {
+			data := l.option.ErrMsg
+			if data == nil {
+				data = []byte{}
+			}
+			_ = conn.SendMsg(l.option.ErrMsgId, data)
+		}
+	case LimitDisconnect:
+		conn.Stop()
+	}
+	return false
+}
+
+// check 检测是否超出限流，返回触发限流的原因(0表示未超出)
+// 所有令牌桶的令牌都足够时才一起取出，被拒绝的消息不消耗任何令牌桶的令牌
+func (l *RateLimiter) check(cl *connLimiter, msg *Msg) LimitReason {
+	checks := make([]limitCheck, 0, 3)
+	if cl.msgBucket != nil {
+		checks = append(checks, limitCheck{bucket: cl.msgBucket, n: 1, reason: LimitMsgRate})
+	}
+	if cl.byteBucket != nil {
+		checks = append(checks, limitCheck{bucket: cl.byteBucket, n: float64(msg.GetDataLen()), reason: LimitByteRate})
+	}
+	if rule, ok := l.option.MsgIdRate[msg.GetMsgId()]; ok && rule.IsEnabled() {
+		bucket, ok := cl.msgIdBucket[msg.GetMsgId()]
+		if !ok {
+			bucket = NewTokenBucket(rule.Rate, rule.Burst)
+			cl.msgIdBucket[msg.GetMsgId()] = bucket
+		}
+		checks = append(checks, limitCheck{bucket: bucket, n: 1, reason: LimitMsgIdRate})
+	}
+
+	now := time.Now()
+	for _, c := range checks {
+		c.bucket.lock.Lock()
+		defer c.bucket.lock.Unlock()
+		c.bucket.refill(now)
+		if c.bucket.tokens < c.n {
+			return c.reason
+		}
+	}
+	for _, c := range checks {
+		c.bucket.tokens -= c.n
+	}
+	return 0
+}
+
+// allowSendError 判断是否发送限流错误消息，每个链接在间隔内只发送一次，防止被限流的链接放大下行流量
+func (l *RateLimiter) allowSendError(cl *connLimiter) bool {
+	interval := l.option.ErrInterval
+	if interval <= 0 {
+		interval = defaultLimitErrInterval
+	}
+	now := time.Now()
+	if !cl.lastErrTime.IsZero() && now.Sub(cl.lastErrTime) < interval {
+		return false
+	}
+	cl.lastErrTime = now
+	return true
+}
+
+// getConnLimiter 获取链接的限流状态(只在链接读取Goroutine中调用)
+func (l *RateLimiter) getConnLimiter(conn IConnection) *connLimiter {
+	if v, ok := conn.GetProperty(limiterPropertyKey); ok {
+		return v.(*connLimiter)
+	}
+
+	cl := &connLimiter{
+		msgIdBucket: make(map[uint32]*TokenBucket),
+	}
+	if l.option.MsgRate.IsEnabled() {
+		cl.msgBucket = NewTokenBucket(l.option.MsgRate.Rate, l.option.MsgRate.Burst)
+	}
+	if l.option.ByteRate.IsEnabled() {
+		cl.byteBucket = NewTokenBucket(l.option.ByteRate.Rate, l.option.ByteRate.Burst)
+	}
+	conn.SetProperty(limiterPropertyKey, cl)
+	return cl
+}
@@ -0,0 +1,357 @@
+package gnet
+
+import (
+	"bufio"
+	"fmt"
+	"go.uber.org/atomic"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MetricsMgr 全局消息指标统计，按消息ID记录请求数、错误数、Panic数、处理耗时、队列等待时长以及收发字节数，
+// 并汇总已注册链接管理器的链接数量，可按Prometheus文本格式导出(实现http.Handler，配置HttpServer.MetricsPath后由ghttp.Server挂载)
+var MetricsMgr = NewMetrics()
+
+// metricsBuckets 耗时直方图的分桶上限(秒)
+var metricsBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// Metrics 消息指标统计
+type Metrics struct {
+	enabled  atomic.Bool
+	msgIds   sync.Map // 消息ID => *msgIdMetrics
+	connLock sync.RWMutex
+	connId   uint32                   // 链接管理器注册ID
+	connMgrs map[uint32]*connMgrEntry // 注册ID => 已注册的链接管理器
+}
+
+// connMgrEntry 已注册的链接管理器
+type connMgrEntry struct {
+	protocol string
+	server   string
+	connMgr  *ConnManager
+}
+
+// msgIdMetrics 单个消息ID的指标
+type msgIdMetrics struct {
+	requests   atomic.Uint64
+	errors     atomic.Uint64
+	panics     atomic.Uint64
+	bytesIn    atomic.Uint64
+	bytesOut   atomic.Uint64
+	handleTime histogram
+	queueWait  histogram
+}
+
+// histogram 耗时直方图
+type histogram struct {
+	counts [13]atomic.Uint64 // 每个分桶的计数(最后一个为+Inf)
+	count  atomic.Uint64
+	sum    atomic.Int64 // 总耗时(纳秒)
+}
+
+func (h *histogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(metricsBuckets, seconds)
+	h.counts[i].Inc()
+	h.count.Inc()
+	h.sum.Add(int64(d))
+}
+
+func (h *histogram) stats() HistogramStats {
+	stats := HistogramStats{
+		Count:   h.count.Load(),
+		Sum:     time.Duration(h.sum.Load()),
+		Buckets: make([]uint64, len(h.counts)),
+	}
+	for i := range h.counts {
+		stats.Buckets[i] = h.counts[i].Load()
+	}
+	return stats
+}
+
+// HistogramStats 耗时直方图统计
+type HistogramStats struct {
+	Count   uint64        // 样本数量
+	Sum     time.Duration // 总耗时
+	Buckets []uint64      // 每个分桶的计数(非累计，最后一个为+Inf)
+}
+
+// Avg 平均耗时
+func (s HistogramStats) Avg() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / time.Duration(s.Count)
+}
+
+// Quantile 估算分位耗时(返回所在分桶的上限，超出最大分桶时返回最大分桶上限)
+func (s HistogramStats) Quantile(q float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	target := uint64(q * float64(s.Count))
+	var total uint64
+	for i, n := range s.Buckets {
+		total += n
+		if total > target || total == s.Count {
+			if i >= len(metricsBuckets) {
+				i = len(metricsBuckets) - 1
+			}
+			return time.Duration(metricsBuckets[i] * float64(time.Second))
+		}
+	}
+	return time.Duration(metricsBuckets[len(metricsBuckets)-1] * float64(time.Second))
+}
+
+// MsgIdStats 单个消息ID的指标快照
+type MsgIdStats struct {
+	MsgId      uint32
+	Route      string
+	Requests   uint64         // 请求数
+	Errors     uint64         // 错误数(解码失败、返回错误消息)
+	Panics     uint64         // 处理器Panic数
+	BytesIn    uint64         // 收到的消息体字节数
+	BytesOut   uint64         // 发送的消息体字节数
+	HandleTime HistogramStats // 处理耗时
+	QueueWait  HistogramStats // Worker队列等待时长
+}
+
+// ConnStats 链接管理器的链接数量快照
+type ConnStats struct {
+	Id       uint32 // 注册ID(同一进程中可能有多个同协议、同名称的服务器)
+	Protocol string
+	Server   string
+	Conns    int32 // 当前链接数
+	Bound    int   // 已绑定用户的链接数
+}
+
+// NewMetrics 创建消息指标统计(默认开启)
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		connMgrs: make(map[uint32]*connMgrEntry),
+	}
+	m.enabled.Store(true)
+	return m
+}
+
+// SetEnabled 设置是否开启指标统计
+func (m *Metrics) SetEnabled(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+// IsEnabled 是否开启了指标统计
+func (m *Metrics) IsEnabled() bool {
+	return m.enabled.Load()
+}
+
+// RegisterConnMgr 注册链接管理器，导出其链接数量，返回注册ID(服务器停止时使用该ID取消注册)
+func (m *Metrics) RegisterConnMgr(protocol string, server string, connMgr *ConnManager) uint32 {
+	m.connLock.Lock()
+	defer m.connLock.Unlock()
+
+	m.connId++
+	m.connMgrs[m.connId] = &connMgrEntry{protocol: protocol, server: server, connMgr: connMgr}
+	return m.connId
+}
+
+// UnregisterConnMgr 根据注册ID取消注册链接管理器
+func (m *Metrics) UnregisterConnMgr(id uint32) {
+	m.connLock.Lock()
+	defer m.connLock.Unlock()
+
+	delete(m.connMgrs, id)
+}
+
+func (m *Metrics) get(msgId uint32) *msgIdMetrics {
+	if v, ok := m.msgIds.Load(msgId); ok {
+		return v.(*msgIdMetrics)
+	}
+	v, _ := m.msgIds.LoadOrStore(msgId, &msgIdMetrics{})
+	return v.(*msgIdMetrics)
+}
+
+// OnRecv 记录收到的消息体字节数(只记录已注册路由的消息ID，防止客户端构造大量消息ID)
+func (m *Metrics) OnRecv(msgId uint32, n int) {
+	if !m.IsEnabled() || RouteItemMgr.GetRoute(msgId) == "" {
+		return
+	}
+	m.get(msgId).bytesIn.Add(uint64(n))
+}
+
+// OnSend 记录发送的消息体字节数
+func (m *Metrics) OnSend(msgId uint32, n int) {
+	if !m.IsEnabled() {
+		return
+	}
+	m.get(msgId).bytesOut.Add(uint64(n))
+}
+
+// OnHandled 记录消息处理完成及处理耗时
+func (m *Metrics) OnHandled(msgId uint32, d time.Duration) {
+	if !m.IsEnabled() {
+		return
+	}
+	metrics := m.get(msgId)
+	metrics.requests.Inc()
+	metrics.handleTime.observe(d)
+}
+
+// OnError 记录消息处理错误
+func (m *Metrics) OnError(msgId uint32) {
+	if !m.IsEnabled() {
+		return
+	}
+	m.get(msgId).errors.Inc()
+}
+
+// OnPanic 记录消息处理器Panic
+func (m *Metrics) OnPanic(msgId uint32) {
+	if !m.IsEnabled() {
+		return
+	}
+	m.get(msgId).panics.Inc()
+}
+
+// OnQueueWait 记录消息在Worker队列中的等待时长(只记录已注册路由的消息ID)
+func (m *Metrics) OnQueueWait(msgId uint32, d time.Duration) {
+	if !m.IsEnabled() || RouteItemMgr.GetRoute(msgId) == "" {
+		return
+	}
+	m.get(msgId).queueWait.observe(d)
+}
+
+// Reset 清空全部消息指标
+func (m *Metrics) Reset() {
+	m.msgIds.Range(func(k, v interface{}) bool {
+		m.msgIds.Delete(k)
+		return true
+	})
+}
+
+// GetMsgIdStats 获取全部消息ID的指标快照(按消息ID排序)
+func (m *Metrics) GetMsgIdStats() []MsgIdStats {
+	var list []MsgIdStats
+	m.msgIds.Range(func(k, v interface{}) bool {
+		msgId, metrics := k.(uint32), v.(*msgIdMetrics)
+		list = append(list, MsgIdStats{
+			MsgId:      msgId,
+			Route:      RouteItemMgr.GetRoute(msgId),
+			Requests:   metrics.requests.Load(),
+			Errors:     metrics.errors.Load(),
+			Panics:     metrics.panics.Load(),
+			BytesIn:    metrics.bytesIn.Load(),
+			BytesOut:   metrics.bytesOut.Load(),
+			HandleTime: metrics.handleTime.stats(),
+			QueueWait:  metrics.queueWait.stats(),
+		})
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].MsgId < list[j].MsgId
+	})
+	return list
+}
+
+// GetConnStats 获取已注册链接管理器的链接数量快照(按协议、名称、注册ID排序)
+func (m *Metrics) GetConnStats() []ConnStats {
+	m.connLock.RLock()
+	defer m.connLock.RUnlock()
+
+	list := make([]ConnStats, 0, len(m.connMgrs))
+	for id, entry := range m.connMgrs {
+		list = append(list, ConnStats{
+			Id:       id,
+			Protocol: entry.protocol,
+			Server:   entry.server,
+			Conns:    entry.connMgr.Len(),
+			Bound:    entry.connMgr.BindLen(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Protocol != list[j].Protocol {
+			return list[i].Protocol < list[j].Protocol
+		}
+		if list[i].Server != list[j].Server {
+			return list[i].Server < list[j].Server
+		}
+		return list[i].Id < list[j].Id
+	})
+	return list
+}
+
+// WritePrometheus 按Prometheus文本格式导出全部指标
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	msgIdStats := m.GetMsgIdStats()
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(s *MsgIdStats) uint64
+	}{
+		{"gnet_msg_requests_total", "Total number of handled messages.", func(s *MsgIdStats) uint64 { return s.Requests }},
+		{"gnet_msg_errors_total", "Total number of messages failed to decode or replied with an error.", func(s *MsgIdStats) uint64 { return s.Errors }},
+		{"gnet_msg_panics_total", "Total number of handler panics.", func(s *MsgIdStats) uint64 { return s.Panics }},
+		{"gnet_msg_received_bytes_total", "Total bytes of received message bodies.", func(s *MsgIdStats) uint64 { return s.BytesIn }},
+		{"gnet_msg_sent_bytes_total", "Total bytes of sent message bodies.", func(s *MsgIdStats) uint64 { return s.BytesOut }},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		for i := range msgIdStats {
+			fmt.Fprintf(bw, "%s{%s} %d\n", c.name, msgIdLabels(&msgIdStats[i]), c.value(&msgIdStats[i]))
+		}
+	}
+
+	histograms := []struct {
+		name  string
+		help  string
+		value func(s *MsgIdStats) HistogramStats
+	}{
+		{"gnet_msg_handle_seconds", "Message handler latency in seconds.", func(s *MsgIdStats) HistogramStats { return s.HandleTime }},
+		{"gnet_msg_queue_wait_seconds", "Time messages wait in the worker queue in seconds.", func(s *MsgIdStats) HistogramStats { return s.QueueWait }},
+	}
+	for _, h := range histograms {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+		for i := range msgIdStats {
+			labels := msgIdLabels(&msgIdStats[i])
+			stats := h.value(&msgIdStats[i])
+			var total uint64
+			for j, n := range stats.Buckets {
+				total += n
+				le := "+Inf"
+				if j < len(metricsBuckets) {
+					le = strconv.FormatFloat(metricsBuckets[j], 'g', -1, 64)
+				}
+				fmt.Fprintf(bw, "%s_bucket{%s,le=\"%s\"} %d\n", h.name, labels, le, total)
+			}
+			fmt.Fprintf(bw, "%s_sum{%s} %s\n", h.name, labels, strconv.FormatFloat(stats.Sum.Seconds(), 'g', -1, 64))
+			fmt.Fprintf(bw, "%s_count{%s} %d\n", h.name, labels, stats.Count)
+		}
+	}
+
+	connStats := m.GetConnStats()
+	fmt.Fprintf(bw, "# HELP gnet_connections Number of current connections.\n# TYPE gnet_connections gauge\n")
+	for _, s := range connStats {
+		fmt.Fprintf(bw, "gnet_connections{protocol=%q,server=%q,id=\"%d\"} %d\n", s.Protocol, s.Server, s.Id, s.Conns)
+	}
+	fmt.Fprintf(bw, "# HELP gnet_bound_connections Number of connections bound to a user.\n# TYPE gnet_bound_connections gauge\n")
+	for _, s := range connStats {
+		fmt.Fprintf(bw, "gnet_bound_connections{protocol=%q,server=%q,id=\"%d\"} %d\n", s.Protocol, s.Server, s.Id, s.Bound)
+	}
+
+	return bw.Flush()
+}
+
+func msgIdLabels(s *MsgIdStats) string {
+	return fmt.Sprintf("msg_id=\"%d\",route=%q", s.MsgId, s.Route)
+}
+
+// ServeHTTP 实现http.Handler，按Prometheus文本格式输出全部指标
+func (m *Metrics) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.WritePrometheus(resp)
+}
@@ -15,8 +15,17 @@ package gnet
 //|---dataLen---|-----msgId-----|-------Msg------|
 //|----------------------------------------------|
 
+// 开启序列号扩展包头后(用于请求/响应关联):
+//|--------------------head---------------------|-----body-------|
+//|---4 bytes---|----4 bytes----|----4 bytes----|-----dataLen----|
+//|--------------------------------------------------------------|
+//|---dataLen---|-----msgId-----|-----seqId-----|-------Msg------|
+//|--------------------------------------------------------------|
+
 type Msg struct {
 	ID      uint32 // 消息ID
+	SeqId   uint32 // 请求序列号(0表示非请求/响应消息)
+	Flags   uint16 // 标志位(仅携带标志位的封包格式有效)
 	DataLen uint32 // 消息内容的长度
 	Data    []byte // 消息内容
 }
@@ -39,6 +48,26 @@ func (m *Msg) SetMsgId(msgId uint32) {
 	m.ID = msgId
 }
 
+// GetSeqId 获取请求序列号
+func (m *Msg) GetSeqId() uint32 {
+	return m.SeqId
+}
+
+// SetSeqId 设置请求序列号
+func (m *Msg) SetSeqId(seqId uint32) {
+	m.SeqId = seqId
+}
+
+// GetFlags 获取标志位
+func (m *Msg) GetFlags() uint16 {
+	return m.Flags
+}
+
+// SetFlags 设置标志位
+func (m *Msg) SetFlags(flags uint16) {
+	m.Flags = flags
+}
+
 // GetData 获取消息内容
 func (m *Msg) GetData() []byte {
 	return m.Data
@@ -63,6 +92,12 @@ func (m *Msg) WithMsgId(msgId uint32) *Msg {
 	return m
 }
 
+// WithSeqId 携带请求序列号
+func (m *Msg) WithSeqId(seqId uint32) *Msg {
+	m.SetSeqId(seqId)
+	return m
+}
+
 // GetDataLen 获取消息内容段长度
 func (m *Msg) GetDataLen() uint32 {
 	return m.DataLen
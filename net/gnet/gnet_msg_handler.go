@@ -1,8 +1,11 @@
 package gnet
 
 import (
+	"context"
 	"fmt"
 	"github.com/Ravior/gserver/os/glog"
+	"go.uber.org/atomic"
+	"time"
 )
 
 var (
@@ -10,13 +13,26 @@ var (
 	defaultWorkerTaskSize uint32 = 1024
 )
 
-// MsgHandler 消息处理器模块，msgHandler会有多个worker回来同时处理消息，conn发送的消息通过connId取模落入到某一个worker处理
+// MsgHandler 消息处理器模块，msgHandler会有多个worker回来同时处理消息，消息通过分发Key(默认为connId)取模落入到某一个worker处理，
+// 分发Key相同的消息由同一个worker严格按顺序处理；指定的消息ID由单独的串行world worker处理
 type MsgHandler struct {
 	WorkerPoolSize uint32          // 业务工作Worker池的数量
 	WorkerTaskSize uint32          // 每个Worker的可等待执行Task数量
 	TaskQueue      []chan *Request // Worker负责取任务的消息队列
 	TaskExit       []chan bool
-	Router         *Router // 路由
+	Router         *Router             // 路由
+	CallMgr        *CallMgr            // 请求/响应关联管理器, 响应消息将直接交给等待的请求, 不进入Worker
+	Limiter        *RateLimiter        // 链接限流器, 超出限流的消息不进入Worker
+	DispatchKey    DispatchKeyFunc     // 消息分发Key函数, 为nil时按链接ID分发
+	WorldMsgIds    map[uint32]struct{} // 由world worker串行处理的消息ID
+	WorldQueue     chan *Request       // world worker的消息队列
+	WorldExit      chan bool
+	Overflow       OverflowOption // Worker队列溢出配置
+	onQueueEvent   QueueEventFunc // Worker队列事件Hook函数
+	counter        queueCounter   // Worker队列计数器
+	highWater      []atomic.Bool  // 每个Worker队列是否处于高水位
+	pending        atomic.Int32   // 已进入队列但还未处理完成的消息数量
+	draining       atomic.Bool    // 是否正在排空队列(排空期间不再接收新消息)
 }
 
 func NewMsgHandler(workerPoolSize uint32, workerTaskSize uint32) *MsgHandler {
@@ -34,6 +50,8 @@ func NewMsgHandler(workerPoolSize uint32, workerTaskSize uint32) *MsgHandler {
 		// 一个worker对应一个queue
 		TaskQueue: make([]chan *Request, workerPoolSize),
 		TaskExit:  make([]chan bool, workerPoolSize),
+		// 最后一个为world worker
+		highWater: make([]atomic.Bool, workerPoolSize+1),
 	}
 }
 
@@ -56,6 +74,29 @@ func (mh *MsgHandler) SetRouter(router *Router) {
 	mh.Router = router
 }
 
+// SetCallMgr 设置请求/响应关联管理器
+func (mh *MsgHandler) SetCallMgr(callMgr *CallMgr) {
+	mh.CallMgr = callMgr
+}
+
+// SetLimiter 设置链接限流器
+func (mh *MsgHandler) SetLimiter(limiter *RateLimiter) {
+	mh.Limiter = limiter
+}
+
+// SetDispatchKey 设置消息分发Key函数(如按用户ID、房间ID分发)，需在StartWorkerPool之前设置
+func (mh *MsgHandler) SetDispatchKey(dispatchKey DispatchKeyFunc) {
+	mh.DispatchKey = dispatchKey
+}
+
+// SetWorldMsgIds 设置由world worker串行处理的消息ID(如全服排行、拍卖行)，需在StartWorkerPool之前设置
+func (mh *MsgHandler) SetWorldMsgIds(msgIds ...uint32) {
+	mh.WorldMsgIds = make(map[uint32]struct{}, len(msgIds))
+	for _, msgId := range msgIds {
+		mh.WorldMsgIds[msgId] = struct{}{}
+	}
+}
+
 // StartWorkerPool 启动worker工作池
 func (mh *MsgHandler) StartWorkerPool() {
 	glog.Debug("StartWork Worker Pool, Worker Num:", mh.WorkerPoolSize)
@@ -67,6 +108,13 @@ func (mh *MsgHandler) StartWorkerPool() {
 		// 启动当前Worker，阻塞的等待对应的任务队列是否有消息传递进来
 		go mh.startOneWorker(i, mh.TaskQueue[i], mh.TaskExit[i])
 	}
+
+	// 配置了world消息时，启动world worker
+	if len(mh.WorldMsgIds) > 0 {
+		mh.WorldQueue = make(chan *Request, mh.WorkerTaskSize)
+		mh.WorldExit = make(chan bool, 1)
+		go mh.startOneWorker(int(mh.WorkerPoolSize), mh.WorldQueue, mh.WorldExit)
+	}
 }
 
 // 启动一个Worker工作流程
@@ -75,7 +123,12 @@ func (mh *MsgHandler) startOneWorker(workID int, taskQueue chan *Request, taskEx
 	for {
 		select {
 		case request := <-taskQueue:
+			if !request.enqueueTime.IsZero() {
+				MetricsMgr.OnQueueWait(request.GetMessage().GetMsgId(), time.Since(request.enqueueTime))
+			}
 			mh.HandleMsg(request)
+			request.finish()
+			mh.pending.Dec()
 		case isExit := <-taskExit:
 			if isExit {
 				glog.Debugf("Worker ID: %d Exit", workID)
@@ -91,12 +144,58 @@ func (mh *MsgHandler) StopWorkerPool() {
 		mh.TaskExit[i] <- true
 		close(mh.TaskExit[i])
 	}
+	if mh.WorldExit != nil {
+		mh.WorldExit <- true
+		close(mh.WorldExit)
+	}
 }
 
 // SendMsgToTaskQueue 将消息交给TaskQueue,由worker进行处理
 func (mh *MsgHandler) SendMsgToTaskQueue(request *Request) {
-	//根据ConnID来分配当前的连接应该由哪个worker负责处理
-	//得到需要处理此条连接的workerID
-	workerID := request.GetConnection().GetConnID() % mh.WorkerPoolSize
-	mh.TaskQueue[workerID] <- request
+	// 等待中请求的响应消息，直接交给请求方
+	if mh.CallMgr != nil && mh.CallMgr.Dispatch(request.GetMessage()) {
+		return
+	}
+	MetricsMgr.OnRecv(request.GetMessage().GetMsgId(), len(request.GetMessage().GetData()))
+
+	// 超出限流的消息按限流策略处理，不进入Worker
+	if mh.Limiter != nil && !mh.Limiter.Allow(request) {
+		return
+	}
+
+	// 排空队列期间丢弃新消息
+	if mh.draining.Load() {
+		glog.Warnf("MsgHandler is draining, drop msg, MsgId:%d, ConnId:%d", request.GetMessage().GetMsgId(), request.GetConnId())
+		return
+	}
+
+	workerID, queue := mh.getTaskQueue(request)
+	mh.enqueue(workerID, queue, request)
+}
+
+// getTaskQueue 获取处理消息的Worker ID及队列
+func (mh *MsgHandler) getTaskQueue(request *Request) (int, chan *Request) {
+	if mh.WorldQueue != nil {
+		if _, ok := mh.WorldMsgIds[request.GetMessage().GetMsgId()]; ok {
+			return int(mh.WorkerPoolSize), mh.WorldQueue
+		}
+	}
+
+	// 根据分发Key来分配当前的消息应该由哪个worker负责处理
+	var key uint64
+	if mh.DispatchKey != nil {
+		key = mh.DispatchKey(request)
+	} else {
+		key = DispatchByConnId(request)
+	}
+	workerID := int(key % uint64(mh.WorkerPoolSize))
+	return workerID, mh.TaskQueue[workerID]
+}
+
+// Drain 停止接收新消息，并等待队列中已有的消息全部处理完成或者ctx超时/取消
+func (mh *MsgHandler) Drain(ctx context.Context) error {
+	mh.draining.Store(true)
+	return WaitUntil(ctx, func() bool {
+		return mh.pending.Load() <= 0
+	})
 }
@@ -0,0 +1,192 @@
+package gnet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Ravior/gserver/crypto/gcrc32"
+	"github.com/Ravior/gserver/util/gserialize"
+	"github.com/Ravior/gserver/util/gutil"
+	"github.com/golang/protobuf/proto"
+	"reflect"
+	"sort"
+)
+
+// 消息ID默认为 crc32(Proto全名)，也可以通过以下两种方式显式指定(优先级从高到低):
+// 1. 注册表: RouteItemMgr.RegisterMsgIds(map[string]uint32{"pb.LoginReq": 1001})
+// 2. Proto消息选项: 在proto文件中定义 extend google.protobuf.MessageOptions { uint32 msg_id = 50001; }，
+//    在消息中声明 option (msg_id) = 1001; 并调用 RouteItemMgr.SetMsgIdOption(pb.E_MsgId)
+// 显式指定的消息ID需在AddRoute之前设置，两个不同的Proto使用同一个消息ID时AddRoute直接Panic
+
+var (
+	ErrMsgIdDuplicate = errors.New("msg id is duplicate")
+	ErrMsgIdCollision = errors.New("msg id collision")
+)
+
+// SetMsgIdOption 设置指定消息ID的Proto消息选项(uint32类型的MessageOptions扩展)
+func (m *msgRouteMgr) SetMsgIdOption(option *proto.ExtensionDesc) {
+	m.Lock()
+	defer m.Unlock()
+	m.msgIdOption = option
+	m.idCache = make(map[string]uint32)
+}
+
+// RegisterMsgId 显式指定Proto对应的消息ID
+func (m *msgRouteMgr) RegisterMsgId(proto string, msgId uint32) error {
+	m.Lock()
+	defer m.Unlock()
+	return m.registerMsgId(proto, msgId)
+}
+
+// RegisterMsgIds 按注册表显式指定消息ID，遇到重复或冲突时返回错误
+func (m *msgRouteMgr) RegisterMsgIds(table map[string]uint32) error {
+	m.Lock()
+	defer m.Unlock()
+
+	// 按Proto名称排序，保证错误信息稳定
+	protos := make([]string, 0, len(table))
+	for proto := range table {
+		protos = append(protos, proto)
+	}
+	sort.Strings(protos)
+	for _, proto := range protos {
+		if err := m.registerMsgId(proto, table[proto]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *msgRouteMgr) registerMsgId(proto string, msgId uint32) error {
+	if gutil.IsEmpty(proto) || msgId == 0 {
+		return errors.New(fmt.Sprintf("register msg id invalid, Proto:%s, MsgId:%d", proto, msgId))
+	}
+	if old, ok := m.explicitIds[proto]; ok && old != msgId {
+		return fmt.Errorf("%w, Proto:%s, MsgId:%d/%d", ErrMsgIdDuplicate, proto, old, msgId)
+	}
+	if old, ok := m.protoMap[proto]; ok && old != msgId {
+		return fmt.Errorf("%w, Proto:%s has been routed with MsgId:%d", ErrMsgIdDuplicate, proto, old)
+	}
+	for other, id := range m.explicitIds {
+		if id == msgId && other != proto {
+			return fmt.Errorf("%w, MsgId:%d, Proto:%s/%s", ErrMsgIdDuplicate, msgId, other, proto)
+		}
+	}
+	if other, ok := m.idProtos[msgId]; ok && other != proto {
+		return fmt.Errorf("%w, MsgId:%d, Proto:%s/%s", ErrMsgIdCollision, msgId, other, proto)
+	}
+	m.explicitIds[proto] = msgId
+	delete(m.idCache, proto)
+	return nil
+}
+
+// resolveMsgId 计算Proto对应的消息ID，并检测是否与已添加的路由冲突
+func (m *msgRouteMgr) resolveMsgId(proto string, msg reflect.Type) (uint32, error) {
+	msgId, ok := m.explicitIds[proto]
+	if !ok {
+		msgId, ok = m.optionMsgId(msg)
+	}
+	if !ok {
+		msgId = gcrc32.Encrypt(proto)
+	}
+
+	if old, ok := m.protoMap[proto]; ok && old != msgId {
+		return 0, fmt.Errorf("%w, Proto:%s, MsgId:%d/%d", ErrMsgIdDuplicate, proto, old, msgId)
+	}
+	if other, ok := m.idProtos[msgId]; ok && other != proto {
+		return 0, fmt.Errorf("%w, MsgId:%d, Proto:%s/%s", ErrMsgIdCollision, msgId, other, proto)
+	}
+	return msgId, nil
+}
+
+// optionMsgId 读取Proto消息选项中指定的消息ID
+func (m *msgRouteMgr) optionMsgId(msg reflect.Type) (uint32, bool) {
+	if m.msgIdOption == nil || msg == nil || msg.Kind() != reflect.Ptr {
+		return 0, false
+	}
+	pb, ok := reflect.New(msg.Elem()).Interface().(proto.Message)
+	if !ok {
+		return 0, false
+	}
+	return m.optionMsgIdOf(pb)
+}
+
+// optionMsgIdOf 读取Proto消息实例的消息选项中指定的消息ID
+func (m *msgRouteMgr) optionMsgIdOf(pb proto.Message) (uint32, bool) {
+	if m.msgIdOption == nil || pb == nil {
+		return 0, false
+	}
+	options, ok := proto.MessageV2(pb).ProtoReflect().Descriptor().Options().(proto.Message)
+	if !ok || !proto.HasExtension(options, m.msgIdOption) {
+		return 0, false
+	}
+	value, err := proto.GetExtension(options, m.msgIdOption)
+	if err != nil {
+		return 0, false
+	}
+	// proto3定义的扩展值为uint32，proto2定义的扩展值为*uint32
+	switch v := value.(type) {
+	case uint32:
+		return v, v > 0
+	case *uint32:
+		if v != nil {
+			return *v, *v > 0
+		}
+	}
+	return 0, false
+}
+
+// GetMsgIdOf 获取Proto消息对应的消息ID，与AddRoute相同按 路由表 → 注册表 → 消息选项 → crc32 的顺序解析，
+// 用于未添加路由的消息(如响应消息)，解析结果会被缓存
+func (m *msgRouteMgr) GetMsgIdOf(msg proto.Message) uint32 {
+	name := gserialize.Protobuf.GetMessageName(msg)
+	if msgId, ok := m.loadTable().protos[name]; ok {
+		return msgId
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	return m.lookupMsgId(name, msg)
+}
+
+// lookupMsgId 解析未添加路由的Proto对应的消息ID，msg为nil时不读取消息选项，也不缓存结果
+func (m *msgRouteMgr) lookupMsgId(name string, msg proto.Message) uint32 {
+	if msgId, ok := m.explicitIds[name]; ok {
+		return msgId
+	}
+	if msgId, ok := m.idCache[name]; ok {
+		return msgId
+	}
+	msgId, ok := m.optionMsgIdOf(msg)
+	if !ok {
+		msgId = gcrc32.Encrypt(name)
+	}
+	if msg != nil {
+		m.idCache[name] = msgId
+	}
+	return msgId
+}
+
+// GetRoutes 获取全部路由，按消息ID、路由排序
+func (m *msgRouteMgr) GetRoutes() []*RouteItem {
+	m.Lock()
+	defer m.Unlock()
+
+	routes := make([]*RouteItem, 0, len(m.routes))
+	for _, route := range m.routes {
+		item := *route
+		routes = append(routes, &item)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].MsgId != routes[j].MsgId {
+			return routes[i].MsgId < routes[j].MsgId
+		}
+		return routes[i].Route < routes[j].Route
+	})
+	return routes
+}
+
+// ExportJSON 导出全部路由(按消息ID排序)，供客户端或代码生成工具使用
+func (m *msgRouteMgr) ExportJSON() ([]byte, error) {
+	return json.MarshalIndent(m.GetRoutes(), "", "  ")
+}
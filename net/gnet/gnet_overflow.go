@@ -0,0 +1,182 @@
+package gnet
+
+import (
+	"github.com/Ravior/gserver/os/glog"
+	"go.uber.org/atomic"
+	"time"
+)
+
+// OverflowPolicy Worker队列已满时的处理策略
+type OverflowPolicy uint8
+
+const (
+	OverflowBlock      OverflowPolicy = iota // 阻塞等待队列空闲(可设置超时时间，超时后丢弃新消息)
+	OverflowDropNewest                       // 丢弃新消息
+	OverflowDropOldest                       // 丢弃队列中最早的消息，新消息入队
+	OverflowDisconnect                       // 丢弃新消息，并断开发送方链接
+)
+
+// QueueEventType Worker队列事件类型
+type QueueEventType uint8
+
+const (
+	QueueHighWater QueueEventType = iota + 1 // 队列长度达到高水位
+	QueueOverflow                            // 队列已满，按处理策略丢弃了消息
+)
+
+// OverflowOption Worker队列溢出配置
+type OverflowOption struct {
+	Policy        OverflowPolicy // 队列已满时的处理策略
+	BlockTimeout  time.Duration  // OverflowBlock策略的最长等待时间(0表示一直等待)
+	HighWaterMark int            // 队列长度高水位，达到该值时触发QueueHighWater事件(0表示不检测)
+}
+
+// QueueEvent Worker队列事件
+type QueueEvent struct {
+	Type     QueueEventType // 事件类型
+	WorkerId int            // Worker ID(等于WorkerPoolSize时为world worker)
+	QueueLen int            // 当前队列长度
+	Policy   OverflowPolicy // 队列溢出处理策略
+	Dropped  *Request       // 被丢弃的消息(QueueOverflow事件)
+}
+
+// QueueEventFunc Worker队列事件Hook函数(在链接读取Goroutine中同步调用，不能阻塞)
+type QueueEventFunc func(event *QueueEvent)
+
+// QueueStats Worker队列统计
+type QueueStats struct {
+	Enqueued  uint64 // 入队消息数量
+	Dropped   uint64 // 因队列溢出丢弃的消息数量
+	Blocked   uint64 // 入队时队列已满需要等待的次数
+	HighWater uint64 // 达到高水位的次数
+}
+
+// queueCounter Worker队列计数器
+type queueCounter struct {
+	enqueued  atomic.Uint64
+	dropped   atomic.Uint64
+	blocked   atomic.Uint64
+	highWater atomic.Uint64
+}
+
+// SetOverflow 设置Worker队列溢出配置
+func (mh *MsgHandler) SetOverflow(option OverflowOption) {
+	mh.Overflow = option
+}
+
+// SetOnQueueEvent 设置Worker队列事件Hook函数，可用于监控Worker是否饱和
+func (mh *MsgHandler) SetOnQueueEvent(onQueueEvent QueueEventFunc) {
+	mh.onQueueEvent = onQueueEvent
+}
+
+// GetQueueStats 获取Worker队列统计
+func (mh *MsgHandler) GetQueueStats() QueueStats {
+	return QueueStats{
+		Enqueued:  mh.counter.enqueued.Load(),
+		Dropped:   mh.counter.dropped.Load(),
+		Blocked:   mh.counter.blocked.Load(),
+		HighWater: mh.counter.highWater.Load(),
+	}
+}
+
+// GetQueueLens 获取每个Worker当前的队列长度(最后一个为world worker)
+func (mh *MsgHandler) GetQueueLens() []int {
+	lens := make([]int, 0, len(mh.TaskQueue)+1)
+	for _, queue := range mh.TaskQueue {
+		lens = append(lens, len(queue))
+	}
+	if mh.WorldQueue != nil {
+		lens = append(lens, len(mh.WorldQueue))
+	}
+	return lens
+}
+
+// enqueue 按溢出配置将消息放入Worker队列
+func (mh *MsgHandler) enqueue(workerID int, queue chan *Request, request *Request) {
+	mh.pending.Inc()
+	if MetricsMgr.IsEnabled() {
+		request.enqueueTime = time.Now()
+	}
+	select {
+	case queue <- request:
+		mh.onEnqueued(workerID, queue)
+		return
+	default:
+	}
+
+	switch mh.Overflow.Policy {
+	case OverflowDropOldest:
+		// 先尝试入队，队列仍满时丢弃最早的一条消息(Worker可能同时取出消息，因此不能在同一个select中竞争)
+		for {
+			select {
+			case queue <- request:
+				mh.onEnqueued(workerID, queue)
+				return
+			default:
+			}
+			select {
+			case oldest := <-queue:
+				mh.drop(workerID, queue, oldest)
+			default:
+			}
+		}
+	case OverflowDropNewest:
+		mh.drop(workerID, queue, request)
+	case OverflowDisconnect:
+		mh.drop(workerID, queue, request)
+		request.GetConnection().Stop()
+	default:
+		mh.counter.blocked.Inc()
+		glog.Warnf("Worker task queue is full, waiting, WorkerId:%d, MsgId:%d, ConnId:%d", workerID, request.GetMessage().GetMsgId(), request.GetConnId())
+		if mh.Overflow.BlockTimeout <= 0 {
+			queue <- request
+			mh.onEnqueued(workerID, queue)
+			return
+		}
+
+		timer := time.NewTimer(mh.Overflow.BlockTimeout)
+		defer timer.Stop()
+		select {
+		case queue <- request:
+			mh.onEnqueued(workerID, queue)
+		case <-timer.C:
+			mh.drop(workerID, queue, request)
+		}
+	}
+}
+
+// onEnqueued 消息入队后更新计数，并检测高水位
+func (mh *MsgHandler) onEnqueued(workerID int, queue chan *Request) {
+	mh.counter.enqueued.Inc()
+	if mh.Overflow.HighWaterMark <= 0 {
+		return
+	}
+
+	// 每次越过高水位只触发一次事件，回落到高水位以下后重置
+	queueLen := len(queue)
+	if queueLen < mh.Overflow.HighWaterMark {
+		if mh.highWater[workerID].Load() {
+			mh.highWater[workerID].Store(false)
+		}
+		return
+	}
+	if !mh.highWater[workerID].CAS(false, true) {
+		return
+	}
+	mh.counter.highWater.Inc()
+	glog.Warnf("Worker task queue reaches high water mark, WorkerId:%d, QueueLen:%d", workerID, queueLen)
+	if mh.onQueueEvent != nil {
+		mh.onQueueEvent(&QueueEvent{Type: QueueHighWater, WorkerId: workerID, QueueLen: queueLen, Policy: mh.Overflow.Policy})
+	}
+}
+
+// drop 丢弃消息
+func (mh *MsgHandler) drop(workerID int, queue chan *Request, request *Request) {
+	request.finish()
+	mh.pending.Dec()
+	mh.counter.dropped.Inc()
+	glog.Warnf("Worker task queue is full, drop msg, WorkerId:%d, Policy:%d, MsgId:%d, ConnId:%d", workerID, mh.Overflow.Policy, request.GetMessage().GetMsgId(), request.GetConnId())
+	if mh.onQueueEvent != nil {
+		mh.onQueueEvent(&QueueEvent{Type: QueueOverflow, WorkerId: workerID, QueueLen: len(queue), Policy: mh.Overflow.Policy, Dropped: request})
+	}
+}
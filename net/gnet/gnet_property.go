@@ -0,0 +1,37 @@
+package gnet
+
+import "sync"
+
+// ConnProperty 链接自定义属性(玩家ID、账号、登录时间等)，各协议链接内嵌该结构实现属性接口
+type ConnProperty struct {
+	propertyLock sync.RWMutex
+	property     map[string]interface{}
+}
+
+// SetProperty 设置链接属性
+func (p *ConnProperty) SetProperty(key string, value interface{}) {
+	p.propertyLock.Lock()
+	defer p.propertyLock.Unlock()
+
+	if p.property == nil {
+		p.property = make(map[string]interface{})
+	}
+	p.property[key] = value
+}
+
+// GetProperty 获取链接属性
+func (p *ConnProperty) GetProperty(key string) (interface{}, bool) {
+	p.propertyLock.RLock()
+	defer p.propertyLock.RUnlock()
+
+	value, ok := p.property[key]
+	return value, ok
+}
+
+// RemoveProperty 删除链接属性
+func (p *ConnProperty) RemoveProperty(key string) {
+	p.propertyLock.Lock()
+	defer p.propertyLock.Unlock()
+
+	delete(p.property, key)
+}
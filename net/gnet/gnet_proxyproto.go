@@ -0,0 +1,249 @@
+package gnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Ravior/gserver/os/glog"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY protocol(HAProxy) 头部格式:
+// v1: "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n" (最长107字节)
+// v2: 签名(12字节)|版本+命令(1字节)|地址族+协议(1字节)|地址长度(2字节)|地址信息
+
+const (
+	proxyV1MaxLen  = 107 // v1头部最大长度
+	proxyV2HeadLen = 16  // v2固定头部长度
+)
+
+var proxyV2Sig = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// defaultProxyHeaderTimeout 默认读取PROXY头部的超时时间
+var defaultProxyHeaderTimeout = 5 * time.Second
+
+var ErrProxyHeader = errors.New("invalid proxy protocol header")
+
+// ProxyProtocol PROXY protocol(v1/v2)解析，只解析来自可信上游(负载均衡)的链接，防止客户端伪造头部
+type ProxyProtocol struct {
+	lock    sync.RWMutex
+	trusted []*net.IPNet  // 可信上游IP段(为空表示不信任任何来源)
+	timeout time.Duration // 读取头部的超时时间
+}
+
+// NewProxyProtocol 创建PROXY protocol解析，trusted为可信上游IP段(如 10.0.0.0/8、172.16.0.1)
+func NewProxyProtocol(trusted []string) (*ProxyProtocol, error) {
+	p := &ProxyProtocol{timeout: defaultProxyHeaderTimeout}
+	if err := p.SetTrustedCIDRs(trusted); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetTrustedCIDRs 设置可信上游IP段，全部解析成功后才会替换，可在运行时重新加载
+func (p *ProxyProtocol) SetTrustedCIDRs(trusted []string) error {
+	nets, err := parseCIDRs(trusted)
+	if err != nil {
+		return err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.trusted = nets
+	return nil
+}
+
+// SetHeaderTimeout 设置读取头部的超时时间
+func (p *ProxyProtocol) SetHeaderTimeout(timeout time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.timeout = timeout
+}
+
+// IsTrusted 判断IP是否为可信上游
+func (p *ProxyProtocol) IsTrusted(ip net.IP) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return containsIp(p.trusted, ip)
+}
+
+// ReadHeader 读取链接的PROXY头部，返回客户端真实地址
+// 非可信上游的链接不读取头部，返回nil；可信上游的链接必须携带头部，LOCAL命令(如健康检查)及未知地址族返回nil
+// 头部按字节精确读取，不会读取头部之后的业务数据
+func (p *ProxyProtocol) ReadHeader(conn net.Conn) (net.Addr, error) {
+	if !p.IsTrusted(AddrIp(conn.RemoteAddr())) {
+		return nil, nil
+	}
+
+	p.lock.RLock()
+	timeout := p.timeout
+	p.lock.RUnlock()
+	if timeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	head := make([]byte, proxyV2HeadLen, proxyV1MaxLen)
+	if _, err := io.ReadFull(conn, head[:len(proxyV2Sig)]); err != nil {
+		return nil, err
+	}
+	if bytes.Equal(head[:len(proxyV2Sig)], proxyV2Sig) {
+		if _, err := io.ReadFull(conn, head[len(proxyV2Sig):]); err != nil {
+			return nil, err
+		}
+		return readProxyV2(conn, head)
+	}
+	if bytes.HasPrefix(head, []byte("PROXY ")) {
+		return readProxyV1(conn, head[:len(proxyV2Sig)])
+	}
+	return nil, ErrProxyHeader
+}
+
+// readProxyV1 读取并解析v1文本头部，line为已读取的部分
+func readProxyV1(conn net.Conn, line []byte) (net.Addr, error) {
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyV1MaxLen {
+			return nil, ErrProxyHeader
+		}
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return nil, err
+		}
+		line = append(line, b[0])
+	}
+
+	// PROXY TCP4|TCP6 srcIp dstIp srcPort dstPort 或 PROXY UNKNOWN ...
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrProxyHeader
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid proxy protocol v1 address: %s %s", fields[2], fields[4]))
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 读取并解析v2二进制头部，head为已读取的固定头部
+func readProxyV2(conn net.Conn, head []byte) (net.Addr, error) {
+	verCmd, family := head[12], head[13]
+	if verCmd>>4 != 2 {
+		return nil, ErrProxyHeader
+	}
+	data := make([]byte, binary.BigEndian.Uint16(head[14:16]))
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return nil, err
+	}
+
+	switch verCmd & 0x0F {
+	case 0x00: // LOCAL
+		return nil, nil
+	case 0x01: // PROXY
+	default:
+		return nil, ErrProxyHeader
+	}
+
+	// 地址族: 0x1 IPv4, 0x2 IPv6，其余(UNSPEC、UNIX)保留原地址；TLV扩展忽略
+	switch family >> 4 {
+	case 0x1:
+		if len(data) < 12 {
+			return nil, ErrProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(data[0:4]), Port: int(binary.BigEndian.Uint16(data[8:10]))}, nil
+	case 0x2:
+		if len(data) < 36 {
+			return nil, ErrProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(data[0:16]), Port: int(binary.BigEndian.Uint16(data[32:34]))}, nil
+	}
+	return nil, nil
+}
+
+// ProxyConn 携带PROXY头部中客户端真实地址的链接
+type ProxyConn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+// RemoteAddr 客户端真实地址
+func (c *ProxyConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// ProxyListener 解析PROXY头部的监听器，头部在独立的协程中读取，慢速链接不会阻塞Accept
+type ProxyListener struct {
+	net.Listener
+	proxy *ProxyProtocol
+	conns chan net.Conn
+	errs  chan error
+	done  chan struct{}
+	err   error
+}
+
+// NewProxyListener 包装监听器，Accept返回的链接RemoteAddr为客户端真实地址
+func NewProxyListener(l net.Listener, proxy *ProxyProtocol) *ProxyListener {
+	pl := &ProxyListener{
+		Listener: l,
+		proxy:    proxy,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error, 1),
+		done:     make(chan struct{}),
+	}
+	go pl.run()
+	return pl
+}
+
+// run 循环Accept，监听器出错后结束，之后的Accept均返回该错误
+func (l *ProxyListener) run() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.err = err
+			// 非关闭错误先转发给正在等待的Accept(缓冲管道，调用方不再Accept时不会阻塞)
+			if !errors.Is(err, net.ErrClosed) {
+				l.errs <- err
+			}
+			close(l.done)
+			return
+		}
+		go l.handle(conn)
+	}
+}
+
+func (l *ProxyListener) handle(conn net.Conn) {
+	addr, err := l.proxy.ReadHeader(conn)
+	if err != nil {
+		glog.Warnf("Read proxy protocol header has error: %s, Addr:%s", err.Error(), conn.RemoteAddr())
+		_ = conn.Close()
+		return
+	}
+	if addr != nil {
+		conn = &ProxyConn{Conn: conn, remoteAddr: addr}
+	}
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		_ = conn.Close()
+	}
+}
+
+// Accept 返回已解析头部的链接
+func (l *ProxyListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, l.err
+	}
+}
@@ -0,0 +1,229 @@
+package gnet
+
+import (
+	"errors"
+	"github.com/Ravior/gserver/os/glog"
+	"go.uber.org/atomic"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	ErrReconnectBufferFull = errors.New("reconnect buffer is full")
+	ErrReconnectStopped    = errors.New("reconnect has been stopped")
+)
+
+// ReconnectPolicy 断线重连策略(指数退避+随机抖动)
+type ReconnectPolicy struct {
+	InitialDelay time.Duration // 首次重连等待时长
+	MaxDelay     time.Duration // 最大重连等待时长
+	Multiplier   float64       // 退避倍数
+	Jitter       float64       // 随机抖动比例(0~1)，等待时长在 delay*(1±Jitter) 范围内随机
+	MaxAttempts  int           // 单次断线最大重连次数(0表示不限制)
+	BufferSize   int           // 断线期间缓存的待发送消息数量上限(0表示不缓存)
+}
+
+// DefaultReconnectPolicy 默认断线重连策略: 1秒起步，2倍退避，最长30秒，20%抖动，不限重连次数
+func DefaultReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		InitialDelay: time.Second,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+}
+
+// Delay 获取第attempt次(从1开始)重连前的等待时长
+func (p *ReconnectPolicy) Delay(attempt int) time.Duration {
+	delay := float64(p.InitialDelay)
+	for i := 1; i < attempt; i++ {
+		delay *= p.Multiplier
+		if p.MaxDelay > 0 && delay >= float64(p.MaxDelay) {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay *= 1 + p.Jitter*(rand.Float64()*2-1)
+	}
+	return time.Duration(delay)
+}
+
+// DialFunc 建立链接函数
+type DialFunc func() (IConnection, error)
+
+// ReconnectFailFunc 达到最大重连次数后的Hook函数
+type ReconnectFailFunc func(attempts int, err error)
+
+// Reconnector 断线重连组件，按重连策略重新建立链接，并在断线期间缓存待发送消息
+type Reconnector struct {
+	policy          *ReconnectPolicy
+	dial            DialFunc
+	onReconnect     ConnCallback      // 重连成功Hook函数(在发送缓存消息之前调用)
+	onReconnectFail ReconnectFailFunc // 重连失败Hook函数
+	running         atomic.Bool       // 是否正在重连
+	stopped         atomic.Bool       // 是否已停止
+	stopOnce        sync.Once
+	stopChan        chan struct{}
+	bufferLock      sync.Mutex
+	buffer          []*Msg // 断线期间缓存的待发送消息
+}
+
+// NewReconnector 创建断线重连组件
+func NewReconnector(policy *ReconnectPolicy, dial DialFunc, onReconnect ConnCallback, onReconnectFail ReconnectFailFunc) *Reconnector {
+	if policy == nil {
+		policy = DefaultReconnectPolicy()
+	}
+	return &Reconnector{
+		policy:          policy,
+		dial:            dial,
+		onReconnect:     onReconnect,
+		onReconnectFail: onReconnectFail,
+		stopChan:        make(chan struct{}),
+	}
+}
+
+// GetPolicy 获取重连策略
+func (r *Reconnector) GetPolicy() *ReconnectPolicy {
+	return r.policy
+}
+
+// IsReconnecting 是否正在重连(重连成功后直到缓存消息发送完成前仍处于重连状态)
+func (r *Reconnector) IsReconnecting() bool {
+	return r.running.Load()
+}
+
+// Trigger 开始重连(已在重连中或者已停止则忽略)
+func (r *Reconnector) Trigger() {
+	if r.stopped.Load() || !r.running.CAS(false, true) {
+		return
+	}
+	go r.loop()
+}
+
+// Stop 停止重连，并丢弃缓存的待发送消息
+func (r *Reconnector) Stop() {
+	r.stopOnce.Do(func() {
+		r.stopped.Store(true)
+		close(r.stopChan)
+
+		r.bufferLock.Lock()
+		r.buffer = nil
+		r.bufferLock.Unlock()
+	})
+}
+
+// Send 链接可用时直接发送消息，断线及重连期间(直到缓存消息发送完成)缓存消息，待重连成功后按顺序发送
+func (r *Reconnector) Send(conn IConnection, msgId uint32, data []byte) error {
+	r.bufferLock.Lock()
+	if !r.running.Load() && conn != nil && !conn.IsClosed() {
+		r.bufferLock.Unlock()
+		return conn.SendMsg(msgId, data)
+	}
+	defer r.bufferLock.Unlock()
+
+	if r.stopped.Load() {
+		return ErrReconnectStopped
+	}
+	if len(r.buffer) >= r.policy.BufferSize {
+		return ErrReconnectBufferFull
+	}
+	r.buffer = append(r.buffer, NewMsg(msgId, data))
+	return nil
+}
+
+// BufferLen 当前缓存的待发送消息数量
+func (r *Reconnector) BufferLen() int {
+	r.bufferLock.Lock()
+	defer r.bufferLock.Unlock()
+	return len(r.buffer)
+}
+
+func (r *Reconnector) loop() {
+	var err error
+	for attempt := 1; r.policy.MaxAttempts <= 0 || attempt <= r.policy.MaxAttempts; attempt++ {
+		delay := r.policy.Delay(attempt)
+		glog.Infof("Reconnect after %v, Attempt:%d", delay, attempt)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-r.stopChan:
+			timer.Stop()
+			r.running.Store(false)
+			return
+		}
+
+		var conn IConnection
+		conn, err = r.dial()
+		if err != nil {
+			glog.Warnf("Reconnect fail, Attempt:%d, Err:%v", attempt, err)
+			continue
+		}
+
+		glog.Infof("Reconnect success, Attempt:%d, Addr:%s", attempt, conn.RemoteAddr())
+		if r.onReconnect != nil {
+			r.onReconnect(conn)
+		}
+		if r.flush(conn) {
+			// 结束重连后链接才断开时，断开触发的Trigger可能被忽略，需要再次检测
+			if conn.IsClosed() {
+				r.Trigger()
+			}
+			return
+		}
+
+		// 新链接在重连Hook或发送缓存消息期间断开，重新开始重连
+		glog.Warnf("Reconnected connection closed before buffered msgs flushed, Addr:%s", conn.RemoteAddr())
+		attempt = 0
+	}
+
+	r.running.Store(false)
+	glog.Errorf("Reconnect fail, reach max attempts:%d, Err:%v", r.policy.MaxAttempts, err)
+	if r.onReconnectFail != nil {
+		r.onReconnectFail(r.policy.MaxAttempts, err)
+	}
+}
+
+// flush 按顺序发送断线期间缓存的消息，全部发送完成后结束重连状态(与Send互斥，保证新消息在缓存消息之后发送)
+// 链接在发送期间断开时，未发送的消息放回缓存并返回false
+func (r *Reconnector) flush(conn IConnection) bool {
+	for {
+		r.bufferLock.Lock()
+		if conn.IsClosed() {
+			r.bufferLock.Unlock()
+			return false
+		}
+		buffer := r.buffer
+		r.buffer = nil
+		if len(buffer) == 0 {
+			r.running.Store(false)
+			r.bufferLock.Unlock()
+			return true
+		}
+		r.bufferLock.Unlock()
+
+		for i, msg := range buffer {
+			if err := conn.SendMsg(msg.GetMsgId(), msg.GetData()); err != nil {
+				if conn.IsClosed() {
+					r.requeue(buffer[i:])
+					return false
+				}
+				glog.Warnf("Send buffered msg fail, MsgId:%d, Err:%v", msg.GetMsgId(), err)
+			}
+		}
+	}
+}
+
+// requeue 将未发送的消息放回缓存头部
+func (r *Reconnector) requeue(msgs []*Msg) {
+	r.bufferLock.Lock()
+	defer r.bufferLock.Unlock()
+	if r.stopped.Load() {
+		return
+	}
+	r.buffer = append(msgs, r.buffer...)
+}
@@ -1,9 +1,18 @@
 package gnet
 
+import (
+	"errors"
+	"github.com/Ravior/gserver/os/glog"
+	"github.com/golang/protobuf/proto"
+	"time"
+)
+
 // Request 请求抽象
 type Request struct {
-	Conn IConnection // 已经和客户端建立好的 链接
-	Msg  *Msg        // 客户端请求的数据
+	Conn        IConnection // 已经和客户端建立好的 链接
+	Msg         *Msg        // 客户端请求的数据
+	enqueueTime time.Time   // 进入Worker队列的时间
+	done        func()      // 消息处理完成(或被丢弃)时的回调
 }
 
 func NewRequest(conn IConnection, msg *Msg) *Request {
@@ -13,6 +22,13 @@ func NewRequest(conn IConnection, msg *Msg) *Request {
 	}
 }
 
+// finish 消息处理完成(或被丢弃)
+func (r *Request) finish() {
+	if r.done != nil {
+		r.done()
+	}
+}
+
 // GetConnection 获取连接信息
 func (r *Request) GetConnection() IConnection {
 	return r.Conn
@@ -27,3 +43,36 @@ func (r *Request) GetConnId() uint32 {
 func (r *Request) GetMessage() *Msg {
 	return r.Msg
 }
+
+// GetSeqId 获取请求序列号
+func (r *Request) GetSeqId() uint32 {
+	return r.Msg.GetSeqId()
+}
+
+// Reply 响应请求，响应消息会携带请求的序列号，消息ID根据响应消息解析(与路由相同的规则)，使用链接的编解码器编码
+func (r *Request) Reply(msg proto.Message) error {
+	if msg == nil {
+		return errors.New("reply nil msg")
+	}
+	data, err := GetCodec(r.Conn).Marshal(msg)
+	if err != nil {
+		return err
+	}
+	msgId := RouteItemMgr.GetMsgIdOf(msg)
+	return r.Conn.SendSeqMsg(msgId, r.GetSeqId(), data)
+}
+
+// ReplyError 以标准错误消息响应请求，错误码取自gerror携带的gcode.Code
+func (r *Request) ReplyError(err error) error {
+	if err == nil {
+		return errors.New("reply nil error")
+	}
+	MetricsMgr.OnError(r.Msg.GetMsgId())
+	// 完整错误链只记录在服务器日志中，客户端只收到错误码及最外层错误信息
+	glog.Warnf("Reply error msg, MsgId:%d, ConnId:%d, Error:%s", r.Msg.GetMsgId(), r.GetConnId(), err.Error())
+	data, err := encodeErrorMsg(GetCodec(r.Conn), NewErrorMsg(r.Msg.GetMsgId(), err))
+	if err != nil {
+		return err
+	}
+	return r.Conn.SendSeqMsg(ErrorMsgId, r.GetSeqId(), data)
+}
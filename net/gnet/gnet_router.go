@@ -3,7 +3,6 @@ package gnet
 import (
 	"errors"
 	"fmt"
-	"github.com/Ravior/gserver/crypto/gcrc32"
 	"github.com/Ravior/gserver/os/glog"
 	"github.com/Ravior/gserver/util/gserialize"
 	"github.com/Ravior/gserver/util/gutil"
@@ -11,23 +10,29 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// HandlerCallback 消息处理函数，支持以下两种形式:
+// func(*Request, *Req)：需在函数内自行响应
+// func(*Request, *Req) (*Resp, error)：返回的Resp自动作为响应发送，返回错误时发送标准错误消息(ErrorMsg)
 type HandlerCallback interface{}
 type HandlerFunc func(request *Request, msg proto.Message)
 type MiddlewareFunc func(HandlerFunc) HandlerFunc
 
 // 路由组
 type Group struct {
+	router     *Router
 	prefix     string
 	hMap       map[string]HandlerFunc
 	hMapMidd   map[string][]MiddlewareFunc
 	middleware []MiddlewareFunc
 }
 
-// AddRoute 添加路由
+// AddRoute 添加路由，运行期间可添加或替换同名路由
 func (g *Group) AddRoute(path string, callback HandlerCallback, middleware ...MiddlewareFunc) {
-	err, funValue, msgType := checkMsgRouteCallback(callback)
+	err, funValue, msgType, typed := checkMsgRouteCallback(callback)
 	if err != nil {
 		glog.Errorf("AddRoute Error: %v， %v", err, funValue)
 		return
@@ -37,15 +42,26 @@ func (g *Group) AddRoute(path string, callback HandlerCallback, middleware ...Mi
 	route := fmt.Sprintf("%s.%s", g.prefix, path)
 	RouteItemMgr.AddRoute(msgName, route, reflect.TypeOf(msg))
 
+	g.router.lock.Lock()
+	defer g.router.lock.Unlock()
+
 	g.hMap[path] = func(request *Request, msg2 proto.Message) {
-		funValue.Call([]reflect.Value{reflect.ValueOf(request), reflect.ValueOf(msg2)})
+		results := funValue.Call([]reflect.Value{reflect.ValueOf(request), reflect.ValueOf(msg2)})
+		if typed {
+			replyResults(request, results)
+		}
 	}
 	g.hMapMidd[path] = middleware
+	g.router.invalidate()
 }
 
 // Use 全局中间件
 func (g *Group) Use(middleware ...MiddlewareFunc) *Group {
+	g.router.lock.Lock()
+	defer g.router.lock.Unlock()
+
 	g.middleware = append(g.middleware, middleware...)
+	g.router.invalidate()
 	return g
 }
 
@@ -70,40 +86,27 @@ func (g *Group) applyMiddleware(name string) HandlerFunc {
 	return h
 }
 
-func (g *Group) exec(name string, req *Request) {
-	msgType, ok := RouteItemMgr.msgIdMap[req.GetMessage().GetMsgId()]
-	if !ok {
-		glog.Errorf("RouteItemMgr.msgIdMap Not Found MsgId: %d", req.GetMessage().GetMsgId())
-		return
-	}
-
+func (g *Group) exec(msgType reflect.Type, h HandlerFunc, req *Request) {
 	msg := reflect.New(msgType.Elem()).Interface().(proto.Message)
-	err := gserialize.Protobuf.Unmarshal(req.GetMessage().GetData(), msg)
+	err := GetCodec(req.GetConnection()).Unmarshal(req.GetMessage().GetData(), msg)
 	if err != nil {
 		glog.Errorf("unmarshal message error: %v", err)
+		MetricsMgr.OnError(req.GetMessage().GetMsgId())
 		return
 	}
 	gutil.NiceCallFunc(func() {
-		h := g.applyMiddleware(name)
-		if h == nil {
-			glog.Debug("Router Msg Handler Miss, MsgId:", req.GetMessage().GetMsgId())
-		} else {
-			defer func() {
-				if err := recover(); err != nil {
-					e := fmt.Sprintf("%v", err)
-					glog.Errorf("handler msg has err:%v", e)
-				}
-			}()
-			h(req, msg)
-		}
+		defer func() {
+			if err := recover(); err != nil {
+				e := fmt.Sprintf("%v", err)
+				glog.Errorf("handler msg has err:%v", e)
+				MetricsMgr.OnPanic(req.GetMessage().GetMsgId())
+			}
+		}()
+		h(req, msg)
 	})
 }
 
-var RouteItemMgr = &msgRouteMgr{
-	routes:   make([]*RouteItem, 0),
-	protoMap: make(map[string]uint32),
-	msgIdMap: make(map[uint32]reflect.Type),
-}
+var RouteItemMgr = newMsgRouteMgr()
 
 type RouteItem struct {
 	MsgId uint32 `json:"msgId"`
@@ -111,11 +114,43 @@ type RouteItem struct {
 	Route string `json:"route"`
 }
 
+// routeEntry 消息ID对应的路由
+type routeEntry struct {
+	route   string       // 完整路由 prefix.name
+	prefix  string       // 路由组前缀
+	name    string       // 路由名称
+	msgType reflect.Type // 消息类型
+}
+
+// routeTable 路由表快照，修改时整体替换(读取无需加锁)
+type routeTable struct {
+	version uint64
+	entries map[uint32]*routeEntry
+	protos  map[string]uint32
+	routes  map[string]uint32 // 路由 => 消息ID
+}
+
 type msgRouteMgr struct {
 	sync.Mutex
-	routes   []*RouteItem
-	protoMap map[string]uint32
-	msgIdMap map[uint32]reflect.Type
+	routes      []*RouteItem
+	protoMap    map[string]uint32
+	explicitIds map[string]uint32    // 显式指定的消息ID(注册表)
+	idProtos    map[uint32]string    // 已使用的消息ID对应的Proto名称(用于检测冲突)
+	msgIdOption *proto.ExtensionDesc // 指定消息ID的Proto消息选项
+	idCache     map[string]uint32    // 未添加路由的Proto解析出的消息ID缓存
+	table       atomic.Value         // 路由表快照 *routeTable
+}
+
+func newMsgRouteMgr() *msgRouteMgr {
+	m := &msgRouteMgr{
+		routes:      make([]*RouteItem, 0),
+		protoMap:    make(map[string]uint32),
+		explicitIds: make(map[string]uint32),
+		idProtos:    make(map[uint32]string),
+		idCache:     make(map[string]uint32),
+	}
+	m.table.Store(&routeTable{version: 1, entries: make(map[uint32]*routeEntry), protos: make(map[string]uint32), routes: make(map[string]uint32)})
+	return m
 }
 
 func (m *msgRouteMgr) Init() {
@@ -126,75 +161,224 @@ func (m *msgRouteMgr) reload() {
 	m.routes = m.routes[0:0]
 }
 
+// AddRoute 添加路由，消息ID冲突时直接Panic(启动时尽早暴露问题)
 func (m *msgRouteMgr) AddRoute(proto string, route string, msg reflect.Type) {
 	m.Lock()
 	defer m.Unlock()
 
-	msgId := gcrc32.Encrypt(proto)
+	msgId, err := m.resolveMsgId(proto, msg)
+	if err != nil {
+		glog.Errorf("AddRoute Error: %v", err)
+		panic(err)
+	}
 	router := &RouteItem{
 		MsgId: msgId,
 		Proto: proto,
 		Route: route,
 	}
-	if !gutil.IsEmpty(proto) {
-		m.protoMap[proto] = msgId
-		m.msgIdMap[msgId] = msg
+	if gutil.IsEmpty(proto) {
+		m.routes = append(m.routes, router)
+		return
+	}
+	// 运行期间替换路由时原地替换，GetRoutes、ExportJSON不会出现重复的消息ID
+	var oldRoute string
+	replaced := false
+	for i, item := range m.routes {
+		if item.MsgId == msgId && item.Proto == proto {
+			oldRoute = item.Route
+			m.routes[i] = router
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		m.routes = append(m.routes, router)
+	}
+	m.protoMap[proto] = msgId
+	m.idProtos[msgId] = proto
+
+	// 复制路由表后整体替换，同一消息ID以最后添加的路由为准
+	old := m.loadTable()
+	table := &routeTable{
+		version: old.version + 1,
+		entries: make(map[uint32]*routeEntry, len(old.entries)+1),
+		protos:  make(map[string]uint32, len(old.protos)+1),
+		routes:  make(map[string]uint32, len(old.routes)+1),
+	}
+	for id, entry := range old.entries {
+		table.entries[id] = entry
+	}
+	for name, id := range old.protos {
+		table.protos[name] = id
+	}
+	for name, id := range old.routes {
+		table.routes[name] = id
+	}
+	if oldRoute != route && table.routes[oldRoute] == msgId {
+		delete(table.routes, oldRoute)
+	}
+	table.entries[msgId] = newRouteEntry(route, msg)
+	table.protos[proto] = msgId
+	table.routes[route] = msgId
+	m.table.Store(table)
+}
+
+func newRouteEntry(route string, msgType reflect.Type) *routeEntry {
+	entry := &routeEntry{route: route, name: route, msgType: msgType}
+	sArr := strings.Split(route, ".")
+	if len(sArr) == 2 {
+		entry.prefix = sArr[0]
+		entry.name = sArr[1]
+	}
+	return entry
+}
+
+// loadTable 获取路由表快照
+func (m *msgRouteMgr) loadTable() *routeTable {
+	return m.table.Load().(*routeTable)
+}
+
+// GetMsgId 根据Proto名称获取消息ID，Proto已注册到全局注册表时同样读取消息选项，已有消息实例时优先使用GetMsgIdOf
+func (m *msgRouteMgr) GetMsgId(name string) uint32 {
+	if msgId, ok := m.loadTable().protos[name]; ok {
+		return msgId
+	}
+
+	var msg proto.Message
+	if msgType := proto.MessageType(name); msgType != nil && msgType.Kind() == reflect.Ptr {
+		msg, _ = reflect.New(msgType.Elem()).Interface().(proto.Message)
 	}
 
-	m.routes = append(m.routes, router)
+	m.Lock()
+	defer m.Unlock()
+	return m.lookupMsgId(name, msg)
+}
+
+// GetMsgIdByRoute 根据路由(prefix.name)获取消息ID
+func (m *msgRouteMgr) GetMsgIdByRoute(route string) (uint32, bool) {
+	msgId, ok := m.loadTable().routes[route]
+	return msgId, ok
 }
 
 func (m *msgRouteMgr) GetRoute(msgId uint32) string {
-	for _, route := range m.routes {
-		if route.MsgId == msgId {
-			return route.Route
-		}
+	if entry, ok := m.loadTable().entries[msgId]; ok {
+		return entry.route
 	}
 	return ""
 }
 
-// Router 路由器
+// Router 路由器，消息ID到处理链(已应用中间件)的映射预先计算并整体替换，运行期间可安全地添加、替换路由
 type Router struct {
-	groups []*Group
+	lock     sync.Mutex
+	groups   []*Group
+	handlers atomic.Value // 消息ID对应的处理链 *handlerTable
+}
+
+// handlerTable 消息ID对应的处理链，路由表版本变化后重新计算
+type handlerTable struct {
+	version  uint64
+	handlers map[uint32][]func(req *Request)
 }
 
 func (r *Router) Group(prefix string) *Group {
 	g := &Group{
+		router:   r,
 		prefix:   prefix,
 		hMap:     make(map[string]HandlerFunc),
 		hMapMidd: make(map[string][]MiddlewareFunc),
 	}
 
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
 	r.groups = append(r.groups, g)
+	r.invalidate()
 	return g
 }
 
 func (r *Router) Run(req *Request) {
 	msgId := req.GetMessage().GetMsgId()
-	route := RouteItemMgr.GetRoute(msgId)
-	if gutil.IsEmpty(route) {
+	handlers := r.getHandlers(msgId)
+	if len(handlers) == 0 {
+		glog.Debug("Router Msg Handler Miss, MsgId:", msgId)
 		return
 	}
+	start := time.Now()
+	for _, h := range handlers {
+		h(req)
+	}
+	MetricsMgr.OnHandled(msgId, time.Since(start))
+}
 
-	prefix := ""
-	msgName := route
-	sArr := strings.Split(route, ".")
-	if len(sArr) == 2 {
-		prefix = sArr[0]
-		msgName = sArr[1]
+// getHandlers 获取消息ID对应的处理链
+func (r *Router) getHandlers(msgId uint32) []func(req *Request) {
+	routes := RouteItemMgr.loadTable()
+	table, ok := r.handlers.Load().(*handlerTable)
+	if !ok || table.version != routes.version {
+		table = r.rebuild(routes)
 	}
+	return table.handlers[msgId]
+}
 
-	for _, g := range r.groups {
-		if g.prefix == prefix {
-			g.exec(msgName, req)
-		} else if g.prefix == "*" {
-			g.exec(msgName, req)
+// rebuild 根据路由表重新计算全部处理链
+func (r *Router) rebuild(routes *routeTable) *handlerTable {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if table, ok := r.handlers.Load().(*handlerTable); ok && table.version == routes.version {
+		return table
+	}
+
+	table := &handlerTable{
+		version:  routes.version,
+		handlers: make(map[uint32][]func(req *Request), len(routes.entries)),
+	}
+	for msgId, entry := range routes.entries {
+		var handlers []func(req *Request)
+		for _, g := range r.groups {
+			if g.prefix != entry.prefix && g.prefix != "*" {
+				continue
+			}
+			if h := g.applyMiddleware(entry.name); h != nil {
+				g, msgType := g, entry.msgType
+				handlers = append(handlers, func(req *Request) {
+					g.exec(msgType, h, req)
+				})
+			}
+		}
+		if len(handlers) > 0 {
+			table.handlers[msgId] = handlers
 		}
 	}
+	r.handlers.Store(table)
+	return table
+}
+
+// invalidate 路由组变化后使处理链失效(需持有锁)
+func (r *Router) invalidate() {
+	r.handlers.Store(&handlerTable{})
 }
 
-// 检查形如 func(arg0, proto.Message)
-func checkMsgRouteCallback(cb interface{}) (err error, funValue reflect.Value, msgType reflect.Type) {
+// replyResults 将 func(*Request, *Req) (*Resp, error) 的返回值作为响应发送
+func replyResults(request *Request, results []reflect.Value) {
+	var err error
+	if e, ok := results[1].Interface().(error); ok && e != nil {
+		err = request.ReplyError(e)
+	} else if !results[0].IsNil() {
+		err = request.Reply(results[0].Interface().(proto.Message))
+	}
+	if err != nil {
+		glog.Errorf("reply message error: %v, MsgId:%d, ConnId:%d", err, request.GetMessage().GetMsgId(), request.GetConnId())
+	}
+}
+
+var (
+	protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+	errorType        = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// 检查形如 func(arg0, proto.Message) 或 func(arg0, proto.Message) (proto.Message, error)
+func checkMsgRouteCallback(cb interface{}) (err error, funValue reflect.Value, msgType reflect.Type, typed bool) {
 	cbType := reflect.TypeOf(cb)
 	if cbType.Kind() != reflect.Func {
 		err = errors.New("callback not a func")
@@ -218,6 +402,23 @@ func checkMsgRouteCallback(cb interface{}) (err error, funValue reflect.Value, m
 		return
 	}
 
+	switch cbType.NumOut() {
+	case 0:
+	case 2:
+		if cbType.Out(0).Kind() != reflect.Ptr || !cbType.Out(0).Implements(protoMessageType) {
+			err = errors.New("callback result0 not proto message ptr")
+			return
+		}
+		if cbType.Out(1) != errorType {
+			err = errors.New("callback result1 not error")
+			return
+		}
+		typed = true
+	default:
+		err = errors.New("callback result num must be 0 or 2")
+		return
+	}
+
 	funValue = reflect.ValueOf(cb)
 
 	return
@@ -0,0 +1,317 @@
+package gnet
+
+import (
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/Ravior/gserver/crypto/gaes"
+	"io"
+	"sync"
+)
+
+// 加密握手流程(ECDH P-256):
+// 1. 客户端发送 HandshakeReqMsgId 消息，消息体为客户端公钥
+// 2. 服务端回复 HandshakeRespMsgId 消息，消息体为服务端公钥
+// 3. 双方根据共享密钥分别派生 客户端->服务端、服务端->客户端 两个AES-256-GCM密钥，之后全部消息体加密传输
+//
+// 注意: 握手双方均使用临时密钥，不验证对端身份，只能防止被动窃听及篡改，无法防止中间人攻击；
+// 需要验证服务器身份时使用TLS(gtcp.Server.SetTLSConfig)
+//
+// 加密后的消息体:
+//|---8 bytes---|-------------body--------------|
+//|-----seq-----|---AES-GCM(body) + 16字节Tag----|
+
+var (
+	HandshakeReqMsgId  uint32 = 0xFFFFFF01 // 加密握手请求消息ID(客户端公钥)
+	HandshakeRespMsgId uint32 = 0xFFFFFF02 // 加密握手响应消息ID(服务端公钥)
+
+	ErrHandshake    = errors.New("secure handshake failed")
+	ErrSecureMsg    = errors.New("secure msg is invalid, unencrypted or replayed")
+	ErrNotHandshake = errors.New("secure session has not been established")
+)
+
+const (
+	secureSeqLen       = 8  // 加密消息序号长度
+	secureReplayWindow = 64 // 防重放窗口大小(允许乱序到达的消息数量)
+)
+
+// SecureSession 加密会话，保存双方派生的密钥以及收发序号
+type SecureSession struct {
+	privateKey []byte
+	publicKey  []byte
+	sendAead   cipher.AEAD
+	recvAead   cipher.AEAD
+	sendLock   sync.Mutex
+	sendSeq    uint64 // 已发送的最大序号
+	recvLock   sync.Mutex
+	recvSeq    uint64 // 已收到的最大序号
+	recvWindow uint64 // 防重放窗口，第i位表示序号 recvSeq-i 已收到
+}
+
+// NewSecureSession 创建加密会话，生成临时ECDH密钥对
+// go.mod最低版本为go 1.17，crypto/ecdh需要go 1.20，因此使用crypto/elliptic实现ECDH(Unmarshal会校验对端公钥在曲线上)
+func NewSecureSession() (*SecureSession, error) {
+	privateKey, x, y, err := elliptic.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &SecureSession{
+		privateKey: privateKey,
+		publicKey:  elliptic.Marshal(elliptic.P256(), x, y),
+	}, nil
+}
+
+// GetPublicKey 获取本端公钥
+func (s *SecureSession) GetPublicKey() []byte {
+	return s.publicKey
+}
+
+// Establish 根据对端公钥计算共享密钥，并派生收发密钥
+func (s *SecureSession) Establish(peerPublicKey []byte, isServer bool) error {
+	curve := elliptic.P256()
+	x, y := elliptic.Unmarshal(curve, peerPublicKey)
+	if x == nil {
+		return ErrHandshake
+	}
+	sx, _ := curve.ScalarMult(x, y, s.privateKey)
+	secret := make([]byte, 32)
+	sx.FillBytes(secret)
+
+	c2s := deriveKey(secret, "gserver client to server")
+	s2c := deriveKey(secret, "gserver server to client")
+	if !isServer {
+		c2s, s2c = s2c, c2s
+	}
+
+	recvAead, err := gaes.NewGCM(c2s)
+	if err != nil {
+		return err
+	}
+	sendAead, err := gaes.NewGCM(s2c)
+	if err != nil {
+		return err
+	}
+	s.recvAead, s.sendAead = recvAead, sendAead
+	return nil
+}
+
+func deriveKey(secret []byte, label string) []byte {
+	h := sha256.New()
+	h.Write(secret)
+	h.Write([]byte(label))
+	return h.Sum(nil)
+}
+
+// IsEstablished 是否已完成握手
+func (s *SecureSession) IsEstablished() bool {
+	return s.sendAead != nil && s.recvAead != nil
+}
+
+// Seal 加密消息体
+func (s *SecureSession) Seal(plainText []byte) ([]byte, error) {
+	if !s.IsEstablished() {
+		return nil, ErrNotHandshake
+	}
+
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+
+	s.sendSeq++
+	out := make([]byte, secureSeqLen, secureSeqLen+len(plainText)+s.sendAead.Overhead())
+	binary.BigEndian.PutUint64(out, s.sendSeq)
+	// 序号同时作为附加数据，防止被篡改
+	return s.sendAead.Seal(out, s.nonce(s.sendAead, s.sendSeq), plainText, out[:secureSeqLen]), nil
+}
+
+// Open 解密消息体，拒绝未加密、被篡改以及重放的消息
+func (s *SecureSession) Open(data []byte) ([]byte, error) {
+	if !s.IsEstablished() {
+		return nil, ErrNotHandshake
+	}
+	if len(data) < secureSeqLen+s.recvAead.Overhead() {
+		return nil, ErrSecureMsg
+	}
+
+	s.recvLock.Lock()
+	defer s.recvLock.Unlock()
+
+	seq := binary.BigEndian.Uint64(data)
+	if !s.checkReplay(seq) {
+		return nil, ErrSecureMsg
+	}
+	plainText, err := s.recvAead.Open(nil, s.nonce(s.recvAead, seq), data[secureSeqLen:], data[:secureSeqLen])
+	if err != nil {
+		return nil, ErrSecureMsg
+	}
+	s.markReceived(seq)
+	return plainText, nil
+}
+
+func (s *SecureSession) nonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-secureSeqLen:], seq)
+	return nonce
+}
+
+// checkReplay 检测序号是否可以接收(未收到过且在防重放窗口内)
+func (s *SecureSession) checkReplay(seq uint64) bool {
+	if seq == 0 {
+		return false
+	}
+	if seq > s.recvSeq {
+		return true
+	}
+	diff := s.recvSeq - seq
+	if diff >= secureReplayWindow {
+		return false
+	}
+	return s.recvWindow&(1<<diff) == 0
+}
+
+// markReceived 标记序号已收到
+func (s *SecureSession) markReceived(seq uint64) {
+	if seq > s.recvSeq {
+		shift := seq - s.recvSeq
+		if shift >= secureReplayWindow {
+			s.recvWindow = 0
+		} else {
+			s.recvWindow <<= shift
+		}
+		s.recvWindow |= 1
+		s.recvSeq = seq
+		return
+	}
+	s.recvWindow |= 1 << (s.recvSeq - seq)
+}
+
+// ServerHandshake 服务端加密握手: 读取客户端公钥，回复服务端公钥
+func ServerHandshake(rw io.ReadWriter, dataPack IDataPack) (*SecureSession, error) {
+	msg, err := ReadMsg(dataPack, rw)
+	if err != nil {
+		return nil, err
+	}
+	if msg.GetMsgId() != HandshakeReqMsgId {
+		return nil, ErrHandshake
+	}
+
+	session, err := NewSecureSession()
+	if err != nil {
+		return nil, err
+	}
+	if err := session.Establish(msg.GetData(), true); err != nil {
+		return nil, err
+	}
+
+	data, err := dataPack.Pack(NewMsg(HandshakeRespMsgId, session.GetPublicKey()))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rw.Write(data); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ClientHandshake 客户端加密握手: 发送客户端公钥，读取服务端公钥
+func ClientHandshake(rw io.ReadWriter, dataPack IDataPack) (*SecureSession, error) {
+	session, err := NewSecureSession()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := dataPack.Pack(NewMsg(HandshakeReqMsgId, session.GetPublicKey()))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rw.Write(data); err != nil {
+		return nil, err
+	}
+
+	msg, err := ReadMsg(dataPack, rw)
+	if err != nil {
+		return nil, err
+	}
+	if msg.GetMsgId() != HandshakeRespMsgId {
+		return nil, ErrHandshake
+	}
+	if err := session.Establish(msg.GetData(), false); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// SecureDataPack 加密封包格式，在原封包格式基础上加密消息体(每个链接单独使用一个实例)
+// 原封包格式为CompressDataPack时先压缩再加密(加密后的数据无法压缩)，读取时先解密再解压
+type SecureDataPack struct {
+	IDataPack
+	session *SecureSession
+}
+
+// NewSecureDataPack 创建加密封包格式，session需已完成握手
+func NewSecureDataPack(dataPack IDataPack, session *SecureSession) *SecureDataPack {
+	return &SecureDataPack{
+		IDataPack: dataPack,
+		session:   session,
+	}
+}
+
+// GetSession 获取加密会话
+func (dp *SecureDataPack) GetSession() *SecureSession {
+	return dp.session
+}
+
+// IsSeqEnabled 是否开启序列号扩展包头(与原封包格式一致)
+func (dp *SecureDataPack) IsSeqEnabled() bool {
+	return IsSeqEnabled(dp.IDataPack)
+}
+
+// Pack 加密消息体后按原封包格式封包
+func (dp *SecureDataPack) Pack(msg *Msg) ([]byte, error) {
+	dataPack := dp.IDataPack
+	if compressPack, ok := dataPack.(*CompressDataPack); ok {
+		compressed, err := compressPack.compress(msg)
+		if err != nil {
+			return nil, err
+		}
+		msg, dataPack = compressed, compressPack.FlagDataPack
+	}
+
+	data, err := dp.session.Seal(msg.GetData())
+	if err != nil {
+		return nil, err
+	}
+
+	// 不修改原消息，广播时同一消息会被多次封包
+	sealed := NewMsg(msg.GetMsgId(), data).WithSeqId(msg.GetSeqId())
+	sealed.SetFlags(msg.GetFlags())
+	return dataPack.Pack(sealed)
+}
+
+// ReadMsg 按原封包格式读取消息后解密消息体
+func (dp *SecureDataPack) ReadMsg(r io.Reader) (*Msg, error) {
+	dataPack := dp.IDataPack
+	compressPack, ok := dataPack.(*CompressDataPack)
+	if ok {
+		dataPack = compressPack.FlagDataPack
+	}
+
+	msg, err := ReadMsg(dataPack, r)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := dp.session.Open(msg.GetData())
+	if err != nil {
+		return nil, err
+	}
+	msg.SetData(data)
+	if ok {
+		if err := compressPack.decompress(msg); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
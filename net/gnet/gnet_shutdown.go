@@ -0,0 +1,40 @@
+package gnet
+
+import (
+	"context"
+	"github.com/Ravior/gserver/os/glog"
+)
+
+// DrainConns 优雅关闭链接: 等待Worker处理完队列中的消息、链接写完缓冲管道中的数据后停止全部链接，
+// 并等待全部OnConnStop回调执行完成。ctx超时/取消后不再等待，直接停止剩余链接并返回ctx的错误
+func DrainConns(ctx context.Context, connMgr *ConnManager, msgHandler *MsgHandler) error {
+	var firstErr error
+	setErr := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// 等待Worker处理完队列中的消息
+	if msgHandler != nil {
+		if err := msgHandler.Drain(ctx); err != nil {
+			glog.Warnf("Drain worker queue has error: %s", err.Error())
+			setErr(err)
+		}
+	}
+
+	// 等待链接写完缓冲管道中的数据
+	connMgr.Range(func(conn IConnection) bool {
+		setErr(conn.Flush(ctx))
+		return true
+	})
+
+	// 停止全部链接，并等待OnConnStop回调执行完成
+	connMgr.ClearConn()
+	if err := connMgr.WaitCallbacks(ctx); err != nil {
+		glog.Warnf("Wait conn stop callbacks has error: %s", err.Error())
+		setErr(err)
+	}
+
+	return firstErr
+}
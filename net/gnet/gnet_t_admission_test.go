@@ -0,0 +1,89 @@
+package gnet
+
+import (
+	"go.uber.org/atomic"
+	"net"
+	"sync"
+	"testing"
+)
+
+func Test_AdmissionPolicy(t *testing.T) {
+	p := NewAdmissionPolicy()
+	if err := p.SetCIDRs([]string{"10.0.0.0/8", "192.168.1.1"}, []string{"10.0.1.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		ip  string
+		err error
+	}{
+		{"10.1.2.3", nil},
+		{"192.168.1.1", nil},
+		{"192.168.1.2", ErrIpDenied},
+		{"10.0.1.5", ErrIpDenied},
+	}
+	for _, c := range cases {
+		if err := p.Admit(net.ParseIP(c.ip)); err != c.err {
+			t.Fatal(c.ip, err)
+		}
+	}
+	if err := p.SetCIDRs([]string{"bad"}, nil); err == nil {
+		t.Fatal("invalid cidr should fail")
+	}
+
+	// 运行时重新加载名单
+	if err := p.SetCIDRs(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	ip := net.ParseIP("192.168.1.2")
+	p.SetMaxConnPerIp(2)
+	if p.Admit(ip) != nil || p.Admit(ip) != nil {
+		t.Fatal("admit fail")
+	}
+	if err := p.Admit(ip); err != ErrIpLimit {
+		t.Fatal(err)
+	}
+	p.Release(ip)
+	if err := p.Admit(ip); err != nil {
+		t.Fatal(err)
+	}
+
+	// 已准入4个链接
+	p.SetMaxConn(4)
+	if err := p.Admit(net.ParseIP("8.8.8.8")); err != ErrServerFull || p.GetConnNum() != 4 {
+		t.Fatal(err, p.GetConnNum())
+	}
+	p.Release(ip)
+	if err := p.Admit(net.ParseIP("8.8.8.8")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_AdmissionPolicy_Concurrent(t *testing.T) {
+	p := NewAdmissionPolicy()
+	p.SetMaxConn(10)
+
+	var admitted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if p.Admit(net.IPv4(10, 0, 0, byte(i))) == nil {
+				admitted.Inc()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if admitted.Load() != 10 || p.GetConnNum() != 10 {
+		t.Fatal(admitted.Load(), p.GetConnNum())
+	}
+}
+
+func Test_AddrIp(t *testing.T) {
+	if ip := AddrIp(&net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 80}); !ip.Equal(net.ParseIP("1.2.3.4")) {
+		t.Fatal(ip)
+	}
+	if ip := AddrIp(&net.UnixAddr{Name: "[::1]:80", Net: "unix"}); !ip.Equal(net.ParseIP("::1")) {
+		t.Fatal(ip)
+	}
+}
@@ -0,0 +1,83 @@
+package gnet
+
+import (
+	"context"
+	"github.com/Ravior/gserver/util/gserialize"
+	"github.com/gogo/protobuf/types"
+	"testing"
+	"time"
+)
+
+// loopConn 测试用链接, 收到请求后原样携带序列号回复
+type loopConn struct {
+	IConnection
+	callMgr  *CallMgr
+	dataPack IDataPack
+	closed   bool
+	silent   bool
+}
+
+func newLoopConn(callMgr *CallMgr, silent bool) *loopConn {
+	dp := NewDataPack()
+	dp.SetSeqEnabled(true)
+	return &loopConn{callMgr: callMgr, dataPack: dp, silent: silent}
+}
+
+func (c *loopConn) GetConnID() uint32                          { return 1 }
+func (c *loopConn) GetProperty(key string) (interface{}, bool) { return nil, false }
+func (c *loopConn) IsClosed() bool                             { return c.closed }
+func (c *loopConn) GetDataPack() IDataPack                     { return c.dataPack }
+func (c *loopConn) SetDataPack(dataPack IDataPack)             { c.dataPack = dataPack }
+func (c *loopConn) SendMsg(msgId uint32, data []byte) error {
+	return c.SendSeqMsg(msgId, 0, data)
+}
+func (c *loopConn) SendSeqMsg(msgId uint32, seqId uint32, data []byte) error {
+	if c.silent {
+		return nil
+	}
+	req := &types.StringValue{}
+	if err := gserialize.Protobuf.Unmarshal(data, req); err != nil {
+		return err
+	}
+	resp, _ := gserialize.Protobuf.Marshal(&types.StringValue{Value: req.Value + "-reply"})
+	go c.callMgr.Dispatch(NewMsg(msgId, resp).WithSeqId(seqId))
+	return nil
+}
+
+func Test_CallMgr_Call(t *testing.T) {
+	callMgr := NewCallMgr()
+	conn := newLoopConn(callMgr, false)
+
+	resp := &types.StringValue{}
+	err := callMgr.Call(context.Background(), conn, 1, &types.StringValue{Value: "gserver"}, resp)
+	if err != nil || resp.Value != "gserver-reply" {
+		t.Fatal(err, resp.Value)
+	}
+}
+
+func Test_CallMgr_NoSeq(t *testing.T) {
+	callMgr := NewCallMgr()
+	conn := newLoopConn(callMgr, false)
+	conn.SetDataPack(NewDataPack())
+
+	err := callMgr.Call(context.Background(), conn, 1, &types.StringValue{Value: "gserver"}, &types.StringValue{})
+	if err != ErrCallNoSeq {
+		t.Fatal(err)
+	}
+}
+
+func Test_CallMgr_Timeout(t *testing.T) {
+	callMgr := NewCallMgr()
+	conn := newLoopConn(callMgr, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := callMgr.Call(ctx, conn, 1, &types.StringValue{Value: "gserver"}, &types.StringValue{})
+	if err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	// 超时后到达的响应不再被消费
+	if callMgr.Dispatch(NewMsg(1, nil).WithSeqId(1)) {
+		t.Fail()
+	}
+}
@@ -0,0 +1,64 @@
+package gnet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_ConnManager_Group(t *testing.T) {
+	connMgr := NewConnManager()
+	conn1 := newStubConn(connMgr, 1)
+	conn2 := newStubConn(connMgr, 2)
+
+	_ = connMgr.JoinGroup("room", conn1)
+	_ = connMgr.JoinGroup("room", conn2)
+	_ = connMgr.JoinGroup("guild", conn1)
+	if connMgr.GroupCount() != 2 || connMgr.GroupLen("room") != 2 {
+		t.Fatal(connMgr.GroupCount(), connMgr.GroupLen("room"))
+	}
+	if !connMgr.IsInGroup("guild", 1) || connMgr.IsInGroup("guild", 2) {
+		t.Fail()
+	}
+	if len(connMgr.GetConnGroups(1)) != 2 {
+		t.Fatal(connMgr.GetConnGroups(1))
+	}
+
+	connMgr.LeaveGroup("room", conn2)
+	if connMgr.GroupLen("room") != 1 {
+		t.Fatal(connMgr.GroupLen("room"))
+	}
+
+	// 断开后自动退出全部分组，空分组被删除
+	conn1.Stop()
+	if connMgr.GroupCount() != 0 || len(connMgr.GetConnGroups(1)) != 0 {
+		t.Fatal(connMgr.GroupCount())
+	}
+	if err := connMgr.JoinGroup("room", conn1); err != ErrConnNotFound {
+		t.Fatal(err)
+	}
+}
+
+func Test_ConnManager_BroadcastToGroup(t *testing.T) {
+	connMgr := NewConnManager()
+	conn1 := newStubConn(connMgr, 1)
+	conn2 := newStubConn(connMgr, 2)
+	conn3 := newStubConn(connMgr, 3)
+	// 相同封包格式的链接共享同一份封包数据
+	conn2.dataPack = conn1.dataPack
+
+	_ = connMgr.JoinGroup("room", conn1)
+	_ = connMgr.JoinGroup("room", conn2)
+	_ = connMgr.JoinGroup("room", conn3)
+	connMgr.BroadcastToGroup("room", 1, []byte("gserver"), 3)
+
+	if len(conn1.sent) != 1 || len(conn2.sent) != 1 || len(conn3.sent) != 0 {
+		t.Fatal(len(conn1.sent), len(conn2.sent), len(conn3.sent))
+	}
+	if &conn1.sent[0][0] != &conn2.sent[0][0] {
+		t.Fatal("payload packed more than once")
+	}
+	msg, err := ReadMsg(conn1.dataPack, bytes.NewReader(conn1.sent[0]))
+	if err != nil || string(msg.GetData()) != "gserver" {
+		t.Fatal(msg, err)
+	}
+}
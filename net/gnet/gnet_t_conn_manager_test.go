@@ -0,0 +1,180 @@
+package gnet
+
+import (
+	"go.uber.org/atomic"
+	"testing"
+	"time"
+)
+
+// stubConn 测试用链接, Stop时从链接管理器中删除
+type stubConn struct {
+	IConnection
+	ConnProperty
+	connID   uint32
+	connMgr  *ConnManager
+	closed   bool
+	dataPack IDataPack
+	sent     [][]byte
+}
+
+func newStubConn(connMgr *ConnManager, connID uint32) *stubConn {
+	conn := &stubConn{connID: connID, connMgr: connMgr, dataPack: NewDataPack()}
+	connMgr.Add(conn)
+	return conn
+}
+
+func (c *stubConn) GetConnID() uint32 { return c.connID }
+func (c *stubConn) IsClosed() bool    { return c.closed }
+func (c *stubConn) GetDataPack() IDataPack {
+	return c.dataPack
+}
+func (c *stubConn) SendPackedMsg(data []byte) error {
+	c.sent = append(c.sent, data)
+	return nil
+}
+func (c *stubConn) Stop() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.connMgr.Remove(c)
+}
+func (c *stubConn) SetProperty(key string, value interface{}) {
+	c.ConnProperty.SetProperty(key, value)
+}
+func (c *stubConn) GetProperty(key string) (interface{}, bool) {
+	return c.ConnProperty.GetProperty(key)
+}
+func (c *stubConn) RemoveProperty(key string) {
+	c.ConnProperty.RemoveProperty(key)
+}
+
+func Test_ConnProperty(t *testing.T) {
+	conn := newStubConn(NewConnManager(), 1)
+	conn.SetProperty("uid", uint64(1001))
+	if v, ok := conn.GetProperty("uid"); !ok || v.(uint64) != 1001 {
+		t.Fatal(v, ok)
+	}
+	conn.RemoveProperty("uid")
+	if _, ok := conn.GetProperty("uid"); ok {
+		t.Fail()
+	}
+}
+
+func Test_ConnManager_Bind(t *testing.T) {
+	connMgr := NewConnManager()
+	conn := newStubConn(connMgr, 1)
+
+	if err := connMgr.Bind(1001, conn); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := connMgr.GetByUid(1001); err != nil || c != conn {
+		t.Fatal(c, err)
+	}
+	if uid, ok := connMgr.GetUid(conn); !ok || uid != 1001 {
+		t.Fatal(uid, ok)
+	}
+
+	// 断开后自动解除绑定
+	conn.Stop()
+	if _, err := connMgr.GetByUid(1001); err != ErrConnNotFound {
+		t.Fatal(err)
+	}
+	if connMgr.BindLen() != 0 || connMgr.Len() != 0 {
+		t.Fatal(connMgr.BindLen(), connMgr.Len())
+	}
+}
+
+// stoppingConn 测试用链接, 首次判断关闭状态时在另一个协程中停止链接
+type stoppingConn struct {
+	IConnection
+	connMgr *ConnManager
+	closed  atomic.Bool
+	checked atomic.Bool
+}
+
+func (c *stoppingConn) GetConnID() uint32 { return 2 }
+func (c *stoppingConn) IsClosed() bool {
+	if c.checked.CAS(false, true) {
+		stopped := make(chan struct{})
+		go func() {
+			c.closed.Store(true)
+			c.connMgr.Remove(c)
+			close(stopped)
+		}()
+		// 等待停止完成(Bind在锁内判断时，停止会等待Bind返回)
+		select {
+		case <-stopped:
+		case <-time.After(50 * time.Millisecond):
+		}
+		return false
+	}
+	return c.closed.Load()
+}
+
+func Test_ConnManager_BindClosing(t *testing.T) {
+	connMgr := NewConnManager()
+	conn := &stoppingConn{connMgr: connMgr}
+	connMgr.Add(conn)
+
+	// 绑定期间链接被停止，不能残留绑定
+	_ = connMgr.Bind(1002, conn)
+	time.Sleep(20 * time.Millisecond)
+	if c, err := connMgr.GetByUid(1002); err != ErrConnNotFound {
+		t.Fatal(c, err)
+	}
+	if err := connMgr.Bind(1002, conn); err != ErrConnNotFound {
+		t.Fatal(err)
+	}
+}
+
+func Test_ConnManager_Unbind(t *testing.T) {
+	connMgr := NewConnManager()
+	conn := newStubConn(connMgr, 1)
+
+	_ = connMgr.Bind(1001, conn)
+	connMgr.Unbind(1001)
+	if _, ok := connMgr.GetUid(conn); ok {
+		t.Fail()
+	}
+	if connMgr.Len() != 1 {
+		t.Fatal(connMgr.Len())
+	}
+}
+
+func Test_ConnManager_KickOld(t *testing.T) {
+	connMgr := NewConnManager()
+	oldConn := newStubConn(connMgr, 1)
+	newConn := newStubConn(connMgr, 2)
+
+	_ = connMgr.Bind(1001, oldConn)
+	if err := connMgr.Bind(1001, newConn); err != nil {
+		t.Fatal(err)
+	}
+	if !oldConn.IsClosed() {
+		t.Fatal("old connection not kicked")
+	}
+	if c, _ := connMgr.GetByUid(1001); c != newConn {
+		t.Fatal(c)
+	}
+}
+
+func Test_ConnManager_RejectNew(t *testing.T) {
+	connMgr := NewConnManager()
+	connMgr.SetDuplicateLogin(func(uid uint64, oldConn IConnection, newConn IConnection) DuplicatePolicy {
+		return RejectNew
+	})
+	oldConn := newStubConn(connMgr, 1)
+	newConn := newStubConn(connMgr, 2)
+
+	_ = connMgr.Bind(1001, oldConn)
+	if err := connMgr.Bind(1001, newConn); err != ErrUidBound {
+		t.Fatal(err)
+	}
+	if oldConn.IsClosed() {
+		t.Fatal("old connection should be kept")
+	}
+	if c, _ := connMgr.GetByUid(1001); c != oldConn {
+		t.Fatal(c)
+	}
+}
@@ -0,0 +1,78 @@
+package gnet
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_CompressDataPack(t *testing.T) {
+	data := []byte(strings.Repeat("gserver", 1000))
+	for _, compressor := range []ICompressor{SnappyCompressor{}, ZlibCompressor{}} {
+		dp := NewCompressDataPack(compressor)
+		dp.SetSeqEnabled(true)
+
+		msg := NewMsg(1001, data).WithSeqId(7)
+		packed, err := dp.Pack(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 压缩后小于最大包长度，且原消息不被修改
+		if uint32(len(packed)) >= msg.GetDataLen() || msg.GetFlags() != 0 {
+			t.Fatal(len(packed), msg.GetFlags())
+		}
+
+		// 读取时自动解压
+		testDataPack(t, dp, msg)
+	}
+}
+
+func Test_CompressDataPack_PackBuffer(t *testing.T) {
+	dp := NewCompressDataPack(nil)
+	msg := NewMsg(1001, []byte(strings.Repeat("gserver", 1000)))
+
+	// 链接发送消息使用PackBuffer，同样需要压缩
+	buf, err := PackBuffer(dp, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.Release()
+	head, err := dp.FlagDataPack.Unpack(buf.B[:dp.GetHeadLen()])
+	if err != nil || head.GetFlags()&FlagCompressSnappy == 0 || head.GetDataLen() >= msg.GetDataLen() {
+		t.Fatal(head, err)
+	}
+	got, err := ReadMsg(dp, bytes.NewReader(buf.B))
+	if err != nil || !bytes.Equal(got.GetData(), msg.GetData()) {
+		t.Fatal(err)
+	}
+}
+
+func Test_CompressDataPack_Threshold(t *testing.T) {
+	dp := NewCompressDataPack(nil)
+	dp.SetThreshold(100)
+
+	packed, err := dp.Pack(NewMsg(1001, []byte("gserver")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := dp.FlagDataPack.Unpack(packed[:dp.GetHeadLen()])
+	if err != nil || msg.GetFlags() != 0 {
+		t.Fatal(msg, err)
+	}
+}
+
+func Test_CompressDataPack_MaxDecompressedLen(t *testing.T) {
+	data := []byte(strings.Repeat("gserver", 1000))
+	for _, compressor := range []ICompressor{SnappyCompressor{}, ZlibCompressor{}} {
+		dp := NewCompressDataPack(compressor)
+		dp.SetMaxDecompressedLen(1024)
+
+		packed, err := dp.Pack(NewMsg(1001, data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadMsg(dp, bytes.NewReader(packed)); err == nil {
+			t.Fatal("decompressed length limit not checked")
+		}
+	}
+}
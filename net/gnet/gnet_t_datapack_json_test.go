@@ -0,0 +1,44 @@
+package gnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gogo/protobuf/types"
+	"reflect"
+	"testing"
+)
+
+func Test_JsonDataPack(t *testing.T) {
+	RouteItemMgr.AddRoute("google.protobuf.UInt32Value", "json.get", reflect.TypeOf(&types.UInt32Value{}))
+	msgId := RouteItemMgr.GetMsgId("google.protobuf.UInt32Value")
+	dp := NewJsonDataPack()
+
+	// 按路由名称查找消息ID
+	msg, err := ReadMsg(dp, bytes.NewReader([]byte(`{"route":"json.get","seq":3,"data":7}`)))
+	if err != nil || msg.GetMsgId() != msgId || msg.GetSeqId() != 3 || string(msg.GetData()) != "7" {
+		t.Fatal(err, msg)
+	}
+	// 没有data时使用空对象
+	msg, err = ReadMsg(dp, bytes.NewReader([]byte(`{"id":5}`)))
+	if err != nil || msg.GetMsgId() != 5 || string(msg.GetData()) != "{}" {
+		t.Fatal(err, msg)
+	}
+
+	data, err := dp.Pack(NewMsg(msgId, []byte("8")).WithSeqId(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope := &JsonEnvelope{}
+	if err := json.Unmarshal(data, envelope); err != nil || envelope.Route != "json.get" || envelope.Seq != 3 || string(envelope.Data) != "8" {
+		t.Fatal(err, string(data))
+	}
+
+	// 非JSON消息体
+	if _, err := dp.Pack(NewMsg(msgId, []byte{0x08, 0x01})); err != ErrJsonDataPackInvalid {
+		t.Fatal(err)
+	}
+	dp.SetMaxPacketSize(8)
+	if _, err := ReadMsg(dp, bytes.NewReader([]byte(`{"id":5,"data":{}}`))); err == nil {
+		t.Fatal("msg too long")
+	}
+}
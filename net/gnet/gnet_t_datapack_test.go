@@ -0,0 +1,163 @@
+package gnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func testDataPack(t *testing.T, dp IDataPack, msg *Msg) {
+	data, err := dp.Pack(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 连续两条消息，检查读取时不会越界
+	stream := bytes.NewReader(append(data, data...))
+	for i := 0; i < 2; i++ {
+		readMsg, err := ReadMsg(dp, stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if readMsg.GetMsgId() != msg.GetMsgId() || readMsg.GetSeqId() != msg.GetSeqId() ||
+			readMsg.GetFlags() != msg.GetFlags() || string(readMsg.GetData()) != string(msg.GetData()) {
+			t.Fatalf("unexpected msg: %+v", readMsg)
+		}
+	}
+}
+
+func Test_DataPack(t *testing.T) {
+	dp := NewDataPack()
+	testDataPack(t, dp, NewMsg(1001, []byte("gserver")))
+	if dp.GetHeadLen() != 8 {
+		t.Fail()
+	}
+
+	dp.SetByteOrder(true)
+	dp.SetSeqEnabled(true)
+	testDataPack(t, dp, NewMsg(1001, []byte("gserver")).WithSeqId(7))
+	if dp.GetHeadLen() != 12 {
+		t.Fail()
+	}
+}
+
+func Test_DataPack_MaxPacketSize(t *testing.T) {
+	dp := NewDataPack()
+	dp.SetMaxPacketSize(10)
+	data, _ := dp.Pack(NewMsg(1, []byte("gserver")))
+	if _, err := ReadMsg(dp, bytes.NewReader(data)); err == nil {
+		t.Fail()
+	}
+}
+
+func Test_ShortIdDataPack(t *testing.T) {
+	dp := NewShortIdDataPack()
+	testDataPack(t, dp, NewMsg(1001, []byte("gserver")))
+	if _, err := dp.Pack(NewMsg(70000, []byte("gserver"))); err == nil {
+		t.Fail()
+	}
+}
+
+func Test_FlagDataPack(t *testing.T) {
+	dp := NewFlagDataPack()
+	dp.SetSeqEnabled(true)
+	msg := NewMsg(1001, []byte("gserver")).WithSeqId(3)
+	msg.SetFlags(0x01)
+	testDataPack(t, dp, msg)
+}
+
+func Test_VarintDataPack(t *testing.T) {
+	dp := NewVarintDataPack()
+	testDataPack(t, dp, NewMsg(1001, []byte("gserver")))
+	testDataPack(t, dp, NewMsg(1001, bytes.Repeat([]byte("g"), 300)))
+
+	data, _ := dp.Pack(NewMsg(1001, []byte("gserver")))
+	msg, err := dp.Unpack(data)
+	if err != nil || msg.GetMsgId() != 1001 || msg.GetDataLen() != 7 {
+		t.Fail()
+	}
+}
+
+// packLegacy 基于bytes.Buffer和binary.Write的封包方式，用于对比基准测试
+func packLegacy(msg *Msg) []byte {
+	dataBuff := bytes.NewBuffer([]byte{})
+	_ = binary.Write(dataBuff, binary.BigEndian, msg.GetDataLen())
+	_ = binary.Write(dataBuff, binary.BigEndian, msg.GetMsgId())
+	_ = binary.Write(dataBuff, binary.BigEndian, msg.GetData())
+	return dataBuff.Bytes()
+}
+
+func Test_DataPack_PackBuffer(t *testing.T) {
+	dp := NewDataPack()
+	dp.SetSeqEnabled(true)
+	msg := NewMsg(1001, []byte("gserver")).WithSeqId(7)
+
+	data, _ := dp.Pack(msg)
+	buf, err := PackBuffer(dp, msg)
+	if err != nil || !bytes.Equal(buf.B, data) {
+		t.Fatal(err, buf.B, data)
+	}
+	buf.Release()
+
+	// 与旧版封包结果一致
+	if data, _ := NewDataPack().Pack(msg); !bytes.Equal(data, packLegacy(msg)) {
+		t.Fatal(data)
+	}
+
+	// 不支持缓冲池的封包格式返回非缓冲池数据
+	buf, err = PackBuffer(NewVarintDataPack(), msg)
+	if err != nil || buf.ptr != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_GetBuffer(t *testing.T) {
+	for _, size := range []int{0, 1, 256, 257, 4096, 65536, 65537} {
+		buf := GetBuffer(size)
+		if len(buf.B) != size {
+			t.Fatal(size, len(buf.B))
+		}
+		if (size > 65536) != (buf.ptr == nil) {
+			t.Fatal(size)
+		}
+		buf.Release()
+	}
+}
+
+func BenchmarkDataPack_PackLegacy(b *testing.B) {
+	msg := NewMsg(1001, make([]byte, 128))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		packLegacy(msg)
+	}
+}
+
+func BenchmarkDataPack_Pack(b *testing.B) {
+	dp := NewDataPack()
+	msg := NewMsg(1001, make([]byte, 128))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = dp.Pack(msg)
+	}
+}
+
+func BenchmarkDataPack_PackBuffer(b *testing.B) {
+	dp := NewDataPack()
+	msg := NewMsg(1001, make([]byte, 128))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ := dp.PackBuffer(msg)
+		buf.Release()
+	}
+}
+
+func BenchmarkReadMsg(b *testing.B) {
+	dp := NewDataPack()
+	data, _ := dp.Pack(NewMsg(1001, make([]byte, 128)))
+	r := bytes.NewReader(data)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		_, _ = ReadMsg(dp, r)
+	}
+}
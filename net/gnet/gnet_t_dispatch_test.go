@@ -0,0 +1,121 @@
+package gnet
+
+import "testing"
+
+func Test_MsgHandler_DispatchByUid(t *testing.T) {
+	connMgr := NewConnManager()
+	mh := NewMsgHandler(8, 16)
+	mh.SetDispatchKey(DispatchByUid(connMgr))
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	oldConn := newStubConn(connMgr, 1)
+	newConn := newStubConn(connMgr, 2)
+	if err := connMgr.Bind(10001, oldConn); err != nil {
+		t.Fatal(err)
+	}
+	oldQueue := queueOf(mh, NewRequest(oldConn, NewMsg(1, []byte{})))
+
+	// 重连后新链接绑定同一用户ID, 消息仍由同一个Worker处理
+	connMgr.Unbind(10001)
+	if err := connMgr.Bind(10001, newConn); err != nil {
+		t.Fatal(err)
+	}
+	if queueOf(mh, NewRequest(newConn, NewMsg(1, []byte{}))) != oldQueue {
+		t.Fatal("same uid dispatched to different worker")
+	}
+
+	// 未绑定用户ID时按链接ID分发
+	conn := newStubConn(connMgr, 3)
+	if queueOf(mh, NewRequest(conn, NewMsg(1, []byte{}))) != mh.TaskQueue[3] {
+		t.Fail()
+	}
+}
+
+func Test_MsgHandler_DispatchByUidPinned(t *testing.T) {
+	connMgr := NewConnManager()
+	mh := NewMsgHandler(8, 16)
+	mh.SetDispatchKey(DispatchByUid(connMgr))
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	conn := newStubConn(connMgr, 1)
+	login := NewRequest(conn, NewMsg(1, []byte{}))
+	if queueOf(mh, login) != mh.TaskQueue[1] {
+		t.Fatal("unbound conn not dispatched by conn id")
+	}
+
+	// 登录消息还未处理完成时绑定用户ID, 后续消息仍由原Worker处理
+	if err := connMgr.Bind(10002, conn); err != nil {
+		t.Fatal(err)
+	}
+	next := NewRequest(conn, NewMsg(1, []byte{}))
+	if queueOf(mh, next) != mh.TaskQueue[1] {
+		t.Fatal("dispatch key switched before old worker drained")
+	}
+
+	// 原Worker中的消息全部处理完成后切换到用户ID
+	login.finish()
+	if queueOf(mh, NewRequest(conn, NewMsg(1, []byte{}))) != mh.TaskQueue[1] {
+		t.Fatal("dispatch key switched before old worker drained")
+	}
+	next.finish()
+}
+
+func Test_MsgHandler_DispatchByUidSwitch(t *testing.T) {
+	connMgr := NewConnManager()
+	mh := NewMsgHandler(8, 16)
+	mh.SetDispatchKey(DispatchByUid(connMgr))
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	conn := newStubConn(connMgr, 1)
+	login := NewRequest(conn, NewMsg(1, []byte{}))
+	queueOf(mh, login)
+	if err := connMgr.Bind(10002, conn); err != nil {
+		t.Fatal(err)
+	}
+	login.finish()
+	if queueOf(mh, NewRequest(conn, NewMsg(1, []byte{}))) != mh.TaskQueue[10002%8] {
+		t.Fatal("dispatch key not switched to uid after drained")
+	}
+}
+
+func Test_MsgHandler_DispatchByProperty(t *testing.T) {
+	mh := NewMsgHandler(8, 16)
+	mh.SetDispatchKey(DispatchByProperty("roomId"))
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	connMgr := NewConnManager()
+	conn1 := newStubConn(connMgr, 1)
+	conn2 := newStubConn(connMgr, 2)
+	conn1.SetProperty("roomId", "room-1")
+	conn2.SetProperty("roomId", "room-1")
+	if queueOf(mh, NewRequest(conn1, NewMsg(1, []byte{}))) != queueOf(mh, NewRequest(conn2, NewMsg(1, []byte{}))) {
+		t.Fatal("same room dispatched to different worker")
+	}
+}
+
+func Test_MsgHandler_WorldWorker(t *testing.T) {
+	mh := NewMsgHandler(8, 16)
+	mh.SetWorldMsgIds(100)
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	connMgr := NewConnManager()
+	for i := uint32(0); i < 8; i++ {
+		conn := newStubConn(connMgr, i)
+		if queueOf(mh, NewRequest(conn, NewMsg(100, []byte{}))) != mh.WorldQueue {
+			t.Fatal(i)
+		}
+		if queueOf(mh, NewRequest(conn, NewMsg(1, []byte{}))) == mh.WorldQueue {
+			t.Fatal(i)
+		}
+	}
+}
+
+func queueOf(mh *MsgHandler, req *Request) chan *Request {
+	_, queue := mh.getTaskQueue(req)
+	return queue
+}
@@ -0,0 +1,80 @@
+package gnet
+
+import (
+	"context"
+	"go.uber.org/atomic"
+	"net"
+	"testing"
+	"time"
+)
+
+// hbConn 测试用链接, 记录心跳消息发送次数和停止状态
+type hbConn struct {
+	IConnection
+	pings   atomic.Int32
+	stopped atomic.Bool
+}
+
+func (c *hbConn) GetConnID() uint32    { return 1 }
+func (c *hbConn) RemoteAddr() net.Addr { return nil }
+func (c *hbConn) Stop()                { c.stopped.Store(true) }
+func (c *hbConn) SendMsg(msgId uint32, data []byte) error {
+	if msgId == 100 {
+		c.pings.Inc()
+	}
+	return nil
+}
+
+func Test_HeartBeat_ReadIdle(t *testing.T) {
+	conn := &hbConn{}
+	heartBeat := NewHeartBeat(conn, HeartBeatOption{ReadIdle: 100 * time.Millisecond})
+
+	done := make(chan struct{})
+	go func() {
+		heartBeat.Run(context.Background())
+		close(done)
+	}()
+
+	// 持续收到数据时保持链接
+	for i := 0; i < 4; i++ {
+		time.Sleep(40 * time.Millisecond)
+		heartBeat.KeepAlive()
+	}
+	if conn.stopped.Load() {
+		t.Fatal("conn stopped while alive")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("read idle timeout not detected")
+	}
+	if !conn.stopped.Load() || heartBeat.IsAlive() {
+		t.Fail()
+	}
+}
+
+func Test_HeartBeat_Ping(t *testing.T) {
+	conn := &hbConn{}
+	heartBeat := NewHeartBeat(conn, HeartBeatOption{WriteIdle: 30 * time.Millisecond, PingMsgId: 100})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	heartBeat.Run(ctx)
+
+	if n := conn.pings.Load(); n < 3 {
+		t.Fatal(n)
+	}
+	if conn.stopped.Load() {
+		t.Fatal("conn stopped without read idle")
+	}
+}
+
+func Test_HeartBeat_Disabled(t *testing.T) {
+	heartBeat := NewHeartBeat(&hbConn{}, HeartBeatOption{WriteIdle: time.Second})
+	// 未开启时立即返回
+	heartBeat.Run(context.Background())
+	if !heartBeat.IsAlive() {
+		t.Fail()
+	}
+}
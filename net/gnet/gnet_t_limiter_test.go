@@ -0,0 +1,143 @@
+package gnet
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// limitConn 测试用链接, 记录发送的消息ID
+type limitConn struct {
+	*stubConn
+	msgIds []uint32
+}
+
+func newLimitConn() *limitConn {
+	return &limitConn{stubConn: newStubConn(NewConnManager(), 1)}
+}
+
+func (c *limitConn) RemoteAddr() net.Addr { return nil }
+func (c *limitConn) SendMsg(msgId uint32, data []byte) error {
+	c.msgIds = append(c.msgIds, msgId)
+	return nil
+}
+
+func Test_TokenBucket(t *testing.T) {
+	bucket := NewTokenBucket(100, 5)
+	for i := 0; i < 5; i++ {
+		if !bucket.Allow(1) {
+			t.Fatal(i)
+		}
+	}
+	if bucket.Allow(1) {
+		t.Fatal("burst exceeded")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !bucket.Allow(1) {
+		t.Fatal("tokens not refilled")
+	}
+}
+
+func Test_RateLimiter_MsgRate(t *testing.T) {
+	conn := newLimitConn()
+	limiter := NewRateLimiter(LimitOption{
+		MsgRate:  LimitRule{Rate: 1, Burst: 3},
+		Policy:   LimitSendError,
+		ErrMsgId: 99,
+	})
+	var violations []*LimitViolation
+	limiter.SetOnViolation(func(violation *LimitViolation) {
+		violations = append(violations, violation)
+	})
+
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if limiter.Allow(NewRequest(conn, NewMsg(1, []byte("gserver")))) {
+			allowed++
+		}
+	}
+	if allowed != 3 || len(violations) != 2 || violations[0].Reason != LimitMsgRate {
+		t.Fatal(allowed, len(violations))
+	}
+	// 间隔内只发送一次错误消息
+	if len(conn.msgIds) != 1 || conn.msgIds[0] != 99 {
+		t.Fatal(conn.msgIds)
+	}
+}
+
+func Test_RateLimiter_ErrInterval(t *testing.T) {
+	conn := newLimitConn()
+	limiter := NewRateLimiter(LimitOption{
+		MsgRate:     LimitRule{Rate: 1, Burst: 1},
+		Policy:      LimitSendError,
+		ErrMsgId:    99,
+		ErrInterval: 20 * time.Millisecond,
+	})
+
+	for i := 0; i < 5; i++ {
+		limiter.Allow(NewRequest(conn, NewMsg(1, []byte("gserver"))))
+	}
+	if len(conn.msgIds) != 1 {
+		t.Fatal(conn.msgIds)
+	}
+	time.Sleep(30 * time.Millisecond)
+	limiter.Allow(NewRequest(conn, NewMsg(1, []byte("gserver"))))
+	if len(conn.msgIds) != 2 {
+		t.Fatal(conn.msgIds)
+	}
+}
+
+func Test_RateLimiter_NoPartialConsume(t *testing.T) {
+	conn := newLimitConn()
+	limiter := NewRateLimiter(LimitOption{
+		MsgRate:  LimitRule{Rate: 1, Burst: 2},
+		ByteRate: LimitRule{Rate: 1, Burst: 7},
+	})
+
+	// 超出字节数限制被拒绝的消息不消耗消息数令牌
+	if !limiter.Allow(NewRequest(conn, NewMsg(1, []byte("gserver")))) {
+		t.Fatal("first msg should be allowed")
+	}
+	if limiter.Allow(NewRequest(conn, NewMsg(1, []byte("gserver")))) {
+		t.Fatal("byte rate exceeded")
+	}
+	if !limiter.Allow(NewRequest(conn, NewMsg(1, []byte{}))) {
+		t.Fatal("msg token consumed by rejected msg")
+	}
+}
+
+func Test_RateLimiter_MsgIdRate(t *testing.T) {
+	conn := newLimitConn()
+	limiter := NewRateLimiter(LimitOption{
+		MsgIdRate: map[uint32]LimitRule{2: {Rate: 1}},
+		Policy:    LimitDisconnect,
+	})
+
+	// 未配置限流的消息ID不受影响
+	for i := 0; i < 10; i++ {
+		if !limiter.Allow(NewRequest(conn, NewMsg(1, []byte("gserver")))) {
+			t.Fatal(i)
+		}
+	}
+	if !limiter.Allow(NewRequest(conn, NewMsg(2, []byte("gserver")))) {
+		t.Fatal("first msg should be allowed")
+	}
+	if limiter.Allow(NewRequest(conn, NewMsg(2, []byte("gserver")))) || !conn.IsClosed() {
+		t.Fatal("conn should be disconnected")
+	}
+}
+
+func Test_RateLimiter_ByteRate(t *testing.T) {
+	conn := newLimitConn()
+	limiter := NewRateLimiter(LimitOption{ByteRate: LimitRule{Rate: 10}})
+
+	if !limiter.Allow(NewRequest(conn, NewMsg(1, []byte("gserver")))) {
+		t.Fatal("first msg should be allowed")
+	}
+	if limiter.Allow(NewRequest(conn, NewMsg(1, []byte("gserver")))) {
+		t.Fatal("byte rate exceeded")
+	}
+	if len(conn.msgIds) != 0 || conn.IsClosed() {
+		t.Fail()
+	}
+}
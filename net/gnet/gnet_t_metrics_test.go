@@ -0,0 +1,100 @@
+package gnet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/Ravior/gserver/util/gserialize"
+	"github.com/gogo/protobuf/types"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Metrics(t *testing.T) {
+	router := &Router{}
+	router.Group("metrics").AddRoute("run", func(req *Request, msg *types.Int32Value) (*types.Int32Value, error) {
+		if msg.Value < 0 {
+			panic("negative value")
+		}
+		if msg.Value == 0 {
+			return nil, errors.New("zero value")
+		}
+		return msg, nil
+	})
+	msgId := RouteItemMgr.GetMsgId("google.protobuf.Int32Value")
+	MetricsMgr.Reset()
+
+	msgHandler := NewMsgHandler(1, 16)
+	msgHandler.SetRouter(router)
+	msgHandler.StartWorkerPool()
+	defer msgHandler.StopWorkerPool()
+
+	conn := &replyConn{}
+	for _, v := range []int32{1, 0, -1} {
+		data, _ := gserialize.Protobuf.Marshal(&types.Int32Value{Value: v})
+		msgHandler.SendMsgToTaskQueue(NewRequest(conn, NewMsg(msgId, data).WithSeqId(1)))
+	}
+	// 未注册路由的消息ID不记录
+	msgHandler.SendMsgToTaskQueue(NewRequest(conn, NewMsg(0xFFFF0001, []byte{1})))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := msgHandler.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats *MsgIdStats
+	for _, s := range MetricsMgr.GetMsgIdStats() {
+		if s.MsgId == 0xFFFF0001 {
+			t.Fatal("unknown msg id recorded")
+		}
+		if s.MsgId == msgId {
+			s := s
+			stats = &s
+		}
+	}
+	if stats == nil || stats.Route != "metrics.run" || stats.Requests != 3 || stats.Errors != 1 || stats.Panics != 1 || stats.BytesIn == 0 {
+		t.Fatal(stats)
+	}
+	if stats.HandleTime.Count != 3 || stats.QueueWait.Count != 3 {
+		t.Fatal(stats.HandleTime, stats.QueueWait)
+	}
+
+	connMgr := NewConnManager()
+	newStubConn(connMgr, 1)
+	// 同协议、同名称的服务器分别导出
+	id := MetricsMgr.RegisterConnMgr("tcp", "metrics", connMgr)
+	defer MetricsMgr.UnregisterConnMgr(id)
+	otherId := MetricsMgr.RegisterConnMgr("tcp", "metrics", NewConnManager())
+	defer MetricsMgr.UnregisterConnMgr(otherId)
+
+	buf := &bytes.Buffer{}
+	if err := MetricsMgr.WritePrometheus(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`gnet_msg_requests_total{msg_id="` + strconv.FormatUint(uint64(msgId), 10) + `",route="metrics.run"} 3`,
+		`gnet_msg_panics_total{msg_id="` + strconv.FormatUint(uint64(msgId), 10) + `",route="metrics.run"} 1`,
+		`gnet_msg_handle_seconds_bucket{msg_id="` + strconv.FormatUint(uint64(msgId), 10) + `",route="metrics.run",le="+Inf"} 3`,
+		`gnet_connections{protocol="tcp",server="metrics",id="` + strconv.FormatUint(uint64(id), 10) + `"} 1`,
+		`gnet_connections{protocol="tcp",server="metrics",id="` + strconv.FormatUint(uint64(otherId), 10) + `"} 0`,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatal(line, buf.String())
+		}
+	}
+}
+
+func Test_HistogramStats_Quantile(t *testing.T) {
+	h := &histogram{}
+	for i := 0; i < 99; i++ {
+		h.observe(200 * time.Microsecond)
+	}
+	h.observe(2 * time.Second)
+	stats := h.stats()
+	if stats.Quantile(0.5) != 500*time.Microsecond || stats.Quantile(0.999) != 2500*time.Millisecond {
+		t.Fatal(stats.Quantile(0.5), stats.Quantile(0.999))
+	}
+}
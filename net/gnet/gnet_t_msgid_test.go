@@ -0,0 +1,138 @@
+package gnet
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Ravior/gserver/crypto/gcrc32"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"reflect"
+	"testing"
+)
+
+func Test_MsgRouteMgr_RegisterMsgIds(t *testing.T) {
+	m := newMsgRouteMgr()
+	if err := m.RegisterMsgIds(map[string]uint32{"pb.LoginReq": 1001, "pb.LoginResp": 1002}); err != nil {
+		t.Fatal(err)
+	}
+	// 同一消息ID指定给两个Proto
+	if err := m.RegisterMsgId("pb.LogoutReq", 1001); !errors.Is(err, ErrMsgIdDuplicate) {
+		t.Fatal(err)
+	}
+	// 同一Proto指定两个消息ID
+	if err := m.RegisterMsgId("pb.LoginReq", 1003); !errors.Is(err, ErrMsgIdDuplicate) {
+		t.Fatal(err)
+	}
+
+	m.AddRoute("pb.LoginReq", "user.login", reflect.TypeOf(&types.StringValue{}))
+	if m.GetMsgId("pb.LoginReq") != 1001 || m.GetMsgId("pb.LoginResp") != 1002 {
+		t.Fatal(m.GetMsgId("pb.LoginReq"), m.GetMsgId("pb.LoginResp"))
+	}
+	if m.GetRoute(1001) != "user.login" {
+		t.Fatal(m.GetRoute(1001))
+	}
+}
+
+func Test_MsgRouteMgr_Collision(t *testing.T) {
+	m := newMsgRouteMgr()
+	m.AddRoute("pb.LoginReq", "user.login", reflect.TypeOf(&types.StringValue{}))
+	// 同一Proto可以添加多个路由
+	m.AddRoute("pb.LoginReq", "gm.login", reflect.TypeOf(&types.StringValue{}))
+
+	// 显式指定的消息ID与已添加路由的消息ID冲突
+	if err := m.RegisterMsgId("pb.ChatReq", gcrc32.Encrypt("pb.LoginReq")); !errors.Is(err, ErrMsgIdCollision) {
+		t.Fatal(err)
+	}
+
+	m.explicitIds["pb.ChatReq"] = gcrc32.Encrypt("pb.LoginReq")
+	defer func() {
+		if err, ok := recover().(error); !ok || !errors.Is(err, ErrMsgIdCollision) {
+			t.Fatal(err)
+		}
+	}()
+	m.AddRoute("pb.ChatReq", "chat.send", reflect.TypeOf(&types.StringValue{}))
+}
+
+func Test_MsgRouteMgr_ExportJSON(t *testing.T) {
+	m := newMsgRouteMgr()
+	_ = m.RegisterMsgIds(map[string]uint32{"pb.B": 2, "pb.A": 1})
+	m.AddRoute("pb.B", "b.b", reflect.TypeOf(&types.StringValue{}))
+	m.AddRoute("pb.A", "a.a", reflect.TypeOf(&types.StringValue{}))
+
+	data, err := m.ExportJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var routes []*RouteItem
+	if err := json.Unmarshal(data, &routes); err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes[0].Proto != "pb.A" || routes[1].MsgId != 2 || routes[1].Route != "b.b" {
+		t.Fatal(string(data))
+	}
+}
+
+func Test_MsgRouteMgr_ReplaceRoute(t *testing.T) {
+	m := newMsgRouteMgr()
+	_ = m.RegisterMsgIds(map[string]uint32{"pb.A": 1})
+	m.AddRoute("pb.A", "a.a", reflect.TypeOf(&types.StringValue{}))
+	// 运行期间替换路由(同名及改名)
+	m.AddRoute("pb.A", "a.a", reflect.TypeOf(&types.StringValue{}))
+	m.AddRoute("pb.A", "a.b", reflect.TypeOf(&types.StringValue{}))
+
+	routes := m.GetRoutes()
+	if len(routes) != 1 || routes[0].MsgId != 1 || routes[0].Route != "a.b" {
+		t.Fatal(routes)
+	}
+	if m.GetRoute(1) != "a.b" {
+		t.Fatal(m.GetRoute(1))
+	}
+	if _, ok := m.GetMsgIdByRoute("a.a"); ok {
+		t.Fatal("replaced route should be removed")
+	}
+	if msgId, ok := m.GetMsgIdByRoute("a.b"); !ok || msgId != 1 {
+		t.Fatal(msgId, ok)
+	}
+}
+
+func Test_MsgRouteMgr_ReplyOptionMsgId(t *testing.T) {
+	msgIdOption := &proto.ExtensionDesc{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: (*uint32)(nil),
+		Field:         50001,
+		Name:          "gserver.test.msg_id",
+		Tag:           "varint,50001,opt,name=msg_id",
+		Filename:      "gserver_test_msgid.proto",
+	}
+	options := &descriptorpb.MessageOptions{}
+	if err := proto.SetExtension(options, msgIdOption, proto.Uint32(2001)); err != nil {
+		t.Fatal(err)
+	}
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("gserver_test_reply.proto"),
+		Package:     proto.String("gserver.test"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("LoginResp"), Options: options}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RouteItemMgr.SetMsgIdOption(msgIdOption)
+	defer RouteItemMgr.SetMsgIdOption(nil)
+
+	// 响应消息未添加路由，消息ID同样取自消息选项
+	router := &Router{}
+	router.Group("option").AddRoute("login", func(req *Request, msg *types.Empty) (*dynamicpb.Message, error) {
+		return dynamicpb.NewMessage(fd.Messages().Get(0)), nil
+	})
+	conn := &replyConn{}
+	router.Run(NewRequest(conn, NewMsg(RouteItemMgr.GetMsgId("google.protobuf.Empty"), nil).WithSeqId(3)))
+	if conn.msg == nil || conn.msg.GetMsgId() != 2001 || conn.msg.GetSeqId() != 3 {
+		t.Fatal(conn.msg)
+	}
+	if msgId := RouteItemMgr.GetMsgIdOf(dynamicpb.NewMessage(fd.Messages().Get(0))); msgId != 2001 {
+		t.Fatal(msgId)
+	}
+}
@@ -0,0 +1,94 @@
+package gnet
+
+import (
+	"testing"
+	"time"
+)
+
+// newOverflowHandler 创建未启动Worker的消息处理器, 队列只能容纳2条消息
+func newOverflowHandler(option OverflowOption) (*MsgHandler, *[]*QueueEvent) {
+	mh := NewMsgHandler(1, 2)
+	mh.TaskQueue[0] = make(chan *Request, mh.WorkerTaskSize)
+	mh.SetOverflow(option)
+	events := &[]*QueueEvent{}
+	mh.SetOnQueueEvent(func(event *QueueEvent) {
+		*events = append(*events, event)
+	})
+	return mh, events
+}
+
+func Test_MsgHandler_OverflowDropNewest(t *testing.T) {
+	mh, events := newOverflowHandler(OverflowOption{Policy: OverflowDropNewest, HighWaterMark: 2})
+	conn := newStubConn(NewConnManager(), 1)
+	for i := uint32(1); i <= 4; i++ {
+		mh.SendMsgToTaskQueue(NewRequest(conn, NewMsg(i, []byte{})))
+	}
+
+	stats := mh.GetQueueStats()
+	if stats.Enqueued != 2 || stats.Dropped != 2 || stats.HighWater != 1 || mh.pending.Load() != 2 {
+		t.Fatal(stats, mh.pending.Load())
+	}
+	if len(*events) != 3 || (*events)[0].Type != QueueHighWater || (*events)[1].Dropped.GetMessage().GetMsgId() != 3 {
+		t.Fatal(*events)
+	}
+	if req := <-mh.TaskQueue[0]; req.GetMessage().GetMsgId() != 1 {
+		t.Fatal(req.GetMessage().GetMsgId())
+	}
+}
+
+func Test_MsgHandler_OverflowDropOldest(t *testing.T) {
+	mh, events := newOverflowHandler(OverflowOption{Policy: OverflowDropOldest})
+	conn := newStubConn(NewConnManager(), 1)
+	for i := uint32(1); i <= 4; i++ {
+		mh.SendMsgToTaskQueue(NewRequest(conn, NewMsg(i, []byte{})))
+	}
+
+	if lens := mh.GetQueueLens(); len(lens) != 1 || lens[0] != 2 {
+		t.Fatal(lens)
+	}
+	if len(*events) != 2 || (*events)[0].Dropped.GetMessage().GetMsgId() != 1 {
+		t.Fatal(*events)
+	}
+	if req := <-mh.TaskQueue[0]; req.GetMessage().GetMsgId() != 3 {
+		t.Fatal(req.GetMessage().GetMsgId())
+	}
+}
+
+func Test_MsgHandler_OverflowDisconnect(t *testing.T) {
+	mh, _ := newOverflowHandler(OverflowOption{Policy: OverflowDisconnect})
+	conn := newStubConn(NewConnManager(), 1)
+	for i := uint32(1); i <= 3; i++ {
+		mh.SendMsgToTaskQueue(NewRequest(conn, NewMsg(i, []byte{})))
+	}
+	if !conn.IsClosed() || mh.GetQueueStats().Dropped != 1 {
+		t.Fail()
+	}
+}
+
+func Test_MsgHandler_OverflowBlockTimeout(t *testing.T) {
+	mh, _ := newOverflowHandler(OverflowOption{Policy: OverflowBlock, BlockTimeout: 20 * time.Millisecond})
+	conn := newStubConn(NewConnManager(), 1)
+	for i := uint32(1); i <= 2; i++ {
+		mh.SendMsgToTaskQueue(NewRequest(conn, NewMsg(i, []byte{})))
+	}
+
+	start := time.Now()
+	mh.SendMsgToTaskQueue(NewRequest(conn, NewMsg(3, []byte{})))
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatal("should block until timeout")
+	}
+	stats := mh.GetQueueStats()
+	if stats.Blocked != 1 || stats.Dropped != 1 || mh.pending.Load() != 2 {
+		t.Fatal(stats)
+	}
+
+	// 队列空闲后等待中的消息入队
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-mh.TaskQueue[0]
+	}()
+	mh.SendMsgToTaskQueue(NewRequest(conn, NewMsg(4, []byte{})))
+	if mh.GetQueueStats().Enqueued != 3 {
+		t.Fatal(mh.GetQueueStats())
+	}
+}
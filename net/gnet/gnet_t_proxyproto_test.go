@@ -0,0 +1,163 @@
+package gnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_ProxyListener(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := NewProxyProtocol([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl := NewProxyListener(l, proxy)
+	defer pl.Close()
+
+	v2 := func(family byte, addr []byte) []byte {
+		head := append([]byte{}, proxyV2Sig...)
+		head = append(head, 0x21, family, 0, 0)
+		binary.BigEndian.PutUint16(head[14:], uint16(len(addr)))
+		return append(head, addr...)
+	}
+	v2Ip4 := v2(0x11, []byte{1, 2, 3, 4, 5, 6, 7, 8, 0x1F, 0x90, 0x01, 0xBB})
+	v2Ip6 := v2(0x21, append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0x1F, 0x90, 0x01, 0xBB))
+	local := append(append([]byte{}, proxyV2Sig...), 0x20, 0x00, 0, 0)
+
+	cases := []struct {
+		header []byte
+		addr   string
+	}{
+		{[]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"), "192.168.0.1:56324"},
+		{[]byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"), "[2001:db8::1]:56324"},
+		{[]byte("PROXY UNKNOWN\r\n"), ""},
+		{v2Ip4, "1.2.3.4:8080"},
+		{v2Ip6, "[2001:db8::1]:8080"},
+		{local, ""},
+	}
+	for _, c := range cases {
+		client, err := net.Dial("tcp4", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 头部之后的业务数据不会被读取
+		_, _ = client.Write(append(append([]byte{}, c.header...), "body"...))
+
+		conn, err := pl.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := c.addr
+		if want == "" {
+			want = client.LocalAddr().String()
+		}
+		if conn.RemoteAddr().String() != want {
+			t.Fatal(conn.RemoteAddr(), want)
+		}
+		body := make([]byte, 4)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := io.ReadFull(conn, body); err != nil || string(body) != "body" {
+			t.Fatal(string(body), err)
+		}
+		_ = conn.Close()
+		_ = client.Close()
+	}
+
+	// 可信上游未携带合法头部时断开链接
+	client, err := net.Dial("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	_, _ = client.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Fatal("connection without header should be closed")
+	}
+}
+
+// errListener Accept总是返回同一个错误的监听器
+type errListener struct {
+	net.Listener
+	err error
+}
+
+func (l *errListener) Accept() (net.Conn, error) {
+	return nil, l.err
+}
+
+func Test_ProxyListener_AcceptError(t *testing.T) {
+	proxy, err := NewProxyProtocol(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acceptErr := errors.New("accept fail")
+	pl := NewProxyListener(&errListener{err: acceptErr}, proxy)
+
+	// 调用方晚于错误发生才Accept，错误不会丢失，之后的Accept也不会阻塞
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		done := make(chan error, 1)
+		go func() {
+			_, err := pl.Accept()
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != acceptErr {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Accept blocked after listener error")
+		}
+	}
+	// 出错后不再Accept底层监听器
+	select {
+	case <-pl.done:
+	case <-time.After(time.Second):
+		t.Fatal("run should return after listener error")
+	}
+}
+
+func Test_ProxyProtocol_Untrusted(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := NewProxyProtocol([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl := NewProxyListener(l, proxy)
+	defer pl.Close()
+
+	client, err := net.Dial("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	header := "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+	_, _ = client.Write([]byte(header))
+
+	// 非可信来源不解析头部，伪造的头部作为业务数据
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.RemoteAddr().String() != client.LocalAddr().String() {
+		t.Fatal(conn.RemoteAddr())
+	}
+	data := make([]byte, len(header))
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, data); err != nil || string(data) != header {
+		t.Fatal(string(data), err)
+	}
+}
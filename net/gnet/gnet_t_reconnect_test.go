@@ -0,0 +1,173 @@
+package gnet
+
+import (
+	"errors"
+	"go.uber.org/atomic"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sendConn 测试用链接, 记录发送的消息ID
+type sendConn struct {
+	IConnection
+	lock   sync.Mutex
+	msgIds []uint32
+}
+
+func (c *sendConn) IsClosed() bool       { return false }
+func (c *sendConn) RemoteAddr() net.Addr { return nil }
+func (c *sendConn) SendMsg(msgId uint32, data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.msgIds = append(c.msgIds, msgId)
+	return nil
+}
+
+// closableConn 测试用链接, 可以模拟断开
+type closableConn struct {
+	sendConn
+	closed atomic.Bool
+}
+
+func (c *closableConn) IsClosed() bool { return c.closed.Load() }
+func (c *closableConn) SendMsg(msgId uint32, data []byte) error {
+	if c.IsClosed() {
+		return errors.New("connection closed")
+	}
+	return c.sendConn.SendMsg(msgId, data)
+}
+
+func Test_ReconnectPolicy_Delay(t *testing.T) {
+	policy := &ReconnectPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2}
+	if d := policy.Delay(1); d != 100*time.Millisecond {
+		t.Fatal(d)
+	}
+	if d := policy.Delay(3); d != 400*time.Millisecond {
+		t.Fatal(d)
+	}
+	if d := policy.Delay(100); d != time.Second {
+		t.Fatal(d)
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := policy.Delay(2); d < 100*time.Millisecond || d > 300*time.Millisecond {
+			t.Fatal(d)
+		}
+	}
+}
+
+func Test_Reconnector(t *testing.T) {
+	conn := &sendConn{}
+	attempts := 0
+	dial := func() (IConnection, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, errors.New("dial fail")
+		}
+		return conn, nil
+	}
+
+	reconnected := make(chan IConnection, 1)
+	policy := &ReconnectPolicy{InitialDelay: 10 * time.Millisecond, Multiplier: 2, BufferSize: 2}
+	r := NewReconnector(policy, dial, func(c IConnection) {
+		// 重连Hook在发送缓存消息之前执行
+		_ = c.SendMsg(1, []byte{})
+		reconnected <- c
+	}, nil)
+
+	// 断线期间缓存消息，超出上限返回错误
+	_ = r.Send(nil, 2, []byte{})
+	_ = r.Send(nil, 3, []byte{})
+	if err := r.Send(nil, 4, []byte{}); err != ErrReconnectBufferFull {
+		t.Fatal(err)
+	}
+
+	r.Trigger()
+	r.Trigger()
+	select {
+	case c := <-reconnected:
+		if c != conn {
+			t.Fatal(c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reconnect timeout")
+	}
+	for r.IsReconnecting() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if attempts != 3 || r.BufferLen() != 0 {
+		t.Fatal(attempts, r.BufferLen())
+	}
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	if len(conn.msgIds) != 3 || conn.msgIds[0] != 1 || conn.msgIds[1] != 2 || conn.msgIds[2] != 3 {
+		t.Fatal(conn.msgIds)
+	}
+}
+
+func Test_Reconnector_MaxAttempts(t *testing.T) {
+	failed := make(chan int, 1)
+	policy := &ReconnectPolicy{InitialDelay: time.Millisecond, Multiplier: 1, MaxAttempts: 3}
+	r := NewReconnector(policy, func() (IConnection, error) {
+		return nil, errors.New("dial fail")
+	}, nil, func(attempts int, err error) {
+		failed <- attempts
+	})
+
+	r.Trigger()
+	select {
+	case attempts := <-failed:
+		if attempts != 3 {
+			t.Fatal(attempts)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reconnect fail hook not called")
+	}
+
+	r.Stop()
+	if err := r.Send(nil, 1, []byte{}); err != ErrReconnectStopped {
+		t.Fatal(err)
+	}
+}
+
+func Test_Reconnector_ClosedDuringReconnect(t *testing.T) {
+	conns := []*closableConn{{}, {}}
+	var attempts atomic.Int32
+	dial := func() (IConnection, error) {
+		return conns[attempts.Inc()-1], nil
+	}
+
+	var r *Reconnector
+	policy := &ReconnectPolicy{InitialDelay: time.Millisecond, Multiplier: 1, BufferSize: 4}
+	r = NewReconnector(policy, dial, func(c IConnection) {
+		// 重连期间链接可用时发送的消息, 在缓存消息之后发送
+		_ = r.Send(c, 3, []byte{})
+		if c == conns[0] {
+			// 新链接在重连Hook执行期间断开, 断开触发的重连被忽略
+			conns[0].closed.Store(true)
+			r.Trigger()
+		}
+	}, nil)
+
+	_ = r.Send(nil, 1, []byte{})
+	_ = r.Send(nil, 2, []byte{})
+	r.Trigger()
+	deadline := time.Now().Add(time.Second)
+	for attempts.Load() < 2 || r.IsReconnecting() {
+		if time.Now().After(deadline) {
+			t.Fatal("reconnect timeout", attempts.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	conn := conns[1]
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	if len(conn.msgIds) != 4 || conn.msgIds[0] != 1 || conn.msgIds[1] != 2 || conn.msgIds[2] != 3 || conn.msgIds[3] != 3 {
+		t.Fatal(conn.msgIds)
+	}
+}
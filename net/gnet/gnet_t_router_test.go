@@ -0,0 +1,153 @@
+package gnet
+
+import (
+	"github.com/Ravior/gserver/errors/gcode"
+	"github.com/Ravior/gserver/errors/gerror"
+	"github.com/Ravior/gserver/util/gserialize"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/proto"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// replyConn 测试用链接, 记录最后一条发送的消息
+type replyConn struct {
+	IConnection
+	props ConnProperty
+	msg   *Msg
+}
+
+func (c *replyConn) SetProperty(key string, value interface{})  { c.props.SetProperty(key, value) }
+func (c *replyConn) GetProperty(key string) (interface{}, bool) { return c.props.GetProperty(key) }
+
+func (c *replyConn) GetConnID() uint32 { return 1 }
+func (c *replyConn) SendSeqMsg(msgId uint32, seqId uint32, data []byte) error {
+	c.msg = NewMsg(msgId, data).WithSeqId(seqId)
+	return nil
+}
+
+func Test_Router_TypedHandler(t *testing.T) {
+	router := &Router{}
+	router.Group("typed").AddRoute("double", func(req *Request, msg *types.Int64Value) (*types.UInt64Value, error) {
+		if msg.Value < 0 {
+			return nil, gerror.NewCode(gcode.CodeInvalidParameter)
+		}
+		return &types.UInt64Value{Value: uint64(msg.Value * 2)}, nil
+	})
+
+	msgId := RouteItemMgr.GetMsgId("google.protobuf.Int64Value")
+	conn := &replyConn{}
+	data, _ := gserialize.Protobuf.Marshal(&types.Int64Value{Value: 21})
+	router.Run(NewRequest(conn, NewMsg(msgId, data).WithSeqId(7)))
+
+	resp := &types.UInt64Value{}
+	if conn.msg == nil || conn.msg.GetSeqId() != 7 || conn.msg.GetMsgId() != RouteItemMgr.GetMsgId("google.protobuf.UInt64Value") {
+		t.Fatal(conn.msg)
+	}
+	if err := gserialize.Protobuf.Unmarshal(conn.msg.GetData(), resp); err != nil || resp.Value != 42 {
+		t.Fatal(err, resp.Value)
+	}
+
+	// 返回错误时发送标准错误消息
+	data, _ = gserialize.Protobuf.Marshal(&types.Int64Value{Value: -1})
+	router.Run(NewRequest(conn, NewMsg(msgId, data).WithSeqId(8)))
+	if conn.msg.GetMsgId() != ErrorMsgId || conn.msg.GetSeqId() != 8 {
+		t.Fatal(conn.msg)
+	}
+	errMsg, err := UnmarshalErrorMsg(conn.msg.GetData())
+	if err != nil || errMsg.Code != int32(gcode.CodeInvalidParameter.Code()) || errMsg.MsgId != msgId || errMsg.Message != gcode.CodeInvalidParameter.Message() {
+		t.Fatal(err, errMsg)
+	}
+}
+
+func Test_ErrorMsg(t *testing.T) {
+	// 编码与Proto定义一致
+	errMsg := &ErrorMsg{Code: 53, Message: "参数错误", MsgId: 1001}
+	decoded, err := UnmarshalErrorMsg(errMsg.Marshal())
+	if err != nil || *decoded != *errMsg {
+		t.Fatal(err, decoded)
+	}
+
+	// 未携带错误码的错误不泄露内部信息
+	errMsg = NewErrorMsg(1, gerror.New("sql: no rows"))
+	if errMsg.Code != int32(gcode.CodeInternalError.Code()) || errMsg.Message != gcode.CodeInternalError.Message() {
+		t.Fatal(errMsg)
+	}
+
+	// 包装的错误链不发送给客户端
+	errMsg = NewErrorMsg(1, gerror.WrapCode(gcode.CodeInvalidParameter, gerror.New("sql: no rows"), "角色不存在"))
+	if errMsg.Code != int32(gcode.CodeInvalidParameter.Code()) || errMsg.Message != "角色不存在" {
+		t.Fatal(errMsg)
+	}
+	errMsg = NewErrorMsg(1, gerror.WrapCode(gcode.CodeInvalidParameter, gerror.New("sql: no rows")))
+	if errMsg.Message != gcode.CodeInvalidParameter.Message() {
+		t.Fatal(errMsg)
+	}
+}
+
+func Test_Router_JsonCodec(t *testing.T) {
+	router := &Router{}
+	router.Group("codec").AddRoute("echo", func(req *Request, msg *types.DoubleValue) (*types.FloatValue, error) {
+		return &types.FloatValue{Value: float32(msg.Value)}, nil
+	})
+
+	// 同一个Handler处理JSON编码的请求，响应同样使用JSON编码
+	conn := &replyConn{}
+	SetCodec(conn, JsonCodec)
+	msgId := RouteItemMgr.GetMsgId("google.protobuf.DoubleValue")
+	router.Run(NewRequest(conn, NewMsg(msgId, []byte("1.5"))))
+	if conn.msg == nil || string(conn.msg.GetData()) != "1.5" {
+		t.Fatal(conn.msg)
+	}
+
+	codec, ok := GetCodecByName(CodecJson)
+	resp := &types.FloatValue{}
+	if !ok || codec.Unmarshal(conn.msg.GetData(), resp) != nil || resp.Value != 1.5 {
+		t.Fatal(resp)
+	}
+}
+
+func Test_Router_HotReload(t *testing.T) {
+	router := &Router{}
+	group := router.Group("reload")
+	var calls int32
+	group.AddRoute("get", func(req *Request, msg *types.BoolValue) {
+		atomic.AddInt32(&calls, 1)
+	})
+
+	msgId := RouteItemMgr.GetMsgId("google.protobuf.BoolValue")
+	conn := &replyConn{}
+	data, _ := gserialize.Protobuf.Marshal(&types.BoolValue{Value: true})
+
+	// 处理消息的同时替换路由、添加中间件
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				router.Run(NewRequest(conn, NewMsg(msgId, data)))
+			}
+		}()
+	}
+	group.AddRoute("get", func(req *Request, msg *types.BoolValue) {
+		atomic.AddInt32(&calls, 1)
+	})
+	group.Use(func(next HandlerFunc) HandlerFunc {
+		return func(request *Request, msg proto.Message) {
+			atomic.AddInt32(&calls, 1)
+			next(request, msg)
+		}
+	})
+	wg.Wait()
+
+	before := atomic.LoadInt32(&calls)
+	router.Run(NewRequest(conn, NewMsg(msgId, data)))
+	if atomic.LoadInt32(&calls)-before != 2 {
+		t.Fatal("middleware not applied after reload")
+	}
+	if RouteItemMgr.GetRoute(msgId) != "reload.get" {
+		t.Fatal(RouteItemMgr.GetRoute(msgId))
+	}
+}
@@ -0,0 +1,150 @@
+package gnet
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func newSecurePair(t *testing.T) (*SecureSession, *SecureSession) {
+	server, err := NewSecureSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewSecureSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Establish(client.GetPublicKey(), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Establish(server.GetPublicKey(), false); err != nil {
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+func Test_SecureSession(t *testing.T) {
+	server, client := newSecurePair(t)
+
+	sealed, err := client.Seal([]byte("gserver"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := server.Open(sealed)
+	if err != nil || string(plain) != "gserver" {
+		t.Fatal(err, string(plain))
+	}
+
+	// 重放消息
+	if _, err := server.Open(sealed); err != ErrSecureMsg {
+		t.Fatal(err)
+	}
+	// 同方向密钥不能解密自己发出的消息
+	if _, err := client.Open(sealed); err != ErrSecureMsg {
+		t.Fatal(err)
+	}
+	// 篡改消息
+	sealed, _ = client.Seal([]byte("gserver"))
+	sealed[len(sealed)-1] ^= 0xFF
+	if _, err := server.Open(sealed); err != ErrSecureMsg {
+		t.Fatal(err)
+	}
+	// 未加密消息
+	if _, err := server.Open([]byte("gserver")); err != ErrSecureMsg {
+		t.Fatal(err)
+	}
+}
+
+func Test_SecureSession_Window(t *testing.T) {
+	server, client := newSecurePair(t)
+
+	var msgs [][]byte
+	for i := 0; i < 3; i++ {
+		sealed, _ := client.Seal([]byte{byte(i)})
+		msgs = append(msgs, sealed)
+	}
+	// 窗口内允许乱序到达
+	for _, i := range []int{2, 0, 1} {
+		if _, err := server.Open(msgs[i]); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+
+	// 超出窗口的旧消息被拒绝
+	old, _ := client.Seal([]byte("old"))
+	for i := 0; i < secureReplayWindow; i++ {
+		sealed, _ := client.Seal([]byte("new"))
+		if _, err := server.Open(sealed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := server.Open(old); err != ErrSecureMsg {
+		t.Fatal(err)
+	}
+}
+
+func Test_SecureHandshake(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	dp := NewDataPack()
+	sessionCh := make(chan *SecureSession, 1)
+	go func() {
+		session, err := ServerHandshake(serverConn, dp)
+		if err != nil {
+			t.Error(err)
+		}
+		sessionCh <- session
+	}()
+	clientSession, err := ClientHandshake(clientConn, dp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverSession := <-sessionCh
+	if serverSession == nil {
+		t.FailNow()
+	}
+
+	serverDp := NewSecureDataPack(dp, serverSession)
+	clientDp := NewSecureDataPack(dp, clientSession)
+	msg := NewMsg(1, []byte("gserver"))
+	data, err := clientDp.Pack(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.GetData()) != "gserver" || bytes.Contains(data, []byte("gserver")) {
+		t.Fatal("msg not encrypted or original msg modified")
+	}
+	got, err := ReadMsg(serverDp, bytes.NewReader(data))
+	if err != nil || got.GetMsgId() != 1 || string(got.GetData()) != "gserver" {
+		t.Fatal(err, got)
+	}
+
+	// 未加密消息被拒绝
+	data, _ = dp.Pack(NewMsg(1, []byte("gserver")))
+	if _, err := ReadMsg(serverDp, bytes.NewReader(data)); err != ErrSecureMsg {
+		t.Fatal(err)
+	}
+}
+
+func Test_SecureDataPack_Compress(t *testing.T) {
+	serverSession, clientSession := newSecurePair(t)
+	serverDp := NewSecureDataPack(NewCompressDataPack(nil), serverSession)
+	clientDp := NewSecureDataPack(NewCompressDataPack(nil), clientSession)
+
+	// 先压缩再加密，可压缩的消息体加密后仍然变小
+	body := bytes.Repeat([]byte("gserver"), 1024)
+	data, err := clientDp.Pack(NewMsg(1, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(body) {
+		t.Fatal("msg not compressed before encryption", len(data))
+	}
+	got, err := ReadMsg(serverDp, bytes.NewReader(data))
+	if err != nil || !bytes.Equal(got.GetData(), body) || got.GetFlags()&flagCompressMask != 0 {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,152 @@
+// Package gnetgen 根据路由表(RouteItemMgr.ExportJSON导出)生成客户端消息ID常量文件
+package gnetgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Ravior/gserver/net/gnet"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const header = "// Code generated by gmsgidgen. DO NOT EDIT.\n"
+
+// Option 代码生成配置
+type Option struct {
+	Namespace string // C#命名空间(为空时不生成命名空间)
+	ClassName string // 常量类/枚举名称，默认为MsgId
+}
+
+func (o Option) className() string {
+	if o.ClassName == "" {
+		return "MsgId"
+	}
+	return o.ClassName
+}
+
+// constItem 消息ID常量
+type constItem struct {
+	Name  string
+	MsgId uint32
+	Proto string
+}
+
+// LoadRoutes 读取ExportJSON导出的路由表
+func LoadRoutes(r io.Reader) ([]*gnet.RouteItem, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var routes []*gnet.RouteItem
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// TypeScript 生成TypeScript消息ID枚举
+func TypeScript(routes []*gnet.RouteItem, option Option) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	buf.WriteString("\n")
+	fmt.Fprintf(&buf, "export enum %s {\n", option.className())
+	for _, item := range constItems(routes) {
+		fmt.Fprintf(&buf, "    %s = %d, // %s\n", item.Name, item.MsgId, item.Proto)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// CSharp 生成C#消息ID常量类
+func CSharp(routes []*gnet.RouteItem, option Option) []byte {
+	indent := ""
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	buf.WriteString("\n")
+	if option.Namespace != "" {
+		fmt.Fprintf(&buf, "namespace %s\n{\n", option.Namespace)
+		indent = "    "
+	}
+	fmt.Fprintf(&buf, "%spublic static class %s\n%s{\n", indent, option.className(), indent)
+	for _, item := range constItems(routes) {
+		fmt.Fprintf(&buf, "%s    public const uint %s = %d; // %s\n", indent, item.Name, item.MsgId, item.Proto)
+	}
+	fmt.Fprintf(&buf, "%s}\n", indent)
+	if option.Namespace != "" {
+		buf.WriteString("}\n")
+	}
+	return buf.Bytes()
+}
+
+// WriteFiles 在dir目录下生成 <ClassName>.ts 和 <ClassName>.cs
+func WriteFiles(routes []*gnet.RouteItem, dir string, option Option) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(dir, option.className())
+	if err := ioutil.WriteFile(name+".ts", TypeScript(routes, option), 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name+".cs", CSharp(routes, option), 0644)
+}
+
+// constItems 按消息ID排序并去重(同一Proto可能对应多个路由)，常量名默认使用Proto短名称，
+// 短名称重复时使用Proto全名
+func constItems(routes []*gnet.RouteItem) []*constItem {
+	protos := make(map[string]uint32)
+	shortNames := make(map[string]int)
+	for _, route := range routes {
+		if route.Proto == "" {
+			continue
+		}
+		if _, ok := protos[route.Proto]; !ok {
+			shortNames[shortName(route.Proto)]++
+		}
+		protos[route.Proto] = route.MsgId
+	}
+
+	items := make([]*constItem, 0, len(protos))
+	for proto, msgId := range protos {
+		name := shortName(proto)
+		if shortNames[name] > 1 {
+			name = identifier(proto)
+		}
+		items = append(items, &constItem{Name: name, MsgId: msgId, Proto: proto})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].MsgId != items[j].MsgId {
+			return items[i].MsgId < items[j].MsgId
+		}
+		return items[i].Proto < items[j].Proto
+	})
+	return items
+}
+
+func shortName(proto string) string {
+	return identifier(proto[strings.LastIndex(proto, ".")+1:])
+}
+
+// identifier 将Proto名称转换为合法的标识符
+func identifier(name string) string {
+	b := strings.Builder{}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+			b.WriteRune(r)
+		case unicode.IsDigit(r):
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
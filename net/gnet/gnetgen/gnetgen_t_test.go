@@ -0,0 +1,34 @@
+package gnetgen
+
+import (
+	"github.com/Ravior/gserver/net/gnet"
+	"strings"
+	"testing"
+)
+
+var routes = []*gnet.RouteItem{
+	{MsgId: 2, Proto: "pb.LoginResp", Route: "user.loginResp"},
+	{MsgId: 1, Proto: "pb.LoginReq", Route: "user.login"},
+	{MsgId: 1, Proto: "pb.LoginReq", Route: "gm.login"},
+	{MsgId: 3, Proto: "gm.LoginReq", Route: "gm.gmLogin"},
+}
+
+func Test_TypeScript(t *testing.T) {
+	code := string(TypeScript(routes, Option{}))
+	expect := "export enum MsgId {\n" +
+		"    pb_LoginReq = 1, // pb.LoginReq\n" +
+		"    LoginResp = 2, // pb.LoginResp\n" +
+		"    gm_LoginReq = 3, // gm.LoginReq\n" +
+		"}\n"
+	if !strings.HasSuffix(code, expect) {
+		t.Fatal(code)
+	}
+}
+
+func Test_CSharp(t *testing.T) {
+	code := string(CSharp(routes, Option{Namespace: "Game.Proto", ClassName: "MsgIds"}))
+	if !strings.Contains(code, "namespace Game.Proto\n{\n    public static class MsgIds\n") ||
+		!strings.Contains(code, "        public const uint LoginResp = 2; // pb.LoginResp\n") {
+		t.Fatal(code)
+	}
+}
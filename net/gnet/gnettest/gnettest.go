@@ -0,0 +1,117 @@
+// Package gnettest 提供gnet消息处理器的单元测试工具: 记录发送消息的测试链接、基于管道的进程内Socket、
+// 可控时钟，无需启动真实服务器即可测试包含中间件在内的完整处理链
+package gnettest
+
+import (
+	"encoding/json"
+	"github.com/Ravior/gserver/net/gnet"
+	"github.com/Ravior/gserver/util/gserialize"
+	"github.com/golang/protobuf/proto"
+	"testing"
+	"time"
+)
+
+// DefaultTimeout 等待响应消息的默认超时时长
+var DefaultTimeout = time.Second
+
+// Tester 消息处理测试器，将消息同步交给路由处理，并断言处理器发送的响应消息
+type Tester struct {
+	Router  *gnet.Router
+	Conn    *Conn
+	Timeout time.Duration // 等待响应消息的超时时长
+	seq     uint32
+}
+
+// New 创建消息处理测试器
+func New(router *gnet.Router) *Tester {
+	return &Tester{
+		Router:  router,
+		Conn:    NewConn(1),
+		Timeout: DefaultTimeout,
+	}
+}
+
+// Send 使用链接的编解码器编码消息，消息ID根据Proto名称获取，携带新的请求序列号交给路由处理
+func (t *Tester) Send(msg proto.Message) error {
+	data, err := gnet.GetCodec(t.Conn).Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.SendMsg(gnet.RouteItemMgr.GetMsgIdOf(msg), data)
+	return nil
+}
+
+// SendMsg 将原始消息携带新的请求序列号交给路由处理
+func (t *Tester) SendMsg(msgId uint32, data []byte) {
+	t.seq++
+	t.Router.Run(gnet.NewRequest(t.Conn, gnet.NewMsg(msgId, data).WithSeqId(t.seq)))
+}
+
+// GetSeqId 获取最后一次发送的请求序列号
+func (t *Tester) GetSeqId() uint32 {
+	return t.seq
+}
+
+// ExpectReply 断言收到resp类型的响应消息并解码到resp
+func (t *Tester) ExpectReply(tb testing.TB, resp proto.Message) *gnet.Msg {
+	tb.Helper()
+
+	msg := t.next(tb)
+	if msg.GetMsgId() == gnet.ErrorMsgId {
+		errMsg, _ := t.decodeError(msg)
+		tb.Fatalf("gnettest: expect reply %s, got error %v", gserialize.Protobuf.GetMessageName(resp), errMsg)
+	}
+	name := gserialize.Protobuf.GetMessageName(resp)
+	if msgId := gnet.RouteItemMgr.GetMsgIdOf(resp); msg.GetMsgId() != msgId {
+		tb.Fatalf("gnettest: expect reply %s(MsgId:%d), got MsgId:%d", name, msgId, msg.GetMsgId())
+	}
+	if err := gnet.GetCodec(t.Conn).Unmarshal(msg.GetData(), resp); err != nil {
+		tb.Fatalf("gnettest: unmarshal reply %s failed, %v", name, err)
+	}
+	return msg
+}
+
+// ExpectError 断言收到标准错误消息
+func (t *Tester) ExpectError(tb testing.TB) *gnet.ErrorMsg {
+	tb.Helper()
+
+	msg := t.next(tb)
+	if msg.GetMsgId() != gnet.ErrorMsgId {
+		tb.Fatalf("gnettest: expect error msg, got MsgId:%d", msg.GetMsgId())
+	}
+	errMsg, err := t.decodeError(msg)
+	if err != nil {
+		tb.Fatalf("gnettest: decode error msg failed, %v", err)
+	}
+	return errMsg
+}
+
+// ExpectNoReply 断言没有未读取的响应消息
+func (t *Tester) ExpectNoReply(tb testing.TB) {
+	tb.Helper()
+
+	if msg, ok := t.Conn.Next(0); ok {
+		tb.Fatalf("gnettest: expect no reply, got MsgId:%d", msg.GetMsgId())
+	}
+}
+
+func (t *Tester) next(tb testing.TB) *gnet.Msg {
+	tb.Helper()
+
+	msg, ok := t.Conn.Next(t.Timeout)
+	if !ok {
+		tb.Fatalf("gnettest: no reply in %s", t.Timeout)
+	}
+	if msg.GetSeqId() != t.seq {
+		tb.Fatalf("gnettest: expect reply SeqId:%d, got SeqId:%d", t.seq, msg.GetSeqId())
+	}
+	return msg
+}
+
+func (t *Tester) decodeError(msg *gnet.Msg) (*gnet.ErrorMsg, error) {
+	if gnet.GetCodec(t.Conn).GetName() == gnet.CodecJson {
+		errMsg := &gnet.ErrorMsg{}
+		return errMsg, json.Unmarshal(msg.GetData(), errMsg)
+	}
+	return gnet.UnmarshalErrorMsg(msg.GetData())
+}
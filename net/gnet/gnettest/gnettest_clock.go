@@ -0,0 +1,122 @@
+package gnettest
+
+import (
+	"github.com/Ravior/gserver/net/gnet"
+	"sync"
+	"time"
+)
+
+// FakeClock 可控时钟，实现gnet.Clock，只有调用Advance时时间才会前进并触发到期的定时器
+type FakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFakeClock 创建可控时钟
+func NewFakeClock() *FakeClock {
+	return &FakeClock{now: time.Unix(0, 0)}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) gnet.Timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	c.schedule(t, d)
+	return t
+}
+
+// Advance 时间前进d，并触发期间到期的定时器
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		if t.active && !t.when.After(c.now) {
+			t.active = false
+			select {
+			case t.c <- c.now:
+			default:
+			}
+		}
+	}
+}
+
+// BlockUntil 阻塞等待直到有n个等待中的定时器(被测组件在协程中创建定时器时使用)，超时返回false
+func (c *FakeClock) BlockUntil(n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if c.activeTimers() >= n {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (c *FakeClock) activeTimers() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	n := 0
+	for _, t := range c.timers {
+		if t.active {
+			n++
+		}
+	}
+	return n
+}
+
+// schedule 设置定时器到期时间，已到期时立即触发(需持有锁)
+func (c *FakeClock) schedule(t *fakeTimer, d time.Duration) {
+	t.when = c.now.Add(d)
+	t.active = d > 0
+	if !t.active {
+		select {
+		case t.c <- c.now:
+		default:
+		}
+	}
+}
+
+// fakeTimer 可控时钟的定时器
+type fakeTimer struct {
+	clock  *FakeClock
+	c      chan time.Time
+	when   time.Time
+	active bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	active := t.active
+	t.active = false
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	active := t.active
+	t.clock.schedule(t, d)
+	return active
+}
@@ -0,0 +1,187 @@
+package gnettest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/Ravior/gserver/net/gnet"
+	"github.com/gorilla/websocket"
+	"go.uber.org/atomic"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var ErrConnClosed = errors.New("gnettest: connection has been closed")
+
+// pipeAddr 进程内链接地址
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// Conn 测试用链接，实现gnet.IConnection，记录全部发送的消息(按封包格式解包后)；
+// 设置了管道时发送的数据写入管道
+type Conn struct {
+	gnet.ConnProperty
+	connId   uint32
+	socket   gnet.ISocket
+	dataPack gnet.IDataPack
+	closed   atomic.Bool
+	writer   io.WriteCloser // 管道写入端(为nil时只记录消息)
+	lock     sync.Mutex
+	sent     []*gnet.Msg   // 已发送的消息
+	read     int           // 已通过Next读取的消息数量
+	notify   chan struct{} // 有新消息发送时通知
+}
+
+// NewConn 创建测试用链接，默认封包格式开启序列号扩展包头
+func NewConn(connId uint32) *Conn {
+	dataPack := gnet.NewDataPack()
+	dataPack.SetSeqEnabled(true)
+	return &Conn{
+		connId:   connId,
+		dataPack: dataPack,
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// SetSocket 设置链接所属的Socket对象
+func (c *Conn) SetSocket(socket gnet.ISocket) {
+	c.socket = socket
+}
+
+func (c *Conn) Start() {}
+
+func (c *Conn) Stop() {
+	if !c.SetClosed() {
+		return
+	}
+	if c.writer != nil {
+		_ = c.writer.Close()
+	}
+}
+
+func (c *Conn) GetTcpConnection() *net.TCPConn {
+	return nil
+}
+
+func (c *Conn) GetNetConnection() net.Conn {
+	return nil
+}
+
+func (c *Conn) GetWsConnection() *websocket.Conn {
+	return nil
+}
+
+func (c *Conn) GetProtocolType() gnet.ProtocolType {
+	return gnet.Tcp
+}
+
+func (c *Conn) GetSocket() gnet.ISocket {
+	return c.socket
+}
+
+func (c *Conn) GetConnID() uint32 {
+	return c.connId
+}
+
+func (c *Conn) IsClosed() bool {
+	return c.closed.Load()
+}
+
+func (c *Conn) SetClosed() bool {
+	return c.closed.CAS(false, true)
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return pipeAddr("gnettest")
+}
+
+func (c *Conn) SendMsg(msgId uint32, data []byte) error {
+	return c.SendSeqMsg(msgId, 0, data)
+}
+
+func (c *Conn) SendSeqMsg(msgId uint32, seqId uint32, data []byte) error {
+	packed, err := c.dataPack.Pack(gnet.NewMsg(msgId, data).WithSeqId(seqId))
+	if err != nil {
+		return err
+	}
+	return c.SendPackedMsg(packed)
+}
+
+func (c *Conn) SendPackedMsg(data []byte) error {
+	if c.IsClosed() {
+		return ErrConnClosed
+	}
+	msg, err := gnet.ReadMsg(c.dataPack, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	c.sent = append(c.sent, msg)
+	c.lock.Unlock()
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+
+	if c.writer != nil {
+		_, err = c.writer.Write(data)
+	}
+	return err
+}
+
+func (c *Conn) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (c *Conn) GetDataPack() gnet.IDataPack {
+	return c.dataPack
+}
+
+func (c *Conn) SetDataPack(dataPack gnet.IDataPack) {
+	c.dataPack = dataPack
+}
+
+// Sent 获取已发送的全部消息
+func (c *Conn) Sent() []*gnet.Msg {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]*gnet.Msg(nil), c.sent...)
+}
+
+// Next 获取下一条未读取的发送消息，没有时等待直到超时
+func (c *Conn) Next(timeout time.Duration) (*gnet.Msg, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		c.lock.Lock()
+		if c.read < len(c.sent) {
+			msg := c.sent[c.read]
+			c.read++
+			c.lock.Unlock()
+			return msg, true
+		}
+		c.lock.Unlock()
+
+		select {
+		case <-c.notify:
+		case <-timer.C:
+			return nil, false
+		}
+	}
+}
+
+// Reset 清空已发送的消息
+func (c *Conn) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.sent = nil
+	c.read = 0
+}
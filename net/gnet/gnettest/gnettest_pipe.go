@@ -0,0 +1,72 @@
+package gnettest
+
+import (
+	"github.com/Ravior/gserver/net/gnet"
+	"net"
+	"time"
+)
+
+// Pipe 基于net.Pipe的进程内Socket: 服务端一侧按封包格式读取消息交给路由处理，处理器发送的消息写入管道；
+// 客户端一侧模拟真实客户端收发封包数据。管道没有缓冲，客户端需及时Recv，否则处理器发送消息会阻塞
+type Pipe struct {
+	Conn     *Conn // 服务端链接
+	router   *gnet.Router
+	client   net.Conn
+	server   net.Conn
+	dataPack gnet.IDataPack
+	done     chan struct{}
+}
+
+// NewPipe 创建进程内Socket并开始读取客户端消息
+func NewPipe(router *gnet.Router) *Pipe {
+	client, server := net.Pipe()
+	conn := NewConn(1)
+	conn.writer = server
+
+	p := &Pipe{
+		Conn:     conn,
+		router:   router,
+		client:   client,
+		server:   server,
+		dataPack: conn.GetDataPack(),
+		done:     make(chan struct{}),
+	}
+	go p.serve()
+	return p
+}
+
+// serve 服务端读取消息交给路由处理，直到管道关闭
+func (p *Pipe) serve() {
+	defer close(p.done)
+	for {
+		msg, err := gnet.ReadMsg(p.Conn.GetDataPack(), p.server)
+		if err != nil {
+			p.Conn.Stop()
+			return
+		}
+		p.router.Run(gnet.NewRequest(p.Conn, msg))
+	}
+}
+
+// Send 客户端发送消息
+func (p *Pipe) Send(msgId uint32, seqId uint32, data []byte) error {
+	packed, err := p.dataPack.Pack(gnet.NewMsg(msgId, data).WithSeqId(seqId))
+	if err != nil {
+		return err
+	}
+	_, err = p.client.Write(packed)
+	return err
+}
+
+// Recv 客户端读取一条消息，超时返回错误
+func (p *Pipe) Recv(timeout time.Duration) (*gnet.Msg, error) {
+	_ = p.client.SetReadDeadline(time.Now().Add(timeout))
+	return gnet.ReadMsg(p.dataPack, p.client)
+}
+
+// Close 关闭管道，并等待服务端停止读取
+func (p *Pipe) Close() {
+	_ = p.client.Close()
+	p.Conn.Stop()
+	<-p.done
+}
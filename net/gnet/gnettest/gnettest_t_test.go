@@ -0,0 +1,112 @@
+package gnettest
+
+import (
+	"context"
+	"github.com/Ravior/gserver/errors/gcode"
+	"github.com/Ravior/gserver/errors/gerror"
+	"github.com/Ravior/gserver/net/gnet"
+	"github.com/Ravior/gserver/util/gserialize"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/proto"
+	"testing"
+	"time"
+)
+
+func newRouter() *gnet.Router {
+	router := &gnet.Router{}
+	router.Group("test").Use(func(next gnet.HandlerFunc) gnet.HandlerFunc {
+		// 未登录时拒绝请求
+		return func(req *gnet.Request, msg proto.Message) {
+			if _, ok := req.GetConnection().GetProperty("uid"); !ok {
+				_ = req.ReplyError(gerror.NewCode(gcode.CodeNotAuthorized))
+				return
+			}
+			next(req, msg)
+		}
+	}).AddRoute("echo", func(req *gnet.Request, msg *types.StringValue) (*types.BytesValue, error) {
+		return &types.BytesValue{Value: []byte(msg.Value)}, nil
+	})
+	return router
+}
+
+func Test_Tester(t *testing.T) {
+	tester := New(newRouter())
+
+	if err := tester.Send(&types.StringValue{Value: "gserver"}); err != nil {
+		t.Fatal(err)
+	}
+	if errMsg := tester.ExpectError(t); errMsg.Code != int32(gcode.CodeNotAuthorized.Code()) {
+		t.Fatal(errMsg)
+	}
+
+	tester.Conn.SetProperty("uid", uint64(1001))
+	if err := tester.Send(&types.StringValue{Value: "gserver"}); err != nil {
+		t.Fatal(err)
+	}
+	resp := &types.BytesValue{}
+	tester.ExpectReply(t, resp)
+	if string(resp.Value) != "gserver" {
+		t.Fatal(resp.Value)
+	}
+	tester.ExpectNoReply(t)
+}
+
+func Test_Pipe(t *testing.T) {
+	pipe := NewPipe(newRouter())
+	defer pipe.Close()
+	pipe.Conn.SetProperty("uid", uint64(1001))
+
+	data, _ := gserialize.Protobuf.Marshal(&types.StringValue{Value: "pipe"})
+	if err := pipe.Send(gnet.RouteItemMgr.GetMsgId("google.protobuf.StringValue"), 3, data); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := pipe.Recv(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &types.BytesValue{}
+	if msg.GetSeqId() != 3 || gserialize.Protobuf.Unmarshal(msg.GetData(), resp) != nil || string(resp.Value) != "pipe" {
+		t.Fatal(msg, resp)
+	}
+	if len(pipe.Conn.Sent()) != 1 {
+		t.Fatal(pipe.Conn.Sent())
+	}
+}
+
+func Test_FakeClock_HeartBeat(t *testing.T) {
+	clock := NewFakeClock()
+	conn := NewConn(1)
+	heartBeat := gnet.NewHeartBeat(conn, gnet.HeartBeatOption{ReadIdle: 10 * time.Second, WriteIdle: 3 * time.Second, PingMsgId: 100})
+	heartBeat.SetClock(clock)
+
+	done := make(chan struct{})
+	go func() {
+		heartBeat.Run(context.Background())
+		close(done)
+	}()
+
+	// 写空闲时发送心跳消息
+	for i := 0; i < 3; i++ {
+		if !clock.BlockUntil(1, time.Second) {
+			t.Fatal("timer not created")
+		}
+		clock.Advance(3 * time.Second)
+		if msg, ok := conn.Next(time.Second); !ok || msg.GetMsgId() != 100 {
+			t.Fatal(msg, ok)
+		}
+	}
+
+	// 读空闲超时断开链接
+	if !clock.BlockUntil(1, time.Second) {
+		t.Fatal("timer not created")
+	}
+	clock.Advance(time.Second)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("read idle timeout not detected")
+	}
+	if !conn.IsClosed() {
+		t.Fail()
+	}
+}
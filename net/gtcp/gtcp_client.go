@@ -1,10 +1,14 @@
 package gtcp
 
 import (
-	"fmt"
+	"context"
+	"crypto/tls"
+	"errors"
 	"github.com/Ravior/gserver/net/gnet"
 	"github.com/Ravior/gserver/os/glog"
+	"github.com/golang/protobuf/proto"
 	"net"
+	"strconv"
 )
 
 var (
@@ -13,7 +17,7 @@ var (
 	defaultMaxMsgChanLen  uint32 = 10
 )
 
-// Client 客户端暂时只支持TCP链接
+// Client 客户端，支持TCP(可开启TLS)及Unix socket链接
 type Client struct {
 	name       string
 	id         string
@@ -21,11 +25,19 @@ type Client struct {
 	remoteIP   string
 	remotePort int32
 	msgHandler *gnet.MsgHandler
-	router     *gnet.Router // 消息路由器
+	router     *gnet.Router   // 消息路由器
+	callMgr    *gnet.CallMgr  // 请求/响应关联管理器
+	dataPack   gnet.IDataPack // 封包格式
+	secure     bool           // 是否开启加密传输
+	unixSocket string         // Unix socket文件路径
+	tlsConfig  *tls.Config    // TLS配置(为nil表示不开启)
 
-	connMgr     *gnet.ConnManager
-	onConnStart gnet.ConnCallback
-	onConnStop  gnet.ConnCallback
+	connMgr         *gnet.ConnManager
+	reconnector     *gnet.Reconnector // 断线重连组件(未设置重连策略时为nil)
+	onConnStart     gnet.ConnCallback
+	onConnStop      gnet.ConnCallback
+	onReconnect     gnet.ConnCallback      // 重连成功Hook函数
+	onReconnectFail gnet.ReconnectFailFunc // 达到最大重连次数Hook函数
 }
 
 func NewClient(clientId string, clientName string, remoteIP string, remotePort int32) *Client {
@@ -38,8 +50,11 @@ func NewClient(clientId string, clientName string, remoteIP string, remotePort i
 		router:     &gnet.Router{},
 		msgHandler: gnet.NewMsgHandler(defaultWorkerPoolSize, defaultWorkerTaskSize),
 		connMgr:    gnet.NewConnManager(),
+		callMgr:    gnet.NewCallMgr(),
+		dataPack:   NewDataPack(),
 	}
 	client.msgHandler.SetRouter(client.router)
+	client.msgHandler.SetCallMgr(client.callMgr)
 	return client
 }
 
@@ -70,6 +85,10 @@ func (c *Client) Start() {
 
 // Stop 关闭
 func (c *Client) Stop() {
+	// 先停止重连，避免链接断开后再次触发重连
+	if c.reconnector != nil {
+		c.reconnector.Stop()
+	}
 	c.msgHandler.StopWorkerPool()
 	c.connMgr.ClearConn()
 }
@@ -77,24 +96,45 @@ func (c *Client) Stop() {
 func (c *Client) Run() {
 	c.Start()
 
-	addr, err := net.ResolveTCPAddr(c.ipVersion, fmt.Sprintf("%s:%d", c.GetHost(), c.GetPort()))
-	if err != nil {
-		glog.Warnf("Resolve TCP Addr Err:%v", err.Error())
-		return
+	if _, err := c.dial(); err != nil {
+		// 开启了断线重连，按重连策略继续尝试链接
+		if c.reconnector != nil {
+			c.reconnector.Trigger()
+			return
+		}
+		conn := NewConnection(c, nil, 0, c.msgHandler, defaultMaxMsgChanLen)
+		c.CallOnConnStop(conn)
+	}
+}
+
+// dial 链接服务器并启动链接
+func (c *Client) dial() (gnet.IConnection, error) {
+	addr := net.JoinHostPort(c.GetHost(), strconv.Itoa(int(c.GetPort())))
+	if c.ipVersion == "unix" {
+		addr = c.unixSocket
 	}
 
-	connServer, err := net.DialTCP(c.ipVersion, nil, addr)
+	var connServer net.Conn
+	var err error
+	if c.tlsConfig != nil {
+		connServer, err = tls.Dial(c.ipVersion, addr, c.tlsConfig)
+	} else {
+		connServer, err = net.Dial(c.ipVersion, addr)
+	}
 	if err != nil {
 		glog.Warnf("Connect To Server Fail, Addr: %v, Err:%v", addr, err.Error())
-		conn := NewConnection(c, nil, 0, c.msgHandler, defaultMaxMsgChanLen)
-		c.CallOnConnStop(conn)
-		return
+		return nil, err
 	}
 
 	// 保证Client的时候只有一个Conn
 	c.connMgr.ClearConn()
 	conn := NewConnection(c, connServer, 0, c.msgHandler, defaultMaxMsgChanLen)
+	conn.SetSecure(c.secure)
 	conn.Start()
+	if conn.IsClosed() {
+		return nil, errors.New("connection closed while starting")
+	}
+	return conn, nil
 }
 
 func (c *Client) GetRouter() *gnet.Router {
@@ -110,6 +150,87 @@ func (c *Client) GetConn() gnet.IConnection {
 	}
 }
 
+// Call 发送请求并阻塞等待匹配的响应消息，直到响应到达或者ctx超时(需开启封包格式的序列号扩展包头)
+func (c *Client) Call(ctx context.Context, msgId uint32, req proto.Message, resp proto.Message) error {
+	return c.callMgr.Call(ctx, c.GetConn(), msgId, req, resp)
+}
+
+// SendMsg 发送消息，开启断线重连且配置了缓存时，断线期间的消息将在重连成功后发送
+func (c *Client) SendMsg(msgId uint32, data []byte) error {
+	if c.reconnector != nil {
+		return c.reconnector.Send(c.GetConn(), msgId, data)
+	}
+	conn := c.GetConn()
+	if conn == nil {
+		return gnet.ErrCallNoConn
+	}
+	return conn.SendMsg(msgId, data)
+}
+
+// SetSecure 设置是否开启加密传输(服务器需同时开启)，密钥交换不验证身份，无法防止中间人攻击，需要时使用TLS
+func (c *Client) SetSecure(secure bool) {
+	c.secure = secure
+}
+
+// SetNetwork 设置网络类型: "tcp4"、"tcp"或"tcp6"，需在Run之前设置
+func (c *Client) SetNetwork(network string) {
+	c.ipVersion = network
+}
+
+// SetUnixSocket 通过Unix socket链接服务器，需在Run之前设置
+func (c *Client) SetUnixSocket(path string) {
+	c.ipVersion = "unix"
+	c.unixSocket = path
+}
+
+// SetTLSConfig 设置TLS配置(为nil表示不开启)，需在Run之前设置
+func (c *Client) SetTLSConfig(tlsConfig *tls.Config) {
+	c.tlsConfig = tlsConfig
+}
+
+// SetReconnectPolicy 设置断线重连策略(需在Run之前设置，nil表示不重连)
+func (c *Client) SetReconnectPolicy(policy *gnet.ReconnectPolicy) {
+	if policy == nil {
+		c.reconnector = nil
+		return
+	}
+	c.reconnector = gnet.NewReconnector(policy, c.dial, c.CallOnReconnect, c.CallOnReconnectFail)
+}
+
+// SetOnReconnect 设置重连成功Hook函数(在发送断线期间缓存的消息之前调用，可用于重新登录)
+func (c *Client) SetOnReconnect(connCallback gnet.ConnCallback) {
+	c.onReconnect = connCallback
+}
+
+// SetOnReconnectFail 设置达到最大重连次数Hook函数
+func (c *Client) SetOnReconnectFail(failCallback gnet.ReconnectFailFunc) {
+	c.onReconnectFail = failCallback
+}
+
+// CallOnReconnect 调用重连成功Hook函数
+func (c *Client) CallOnReconnect(conn gnet.IConnection) {
+	if c.onReconnect != nil {
+		c.onReconnect(conn)
+	}
+}
+
+// CallOnReconnectFail 调用达到最大重连次数Hook函数
+func (c *Client) CallOnReconnectFail(attempts int, err error) {
+	if c.onReconnectFail != nil {
+		c.onReconnectFail(attempts, err)
+	}
+}
+
+// GetDataPack 获取封包格式
+func (c *Client) GetDataPack() gnet.IDataPack {
+	return c.dataPack
+}
+
+// SetDataPack 设置封包格式
+func (c *Client) SetDataPack(dataPack gnet.IDataPack) {
+	c.dataPack = dataPack
+}
+
 func (c *Client) GetConnMgr() *gnet.ConnManager {
 	return c.connMgr
 }
@@ -129,7 +250,13 @@ func (c *Client) CallOnConnStart(conn gnet.IConnection) {
 }
 
 func (c *Client) CallOnConnStop(conn gnet.IConnection) {
+	// 链接断开，取消全部等待中的请求
+	c.callMgr.CancelAll()
 	if c.onConnStop != nil {
 		c.onConnStop(conn)
 	}
+	// 开启了断线重连，链接断开后自动重连
+	if c.reconnector != nil {
+		c.reconnector.Trigger()
+	}
 }
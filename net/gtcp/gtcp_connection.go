@@ -7,32 +7,47 @@ import (
 	"github.com/Ravior/gserver/net/gnet"
 	"github.com/Ravior/gserver/os/glog"
 	"github.com/gorilla/websocket"
-	"io"
 	"net"
 	"sync/atomic"
+	"time"
 )
 
+// secureHandshakeTimeout 加密握手超时时间
+var secureHandshakeTimeout = 10 * time.Second
+
+// maxWriteBatch 写消息Goroutine每次合并写出的最大消息数量
+const maxWriteBatch = 64
+
 type Connection struct {
-	isClosed   int32              // 当前链接的关闭状态(采用原子操作处理)
-	connID     uint32             // 当前链接的ID, 也可以称作为SessionID，ID全局唯一
-	msgChan    chan []byte        // 缓冲管道，用于读、写两个goroutine之间的消息通信
-	msgHandler *gnet.MsgHandler   // 消息处理模块
-	socket     gnet.ISocket       // 当前链接关联的Socket
-	conn       *net.TCPConn       // 当前链接的TCP套接字
-	ctx        context.Context    // 告知该链接已经退出/停止的channel
-	cancel     context.CancelFunc // cancelFunc
+	gnet.ConnProperty                    // 链接自定义属性
+	isClosed          int32              // 当前链接的关闭状态(采用原子操作处理)
+	pending           int32              // 缓冲管道中还未写出的消息数量
+	connID            uint32             // 当前链接的ID, 也可以称作为SessionID，ID全局唯一
+	msgChan           chan gnet.Buffer   // 缓冲管道，用于读、写两个goroutine之间的消息通信
+	msgHandler        *gnet.MsgHandler   // 消息处理模块
+	dataPack          gnet.IDataPack     // 封包格式
+	heartBeat         *gnet.HeartBeat    // 心跳组件
+	secure            bool               // 是否开启加密传输
+	socket            gnet.ISocket       // 当前链接关联的Socket
+	conn              net.Conn           // 当前链接的套接字(TCP、TLS、Unix socket等)
+	ctx               context.Context    // 告知该链接已经退出/停止的channel
+	cancel            context.CancelFunc // cancelFunc
 }
 
 // NewConnection 创建新的链接对象
-func NewConnection(socket gnet.ISocket, conn *net.TCPConn, connID uint32, msgHandler *gnet.MsgHandler, maxMsgChanLen uint32) *Connection {
+func NewConnection(socket gnet.ISocket, conn net.Conn, connID uint32, msgHandler *gnet.MsgHandler, maxMsgChanLen uint32) *Connection {
 	c := &Connection{
 		socket:     socket,
 		conn:       conn,
 		connID:     connID,
 		isClosed:   0,
 		msgHandler: msgHandler,
-		msgChan:    make(chan []byte, maxMsgChanLen),
+		dataPack:   socket.GetDataPack(),
+		msgChan:    make(chan gnet.Buffer, maxMsgChanLen),
 	}
+	// 在加入链接管理器之前创建，链接未Start时也可以被Stop
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.heartBeat = gnet.NewHeartBeat(c, gnet.HeartBeatOption{})
 
 	if conn != nil {
 		// 将新创建的Conn添加到链接管理器
@@ -45,6 +60,7 @@ func NewConnection(socket gnet.ISocket, conn *net.TCPConn, connID uint32, msgHan
 }
 
 // StartWriter 写消息Goroutine， 用户将数据发送给客户端
+// 缓冲管道中已有多条消息时合并为一次writev系统调用写出
 func (c *Connection) StartWriter() {
 	defer func() {
 		glog.Infof("Connection Writer Close, ConnId:%d", c.connID)
@@ -56,19 +72,22 @@ func (c *Connection) StartWriter() {
 
 	defer c.Stop()
 
+	batch := make([]gnet.Buffer, 0, maxWriteBatch)
+	iov := make(net.Buffers, 0, maxWriteBatch)
 	for {
 		select {
 		case data, ok := <-c.msgChan:
-			if ok {
-				// 有数据要写给客户端
-				if _, err := c.conn.Write(data); err != nil {
-					glog.Warnf("Connection write message has error: %s, ConnId:%d, Addr:%s 即将断开", err.Error(), c.connID, c.RemoteAddr())
-					return
-				}
-			} else {
+			if !ok {
 				glog.Warnf("MsgChan has been closed, ConnId:%d, Addr:%s 即将断开", c.connID, c.RemoteAddr())
-				break
+				return
 			}
+			// 有数据要写给客户端
+			batch = c.drainMsgChan(append(batch[:0], data))
+			if err := c.writeBatch(batch, iov); err != nil {
+				glog.Warnf("Connection write message has error: %s, ConnId:%d, Addr:%s 即将断开", err.Error(), c.connID, c.RemoteAddr())
+				return
+			}
+			c.heartBeat.OnWrite()
 		case <-c.ctx.Done():
 			glog.Debugf("Connection Context Is Cancel, Stop Writer, ConnId:%d, Addr:%s 即将断开", c.connID, c.RemoteAddr())
 			return
@@ -76,6 +95,40 @@ func (c *Connection) StartWriter() {
 	}
 }
 
+// drainMsgChan 非阻塞取出缓冲管道中已有的消息，最多合并maxWriteBatch条
+func (c *Connection) drainMsgChan(batch []gnet.Buffer) []gnet.Buffer {
+	for len(batch) < maxWriteBatch {
+		select {
+		case data, ok := <-c.msgChan:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, data)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// writeBatch 使用writev一次写出多条消息，写出后放回缓冲池
+func (c *Connection) writeBatch(batch []gnet.Buffer, iov net.Buffers) error {
+	for _, data := range batch {
+		iov = append(iov, data.B)
+	}
+	_, err := iov.WriteTo(c.conn)
+
+	for i := range batch {
+		batch[i].Release()
+		batch[i] = gnet.Buffer{}
+	}
+	if err != nil {
+		return err
+	}
+	atomic.AddInt32(&c.pending, -int32(len(batch)))
+	return nil
+}
+
 // StartReader 读消息Goroutine，用于从客户端中读取数据
 func (c *Connection) StartReader() {
 	defer func() {
@@ -94,31 +147,15 @@ func (c *Connection) StartReader() {
 			glog.Debugf("Connection Context Is Cancel, Stop Reader, ConnId:%d, Addr:%s 即将断开", c.connID, c.RemoteAddr())
 			return
 		default:
-			// 读取客户端的Msg head
-			headData := make([]byte, MsgPack.GetHeadLen())
-
-			if _, err := io.ReadFull(c.conn, headData); err != nil {
-				glog.Warnf("Connection read message has error: %s, ConnId:%d, (%s)即将断开", err.Error(), c.connID, c.RemoteAddr())
-				return
-			}
-
-			// 普通socket拆包，得到nameLen 和 dataLen 放在msg中
-			msg, err := MsgPack.Unpack(headData)
+			// 按封包格式读取客户端的Msg
+			msg, err := gnet.ReadMsg(c.dataPack, c.conn)
 			if err != nil {
-				glog.Errorf("Connection unpack message fail，err:%s, ConnId:%d, (%s)即将断开", err.Error(), c.connID, c.RemoteAddr())
+				glog.Warnf("Connection read message has error: %s, ConnId:%d, (%s)即将断开", err.Error(), c.connID, c.RemoteAddr())
 				return
 			}
 
-			// 根据 nameLen bodyLen 读取 CaveList
-			var data []byte
-			if msg.GetDataLen() > 0 {
-				data = make([]byte, msg.GetDataLen())
-				if _, err := io.ReadFull(c.conn, data); err != nil {
-					glog.Errorf("Connection read message fail，err:%s, ConnId:%d, (%s)即将断开", err.Error(), c.connID, c.RemoteAddr())
-					return
-				}
-			}
-			msg.SetData(data)
+			// 保持链接
+			c.heartBeat.KeepAlive()
 
 			// 得到当前客户端请求的Request数据
 			req := gnet.NewRequest(c, msg)
@@ -131,23 +168,29 @@ func (c *Connection) StartReader() {
 //============== 实现 interfaces.IConnection 里的全部接口方法 ========
 
 func (c *Connection) GetProtocolType() gnet.ProtocolType {
-	return gnet.WebSocket
+	return gnet.Tcp
 }
 
 func (c *Connection) Start() {
 	if c.conn != nil {
-		c.ctx, c.cancel = context.WithCancel(context.Background())
+		// 开启加密传输时，先完成密钥交换握手
+		if c.secure && !c.handshake() {
+			c.abort()
+			return
+		}
 		// 开启一个Go协程，从客户端读取数据
 		go c.StartReader()
 		// 开启一个Go协程，写回数据到客户端
 		go c.StartWriter()
+		// 开启心跳检测
+		go c.heartBeat.Run(c.ctx)
 
 		// 触发Socket中Conn Start钩子方法
 		c.socket.CallOnConnStart(c)
 	}
 }
 
-//Stop 停止连接，结束当前连接状态
+// Stop 停止连接，结束当前连接状态
 func (c *Connection) Stop() {
 	glog.Debugf("停止连接, ConnId:%d, Addr:%s", c.connID, c.RemoteAddr())
 
@@ -160,8 +203,7 @@ func (c *Connection) Stop() {
 
 	c.cancel()
 
-	// 关闭该链接全部管道
-	close(c.msgChan)
+	// 缓冲管道不关闭，写协程通过ctx退出，避免并发发送消息时向已关闭的管道写入
 
 	// 关闭socket链接
 	_ = c.conn.Close()
@@ -170,7 +212,23 @@ func (c *Connection) Stop() {
 	c.socket.GetConnMgr().Remove(c)
 
 	// 触发Socket中Conn Stop钩子方法(放在go内，防止回调出现死锁）
-	go c.socket.CallOnConnStop(c)
+	c.socket.GetConnMgr().GoCallback(c, c.socket.CallOnConnStop)
+}
+
+// abort 关闭未启动成功的链接，链接未触发OnConnStart，因此不触发OnConnStop
+func (c *Connection) abort() {
+	if c.SetClosed() == false {
+		return
+	}
+	glog.Infof("执行中止链接操作, ConnId:%d, Addr:%s", c.connID, c.RemoteAddr())
+
+	c.cancel()
+	_ = c.conn.Close()
+	c.socket.GetConnMgr().Remove(c)
+	// 释放准入时占用的连接数(正常关闭时在OnConnStop中释放)
+	if s, ok := c.socket.(*Server); ok {
+		s.admission.Release(gnet.AddrIp(c.RemoteAddr()))
+	}
 }
 
 func (c *Connection) GetConnID() uint32 {
@@ -186,6 +244,11 @@ func (c *Connection) IsClosed() bool {
 }
 
 func (c *Connection) GetTcpConnection() *net.TCPConn {
+	tcpConn, _ := c.conn.(*net.TCPConn)
+	return tcpConn
+}
+
+func (c *Connection) GetNetConnection() net.Conn {
 	return c.conn
 }
 
@@ -204,25 +267,103 @@ func (c *Connection) RemoteAddr() net.Addr {
 	return nil
 }
 
+// GetDataPack 获取链接的封包格式
+func (c *Connection) GetDataPack() gnet.IDataPack {
+	return c.dataPack
+}
+
+// SetDataPack 设置链接的封包格式(需在Start之前设置)
+func (c *Connection) SetDataPack(dataPack gnet.IDataPack) {
+	c.dataPack = dataPack
+}
+
 func (c *Connection) SendMsg(msgId uint32, data []byte) error {
+	return c.SendSeqMsg(msgId, 0, data)
+}
+
+// SendSeqMsg 发送携带请求序列号的消息
+func (c *Connection) SendSeqMsg(msgId uint32, seqId uint32, data []byte) error {
 	if data == nil {
 		return errors.New("connection send nil msg")
 	}
 
-	// 链接已关闭
-	if c.IsClosed() {
-		glog.Warnf("Connection has been closed when send msg, ConnId:%d, Addr:%s", c.connID, c.RemoteAddr())
-		return errors.New("connection has been closed when send msg")
-	}
-
 	// 将data封包，并且发送
-	p := gnet.NewMsg(msgId, data)
-	msg, err := MsgPack.Pack(p)
+	p := gnet.NewMsg(msgId, data).WithSeqId(seqId)
+	msg, err := gnet.PackBuffer(c.dataPack, p)
 	if err != nil {
 		glog.Errorf("Connection pack message fail，msgId:%d, msgData:%v, err:%s, ConnId:%d, Addr:%s", msgId, data, err.Error(), c.connID, c.RemoteAddr())
 		return errors.New(fmt.Sprintf("connection pack message fail, err:%v", err))
 	}
 
+	if err := c.writeMsgChan(msgId, msg); err != nil {
+		return err
+	}
+	gnet.MetricsMgr.OnSend(msgId, len(data))
+	return nil
+}
+
+// SendPackedMsg 发送已按链接封包格式封包好的数据(广播时只封包一次)
+func (c *Connection) SendPackedMsg(data []byte) error {
+	if data == nil {
+		return errors.New("connection send nil msg")
+	}
+	return c.writeMsgChan(0, gnet.NewBuffer(data))
+}
+
+// SetHeartBeat 设置心跳配置(需在Start之前设置)
+func (c *Connection) SetHeartBeat(option gnet.HeartBeatOption) {
+	c.heartBeat.SetOption(option)
+}
+
+// SetSecure 设置是否开启加密传输(需在Start之前设置，双方需同时开启)
+func (c *Connection) SetSecure(secure bool) {
+	c.secure = secure
+}
+
+// handshake 加密握手，握手成功后链接使用加密封包格式
+func (c *Connection) handshake() bool {
+	_ = c.conn.SetDeadline(time.Now().Add(secureHandshakeTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	var session *gnet.SecureSession
+	var err error
+	if _, ok := c.socket.(*Server); ok {
+		session, err = gnet.ServerHandshake(c.conn, c.dataPack)
+	} else {
+		session, err = gnet.ClientHandshake(c.conn, c.dataPack)
+	}
+	if err != nil {
+		glog.Warnf("Connection secure handshake fail: %s, ConnId:%d, Addr:%s 即将断开", err.Error(), c.connID, c.RemoteAddr())
+		return false
+	}
+
+	c.dataPack = gnet.NewSecureDataPack(c.dataPack, session)
+	return true
+}
+
+// Flush 等待缓冲管道中的数据全部写出(链接关闭或ctx超时返回)
+func (c *Connection) Flush(ctx context.Context) error {
+	return gnet.WaitUntil(ctx, func() bool {
+		return c.IsClosed() || atomic.LoadInt32(&c.pending) <= 0
+	})
+}
+
+// writeMsgChan 将封包好的数据写入缓冲管道
+func (c *Connection) writeMsgChan(msgId uint32, msg gnet.Buffer) error {
+	// 未写入缓冲管道的数据放回缓冲池
+	queued := false
+	defer func() {
+		if !queued {
+			msg.Release()
+		}
+	}()
+
+	// 链接已关闭
+	if c.IsClosed() {
+		glog.Warnf("Connection has been closed when send msg, ConnId:%d, Addr:%s", c.connID, c.RemoteAddr())
+		return errors.New("connection has been closed when send msg")
+	}
+
 	// 检测通道关闭Panic
 	defer func() {
 		if err := recover(); err != nil {
@@ -231,11 +372,15 @@ func (c *Connection) SendMsg(msgId uint32, data []byte) error {
 		}
 	}()
 
+	atomic.AddInt32(&c.pending, 1)
 	select {
 	case c.msgChan <- msg:
+		queued = true
 	case <-c.ctx.Done():
 		glog.Debugf("Connection Context Done, ConnId:%d, Addr:%s", c.connID, c.RemoteAddr())
+		atomic.AddInt32(&c.pending, -1)
 	default:
+		atomic.AddInt32(&c.pending, -1)
 		glog.Warnf("Connection Send Msg Error, I/O Buff Is Full Or Can't Write Msg To Client, MsgId:%d, ConnId:%d, Addr:%s", msgId, c.connID, c.RemoteAddr())
 		return errors.New("I/O Buff Is Full Or Can't Write Msg To Client")
 	}
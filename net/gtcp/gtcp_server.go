@@ -1,44 +1,121 @@
 package gtcp
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/Ravior/gserver/net/gnet"
 	"github.com/Ravior/gserver/os/glog"
 	"github.com/Ravior/gserver/util/gconfig"
 	"net"
 	"os"
+	"strconv"
 	"sync/atomic"
+	"time"
 )
 
+var defaultMaxPacketSize uint32 = 2048
+
+// rejectWriteTimeout 拒绝链接时发送拒绝消息的超时时间
+var rejectWriteTimeout = time.Second
+
+var errConnCheck = errors.New("connection check failed")
+
+// NewDataPack 创建默认封包格式 dataLen(4字节)|msgId(4字节)|body
+func NewDataPack() *gnet.DataPack {
+	dp := gnet.NewDataPack()
+	dp.SetMaxPacketSize(defaultMaxPacketSize)
+	return dp
+}
+
+// MsgPack 默认封包格式
+//
+// Deprecated: 封包格式已由每个Server/Client独立设置，修改MsgPack不会影响Server/Client，
+// 使用 NewDataPack 创建并通过 SetDataPack 设置
+var MsgPack = NewDataPack()
+
+// NewMsgPack 创建默认封包格式
+//
+// Deprecated: 使用 NewDataPack 代替
+func NewMsgPack() *gnet.DataPack {
+	return NewDataPack()
+}
+
+// NewCompressDataPack 创建支持消息体压缩的封包格式 dataLen(4字节)|msgId(4字节)|flags(2字节)|body
+func NewCompressDataPack(compressor gnet.ICompressor) *gnet.CompressDataPack {
+	dp := gnet.NewCompressDataPack(compressor)
+	dp.SetMaxPacketSize(defaultMaxPacketSize)
+	return dp
+}
+
 // Server 定义一个Server服务类，实现interfaces.IServer接口
 type Server struct {
-	name        string            // 服务器名称
-	id          string            // 服务器ID
-	ipVersion   string            // IP版本，"tcp"、"tcp4"或"tcp6"
-	ip          string            // Host
-	port        int32             // 端口
-	exit        chan bool         // 退出通道
-	listener    *net.TCPListener  // 服务器TCP监听器
-	connMgr     *gnet.ConnManager // 链接管理器
-	router      *gnet.Router      // 消息路由器
-	msgHandler  *gnet.MsgHandler  // 当前Server的消息管理模块，用来绑定消息ID和对应的处理方法
-	onConnStart gnet.ConnCallback // 有新的客户端链接时触发的Hook函数
-	onConnStop  gnet.ConnCallback // 当客户端链接断开时触发的Hook函数
+	name        string                   // 服务器名称
+	id          string                   // 服务器ID
+	ipVersion   string                   // 网络类型，"tcp"、"tcp4"、"tcp6"或"unix"
+	ip          string                   // Host
+	port        int32                    // 端口
+	connID      uint32                   // 链接ID
+	exit        chan bool                // 退出通道
+	unixSocket  string                   // Unix socket文件路径
+	listener    net.Listener             // 服务器监听器(可由调用方提供)
+	tlsConfig   *tls.Config              // TLS配置(为nil表示不开启)
+	certFile    string                   // SSL证书文件路径
+	keyFile     string                   // SSL密钥文件路径
+	connMgr     *gnet.ConnManager        // 链接管理器
+	router      *gnet.Router             // 消息路由器
+	msgHandler  *gnet.MsgHandler         // 当前Server的消息管理模块，用来绑定消息ID和对应的处理方法
+	dataPack    gnet.IDataPack           // 封包格式
+	heartBeat   gnet.HeartBeatOption     // 链接心跳配置
+	secure      bool                     // 是否开启加密传输
+	onConnStart gnet.ConnCallback        // 有新的客户端链接时触发的Hook函数
+	onConnStop  gnet.ConnCallback        // 当客户端链接断开时触发的Hook函数
+	closing     int32                    // 是否正在关闭(采用原子操作处理)
+	closingId   uint32                   // 服务器关闭时广播给客户端的消息ID
+	closingMsg  []byte                   // 服务器关闭时广播给客户端的消息
+	metricsId   uint32                   // 链接数量指标的注册ID
+	admission   *gnet.AdmissionPolicy    // 链接准入策略
+	authTimeout time.Duration            // 登录超时时长(0表示不检测)
+	rejectId    uint32                   // 拒绝链接时发送给客户端的消息ID
+	rejectMsg   []byte                   // 拒绝链接时发送给客户端的消息
+	onConnCheck func(conn net.Conn) bool // 链接校验判断
+	proxy       *gnet.ProxyProtocol      // PROXY protocol解析(为nil表示不开启)
+	proxyErr    error                    // PROXY protocol配置错误(Listen时返回)
 }
 
 func NewServer() *Server {
 	server := &Server{
-		id:         gconfig.Global.ServerId,
-		name:       gconfig.Global.ServerName,
-		ipVersion:  "tcp4",
-		ip:         gconfig.Global.TcpServer.IP,
-		port:       gconfig.Global.TcpServer.Port,
-		connMgr:    gnet.NewConnManager(),
-		router:     &gnet.Router{},
-		exit:       make(chan bool, 1),
-		msgHandler: gnet.NewMsgHandler(gconfig.Global.TcpServer.WorkerPoolSize, gconfig.Global.TcpServer.WorkerTaskLen),
+		id:          gconfig.Global.ServerId,
+		name:        gconfig.Global.ServerName,
+		ipVersion:   "tcp4",
+		ip:          gconfig.Global.TcpServer.IP,
+		port:        gconfig.Global.TcpServer.Port,
+		unixSocket:  gconfig.Global.TcpServer.UnixSocket,
+		certFile:    gconfig.Global.TcpServer.CertFile,
+		keyFile:     gconfig.Global.TcpServer.KeyFile,
+		connMgr:     gnet.NewConnManager(),
+		router:      &gnet.Router{},
+		exit:        make(chan bool, 1),
+		dataPack:    NewDataPack(),
+		msgHandler:  gnet.NewMsgHandler(gconfig.Global.TcpServer.WorkerPoolSize, gconfig.Global.TcpServer.WorkerTaskLen),
+		heartBeat:   gnet.NewHeartBeatOption(gconfig.Global.TcpServer.ReadIdle, gconfig.Global.TcpServer.WriteIdle, gconfig.Global.TcpServer.PingMsgId),
+		secure:      gconfig.Global.TcpServer.Secure,
+		admission:   gnet.NewAdmissionPolicy(),
+		authTimeout: time.Duration(gconfig.Global.TcpServer.AuthTimeout) * time.Second,
+	}
+	if gconfig.Global.TcpServer.Network != "" {
+		server.ipVersion = gconfig.Global.TcpServer.Network
 	}
 	server.msgHandler.SetRouter(server.router)
+	if err := server.ReloadAdmission(); err != nil {
+		glog.Errorf("Server load admission policy has error: %s", err.Error())
+	}
+	if gconfig.Global.TcpServer.ProxyProtocol {
+		// 配置错误时不能静默关闭PROXY protocol(负载均衡的头部会被当作消息解析)，由Listen返回错误
+		server.proxy, server.proxyErr = gnet.NewProxyProtocol(gconfig.Global.TcpServer.TrustedProxies)
+	}
+	server.metricsId = gnet.MetricsMgr.RegisterConnMgr("tcp", server.name, server.connMgr)
 	return server
 }
 
@@ -64,65 +141,261 @@ func (s *Server) GetPort() int32 {
 	return s.port
 }
 
-// Start 启动服务器
+// Start 启动服务器，证书加载或监听失败时记录错误并退出进程(需要处理启动错误时先调用Listen)
 func (s *Server) Start() {
 	glog.Infof("Server: %s StartWork", s.GetName())
-	// 开启一个Go协程去监听服务器端口
-	go func() {
-		// 启动消息Worker工作池
-		s.msgHandler.StartWorkerPool()
-
-		// 获取一个TCP的Addr
-		addr, err := net.ResolveTCPAddr(s.ipVersion, fmt.Sprintf("%s:%d", s.ip, s.port))
-		if err != nil {
-			os.Exit(0)
-		}
-
-		// 监听服务器地址
-		listener, err := net.ListenTCP(s.ipVersion, addr)
-		if err != nil {
-			os.Exit(0)
-		}
-		s.listener = listener
+	// 在Start返回前完成监听，启动失败不会被静默忽略
+	if err := s.Listen(); err != nil {
+		glog.Fatalf("Server: %s start fail, Error:%s", s.GetName(), err.Error())
+	}
+	// 启动消息Worker工作池(在Start返回前完成，Stop可以立即调用)
+	s.msgHandler.StartWorkerPool()
 
-		var connID uint32 = 0
+	// 开启PROXY protocol时，头部在独立协程中读取，避免阻塞Accept
+	var listener net.Listener = s.listener
+	if s.proxy != nil {
+		listener = gnet.NewProxyListener(listener, s.proxy)
+	}
+	glog.Infof("Server: %s Listen on %s://%s, TLS:%v", s.GetName(), listener.Addr().Network(), listener.Addr().String(), s.tlsConfig != nil)
 
-		// 处理TCP链接
+	// 开启一个Go协程去处理链接
+	go func() {
 		for {
 			// 阻塞等待客户端建立连接请求
-			conn, err := listener.AcceptTCP()
+			conn, err := listener.Accept()
 			if err != nil {
+				if atomic.LoadInt32(&s.closing) == 0 {
+					glog.Errorf("Server accept has error: %s", err.Error())
+				}
 				return
 			}
+			s.handleConn(conn)
+		}
+	}()
+}
 
-			// 最大连接数判断
-			if gconfig.Global.TcpServer.MaxConn > 0 && s.GetConnMgr().Len() >= gconfig.Global.TcpServer.MaxConn {
-				continue
-			}
+// Listen 加载证书并监听服务器地址，失败时返回错误；已监听(或SetListener设置了监听器)时直接返回
+// 需在Start之前调用，未调用时由Start调用
+func (s *Server) Listen() error {
+	if s.proxyErr != nil {
+		return errors.New(fmt.Sprintf("load proxy protocol fail, Error:%s", s.proxyErr.Error()))
+	}
+	if s.tlsConfig == nil && s.certFile != "" && s.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+		if err != nil {
+			return errors.New(fmt.Sprintf("load server certificate fail, Error:%s", err.Error()))
+		}
+		s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	if s.listener != nil {
+		return nil
+	}
+	listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	return nil
+}
+
+// listen 按网络类型监听服务器地址
+func (s *Server) listen() (net.Listener, error) {
+	if s.ipVersion == "unix" {
+		removeStaleUnixSocket(s.unixSocket)
+		return net.Listen("unix", s.unixSocket)
+	}
+	return net.Listen(s.ipVersion, net.JoinHostPort(s.ip, strconv.Itoa(int(s.port))))
+}
+
+// removeStaleUnixSocket 清理上次异常退出残留的socket文件
+// 只删除无法链接的socket文件，普通文件及其他运行中实例的socket文件保留，由监听返回错误
+func removeStaleUnixSocket(path string) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return
+	}
+	_ = os.Remove(path)
+}
+
+// handleConn 处理新链接
+func (s *Server) handleConn(conn net.Conn) {
+	// 服务器正在关闭(如PROXY头部读取期间执行了Shutdown)，不再接收新链接
+	if atomic.LoadInt32(&s.closing) == 1 {
+		_ = conn.Close()
+		return
+	}
+	// TLS握手在PROXY头部之后，首次读写时进行
+	if s.tlsConfig != nil {
+		conn = tls.Server(conn, s.tlsConfig)
+	}
 
-			// 创建链接对象
-			dealConn := NewConnection(s, conn, connID, s.msgHandler, gconfig.Global.TcpServer.MaxMsgChanLen)
+	// 链接准入判断(黑白名单、最大连接数、单IP连接数)
+	ip := gnet.AddrIp(conn.RemoteAddr())
+	if err := s.admission.Admit(ip); err != nil {
+		s.reject(conn, err)
+		return
+	}
+	if s.onConnCheck != nil && !s.onConnCheck(conn) {
+		s.admission.Release(ip)
+		s.reject(conn, errConnCheck)
+		return
+	}
+
+	// 创建链接对象
+	connID := atomic.AddUint32(&s.connID, 1) - 1
+	dealConn := NewConnection(s, conn, connID, s.msgHandler, gconfig.Global.TcpServer.MaxMsgChanLen)
+	dealConn.SetHeartBeat(s.heartBeat)
+	dealConn.SetSecure(s.secure)
+
+	// 加入链接管理器后再次判断，关闭期间加入的链接可能错过ClearConn
+	if atomic.LoadInt32(&s.closing) == 1 {
+		dealConn.abort()
+		return
+	}
 
-			// 原子+1
-			atomic.AddUint32(&connID, 1)
+	// 启动当前链接的处理业务
+	go dealConn.Start()
+}
 
-			// 启动当前链接的处理业务
-			go dealConn.Start()
+// reject 拒绝链接: 发送拒绝消息后关闭链接
+func (s *Server) reject(conn net.Conn, err error) {
+	glog.Warnf("Server reject connection: %s, Addr:%s", err.Error(), conn.RemoteAddr())
+	if s.rejectId == 0 {
+		_ = conn.Close()
+		return
+	}
 
+	go func() {
+		defer conn.Close()
+		data, err := s.dataPack.Pack(gnet.NewMsg(s.rejectId, s.rejectMsg))
+		if err != nil {
+			return
 		}
+		// TLS链接写入前需要完成握手，握手同样受超时限制
+		_ = conn.SetDeadline(time.Now().Add(rejectWriteTimeout))
+		_, _ = conn.Write(data)
 	}()
 }
 
+// GetAdmission 获取链接准入策略(可在运行时修改)
+func (s *Server) GetAdmission() *gnet.AdmissionPolicy {
+	return s.admission
+}
+
+// ReloadAdmission 根据当前配置(gconfig.Global.TcpServer)重新加载链接准入策略
+func (s *Server) ReloadAdmission() error {
+	cfg := gconfig.Global.TcpServer
+	s.admission.SetMaxConn(cfg.MaxConn)
+	s.admission.SetMaxConnPerIp(cfg.MaxConnPerIp)
+	return s.admission.SetCIDRs(cfg.AllowCIDRs, cfg.DenyCIDRs)
+}
+
+// SetRejectMsg 设置拒绝链接(服务器已满、IP受限等)时发送给客户端的消息，未设置时直接关闭链接
+func (s *Server) SetRejectMsg(msgId uint32, data []byte) {
+	s.rejectId = msgId
+	s.rejectMsg = data
+}
+
+// SetAuthTimeout 设置登录超时，链接建立后超过该时长未绑定用户(ConnManager.Bind)则断开(0表示不检测)
+func (s *Server) SetAuthTimeout(authTimeout time.Duration) {
+	s.authTimeout = authTimeout
+}
+
+// SetOnConnCheck 设置链接校验函数，返回false时拒绝链接
+func (s *Server) SetOnConnCheck(onConnCheck func(conn net.Conn) bool) {
+	s.onConnCheck = onConnCheck
+}
+
+// SetProxyProtocol 设置PROXY protocol解析，链接的RemoteAddr为头部中的客户端真实地址(为nil表示不开启)
+func (s *Server) SetProxyProtocol(proxy *gnet.ProxyProtocol) {
+	s.proxy, s.proxyErr = proxy, nil
+}
+
+// GetProxyProtocol 获取PROXY protocol解析
+func (s *Server) GetProxyProtocol() *gnet.ProxyProtocol {
+	return s.proxy
+}
+
+// SetNetwork 设置监听网络类型: "tcp4"、"tcp"(IPv4/IPv6双栈)或"tcp6"，需在Start之前设置
+func (s *Server) SetNetwork(network string) {
+	s.ipVersion = network
+}
+
+// SetUnixSocket 设置监听Unix socket(同机部署的网关等)，需在Start之前设置
+func (s *Server) SetUnixSocket(path string) {
+	s.ipVersion = "unix"
+	s.unixSocket = path
+}
+
+// SetListener 设置监听器(如已绑定端口的net.Listener、tls.Listener)，需在Start之前设置
+func (s *Server) SetListener(listener net.Listener) {
+	s.listener = listener
+}
+
+// GetListener 获取监听器
+func (s *Server) GetListener() net.Listener {
+	return s.listener
+}
+
+// SetTLSConfig 设置TLS配置(为nil表示不开启)，需在Start之前设置
+func (s *Server) SetTLSConfig(tlsConfig *tls.Config) {
+	s.tlsConfig = tlsConfig
+}
+
 // Stop 停止服务器
 func (s *Server) Stop() {
+	if !atomic.CompareAndSwapInt32(&s.closing, 0, 1) {
+		return
+	}
+	gnet.MetricsMgr.UnregisterConnMgr(s.metricsId)
 	//关闭worker工作池
 	s.msgHandler.StopWorkerPool()
 	s.connMgr.ClearConn()
-	_ = s.listener.Close()
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
 
 	s.exit <- true
 }
 
+// SetClosingMsg 设置服务器关闭(Shutdown)时广播给客户端的消息
+func (s *Server) SetClosingMsg(msgId uint32, data []byte) {
+	s.closingId = msgId
+	s.closingMsg = data
+}
+
+// Shutdown 优雅关闭服务器: 停止接收新链接、广播关闭消息、等待队列中的消息处理完成以及缓冲管道中的数据写出、
+// 停止全部链接并执行OnConnStop。全部完成后返回，ctx超时/取消后不再等待并返回ctx的错误
+func (s *Server) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&s.closing, 0, 1) {
+		return errors.New("server is closing")
+	}
+	defer gnet.MetricsMgr.UnregisterConnMgr(s.metricsId)
+
+	// 停止接收新链接
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+
+	// 广播服务器关闭消息
+	if s.closingId > 0 {
+		s.connMgr.BroadcastMsg(s.closingId, s.closingMsg)
+	}
+
+	err := gnet.DrainConns(ctx, s.connMgr, s.msgHandler)
+
+	//关闭worker工作池
+	s.msgHandler.StopWorkerPool()
+
+	s.exit <- true
+	return err
+}
+
 // Run 运行服务器
 func (s *Server) Run() {
 	s.Start()
@@ -144,6 +417,61 @@ func (s *Server) GetConnMgr() *gnet.ConnManager {
 	return s.connMgr
 }
 
+// GetDataPack 获取封包格式
+func (s *Server) GetDataPack() gnet.IDataPack {
+	return s.dataPack
+}
+
+// SetDataPack 设置封包格式，新建链接将使用该格式
+func (s *Server) SetDataPack(dataPack gnet.IDataPack) {
+	s.dataPack = dataPack
+}
+
+// GetHeartBeat 获取链接心跳配置
+func (s *Server) GetHeartBeat() gnet.HeartBeatOption {
+	return s.heartBeat
+}
+
+// SetHeartBeat 设置链接心跳配置，新建链接将使用该配置
+func (s *Server) SetHeartBeat(option gnet.HeartBeatOption) {
+	s.heartBeat = option
+}
+
+// IsSecure 是否开启加密传输
+func (s *Server) IsSecure() bool {
+	return s.secure
+}
+
+// SetSecure 设置是否开启加密传输(客户端需同时开启)，密钥交换不验证身份，无法防止中间人攻击，需要时使用TLS
+func (s *Server) SetSecure(secure bool) {
+	s.secure = secure
+}
+
+// SetRateLimiter 设置链接限流器(nil表示不限流)
+func (s *Server) SetRateLimiter(limiter *gnet.RateLimiter) {
+	s.msgHandler.SetLimiter(limiter)
+}
+
+// SetOverflow 设置Worker队列溢出处理策略
+func (s *Server) SetOverflow(option gnet.OverflowOption) {
+	s.msgHandler.SetOverflow(option)
+}
+
+// SetOnQueueEvent 设置Worker队列高水位/溢出事件Hook函数
+func (s *Server) SetOnQueueEvent(onQueueEvent gnet.QueueEventFunc) {
+	s.msgHandler.SetOnQueueEvent(onQueueEvent)
+}
+
+// SetDispatchKey 设置消息分发Key函数，Key相同的消息由同一个Worker按顺序处理(需在Start之前设置)
+func (s *Server) SetDispatchKey(dispatchKey gnet.DispatchKeyFunc) {
+	s.msgHandler.SetDispatchKey(dispatchKey)
+}
+
+// SetWorldMsgIds 设置由单独的world worker串行处理的消息ID(需在Start之前设置)
+func (s *Server) SetWorldMsgIds(msgIds ...uint32) {
+	s.msgHandler.SetWorldMsgIds(msgIds...)
+}
+
 // SetOnConnStart 设置服务器有新的链接Hook函数
 func (s *Server) SetOnConnStart(connCallback gnet.ConnCallback) {
 	s.onConnStart = connCallback
@@ -156,6 +484,9 @@ func (s *Server) SetOnConnStop(connCallback gnet.ConnCallback) {
 
 // CallOnConnStart 调用连接OnConnStart Hook函数
 func (s *Server) CallOnConnStart(conn gnet.IConnection) {
+	if s.authTimeout > 0 {
+		gnet.WatchAuth(s.connMgr, conn, s.authTimeout)
+	}
 	if s.onConnStart != nil {
 		s.onConnStart(conn)
 	}
@@ -163,6 +494,7 @@ func (s *Server) CallOnConnStart(conn gnet.IConnection) {
 
 // CallOnConnStop 调用连接OnConnStop Hook函数
 func (s *Server) CallOnConnStop(conn gnet.IConnection) {
+	s.admission.Release(gnet.AddrIp(conn.RemoteAddr()))
 	if s.onConnStop != nil {
 		s.onConnStop(conn)
 	}
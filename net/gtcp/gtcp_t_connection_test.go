@@ -0,0 +1,180 @@
+package gtcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/Ravior/gserver/net/gnet"
+	"github.com/Ravior/gserver/util/gconfig"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Connection_WriteBatch(t *testing.T) {
+	// 获取一个空闲TCP端口
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	gconfig.Global.TcpServer.IP = "127.0.0.1"
+	gconfig.Global.TcpServer.Port = int32(port)
+	gconfig.Global.TcpServer.MaxMsgChanLen = 1024
+
+	const count = 500
+	server := NewServer()
+	server.SetOnConnStart(func(conn gnet.IConnection) {
+		// 连续发送多条消息，写协程合并写出
+		for i := 0; i < count; i++ {
+			data := make([]byte, 4+i%300)
+			binary.BigEndian.PutUint32(data, uint32(i))
+			if err := conn.SendMsg(1001, data); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	})
+	server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	dp := NewDataPack()
+	for i := 0; i < count; i++ {
+		msg, err := gnet.ReadMsg(dp, conn)
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		if msg.GetMsgId() != 1001 || len(msg.GetData()) != 4+i%300 || binary.BigEndian.Uint32(msg.GetData()) != uint32(i) {
+			t.Fatal(i, msg.GetMsgId(), len(msg.GetData()))
+		}
+	}
+}
+
+func Test_Connection_SendCompressed(t *testing.T) {
+	gconfig.Global.TcpServer.IP = "127.0.0.1"
+	gconfig.Global.TcpServer.Port = 0
+	gconfig.Global.TcpServer.MaxMsgChanLen = 16
+
+	body := []byte(strings.Repeat("gserver", 1000))
+	server := NewServer()
+	server.SetDataPack(NewCompressDataPack(nil))
+	server.SetOnConnStart(func(conn gnet.IConnection) {
+		if err := conn.SendMsg(1001, body); err != nil {
+			t.Error(err)
+		}
+	})
+	server.Start()
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp4", server.GetListener().Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// 链接发送的消息经过写协程写出后，线路上的数据已压缩
+	dp := NewCompressDataPack(nil)
+	head := make([]byte, dp.GetHeadLen())
+	if _, err := io.ReadFull(conn, head); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := dp.FlagDataPack.Unpack(head)
+	if err != nil || msg.GetFlags()&gnet.FlagCompressSnappy == 0 || msg.GetDataLen() >= uint32(len(body)) {
+		t.Fatal(msg, err)
+	}
+	got, err := gnet.ReadMsg(dp, io.MultiReader(bytes.NewReader(head), conn))
+	if err != nil || !bytes.Equal(got.GetData(), body) {
+		t.Fatal(err)
+	}
+}
+
+// newLoopbackConn 创建本地回环TCP链接，对端丢弃全部数据
+func newLoopbackConn(b *testing.B) *net.TCPConn {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	go func() {
+		conn, err := l.Accept()
+		_ = l.Close()
+		if err == nil {
+			_, _ = io.Copy(ioutil.Discard, conn)
+		}
+	}()
+	conn, err := net.DialTCP("tcp4", nil, l.Addr().(*net.TCPAddr))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return conn
+}
+
+// benchmarkBatch 每次写出的消息
+func benchmarkBatch() []gnet.Buffer {
+	dp := NewDataPack()
+	batch := make([]gnet.Buffer, maxWriteBatch)
+	for i := range batch {
+		batch[i], _ = dp.PackBuffer(gnet.NewMsg(1001, make([]byte, 64)))
+	}
+	return batch
+}
+
+func BenchmarkWriter_Single(b *testing.B) {
+	conn := newLoopbackConn(b)
+	defer conn.Close()
+	batch := benchmarkBatch()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, data := range batch {
+			if _, err := conn.Write(data.B); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkWriter_Writev(b *testing.B) {
+	conn := newLoopbackConn(b)
+	defer conn.Close()
+	batch := benchmarkBatch()
+	iov := make(net.Buffers, 0, maxWriteBatch)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buffers := iov[:0]
+		for _, data := range batch {
+			buffers = append(buffers, data.B)
+		}
+		if _, err := buffers.WriteTo(conn); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Test_MsgPack(t *testing.T) {
+	// 兼容旧版本的默认封包格式，最大包长度保持不变
+	data, err := MsgPack.Pack(gnet.NewMsg(1, make([]byte, defaultMaxPacketSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MsgPack.Unpack(data[:MsgPack.GetHeadLen()]); err == nil {
+		t.Fatal("max packet size exceeded")
+	}
+}
+
+func Test_Connection_ProtocolType(t *testing.T) {
+	if (&Connection{}).GetProtocolType() != gnet.Tcp {
+		t.Fail()
+	}
+}
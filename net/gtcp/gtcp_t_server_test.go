@@ -0,0 +1,558 @@
+package gtcp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"github.com/Ravior/gserver/net/gnet"
+	"github.com/Ravior/gserver/util/gconfig"
+	"github.com/gogo/protobuf/types"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Server_Shutdown(t *testing.T) {
+	// 获取一个空闲TCP端口
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	gconfig.Global.TcpServer.IP = "127.0.0.1"
+	gconfig.Global.TcpServer.Port = int32(port)
+	gconfig.Global.TcpServer.MaxMsgChanLen = 16
+
+	dataPack := NewDataPack()
+	dataPack.SetSeqEnabled(true)
+
+	started := make(chan struct{})
+	var stopped int32
+
+	server := NewServer()
+	server.SetDataPack(dataPack)
+	server.SetOnConnStop(func(conn gnet.IConnection) {
+		time.Sleep(50 * time.Millisecond)
+		atomic.StoreInt32(&stopped, 1)
+	})
+	server.GetRouter().Group("tcp").AddRoute("slow", func(req *gnet.Request, msg *types.StringValue) {
+		close(started)
+		// 模拟耗时业务，Shutdown需等待处理完成并把响应写出
+		time.Sleep(200 * time.Millisecond)
+		_ = req.Reply(&types.StringValue{Value: msg.Value + "-reply"})
+	})
+	server.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	client := NewClient("1", "tcp-client", "127.0.0.1", int32(port))
+	client.SetDataPack(dataPack)
+	client.Run()
+	defer client.Stop()
+
+	msgId := gnet.RouteItemMgr.GetMsgId("google.protobuf.StringValue")
+	callErr := make(chan error, 1)
+	resp := &types.StringValue{}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		callErr <- client.Call(ctx, msgId, &types.StringValue{Value: "gserver"}, resp)
+	}()
+
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&stopped) != 1 {
+		t.Fatal("OnConnStop not finished when shutdown returns")
+	}
+	if err := <-callErr; err != nil || resp.Value != "gserver-reply" {
+		t.Fatal(err, resp.Value)
+	}
+	if server.GetConnMgr().Len() != 0 {
+		t.Fatal(server.GetConnMgr().Len())
+	}
+}
+
+func Test_Server_Secure(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	gconfig.Global.TcpServer.IP = "127.0.0.1"
+	gconfig.Global.TcpServer.Port = int32(port)
+	gconfig.Global.TcpServer.MaxMsgChanLen = 16
+
+	dataPack := NewDataPack()
+	dataPack.SetSeqEnabled(true)
+
+	server := NewServer()
+	server.SetDataPack(dataPack)
+	server.SetSecure(true)
+	server.GetRouter().Group("tcp").AddRoute("echo", func(req *gnet.Request, msg *types.BytesValue) {
+		_ = req.Reply(&types.BytesValue{Value: append(msg.Value, '!')})
+	})
+	server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	client := NewClient("1", "tcp-client", "127.0.0.1", int32(port))
+	client.SetDataPack(dataPack)
+	client.SetSecure(true)
+	client.Run()
+	defer client.Stop()
+
+	msgId := gnet.RouteItemMgr.GetMsgId("google.protobuf.BytesValue")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp := &types.BytesValue{}
+	if err := client.Call(ctx, msgId, &types.BytesValue{Value: []byte("gserver")}, resp); err != nil || string(resp.Value) != "gserver!" {
+		t.Fatal(err, string(resp.Value))
+	}
+
+	// 未握手的明文链接被断开
+	conn, err := net.Dial("tcp4", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	data, _ := dataPack.Pack(gnet.NewMsg(msgId, []byte("gserver")))
+	_, _ = conn.Write(data)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := conn.Read(make([]byte, 64)); err == nil {
+		t.Fatal("plaintext connection should be closed", n)
+	}
+}
+
+func Test_Server_Admission(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	gconfig.Global.TcpServer.IP = "127.0.0.1"
+	gconfig.Global.TcpServer.Port = int32(port)
+	gconfig.Global.TcpServer.MaxMsgChanLen = 16
+
+	dataPack := NewDataPack()
+	server := NewServer()
+	server.SetDataPack(dataPack)
+	server.SetRejectMsg(99, []byte("server full"))
+	server.SetAuthTimeout(200 * time.Millisecond)
+	server.GetAdmission().SetMaxConn(1)
+	server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	first, err := net.Dial("tcp4", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	// 超出最大连接数，收到拒绝消息后被断开
+	second, err := net.Dial("tcp4", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	_ = second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	msg, err := gnet.ReadMsg(dataPack, second)
+	if err != nil || msg.GetMsgId() != 99 || string(msg.GetData()) != "server full" {
+		t.Fatal(msg, err)
+	}
+	if _, err := second.Read(make([]byte, 1)); err == nil {
+		t.Fatal("rejected connection should be closed")
+	}
+
+	// 未登录的链接超时后被断开，并释放IP名额
+	_ = first.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := first.Read(make([]byte, 1)); err == nil {
+		t.Fatal("unauthenticated connection should be closed")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := server.GetAdmission().GetIpConnNum(net.ParseIP("127.0.0.1")); n != 0 {
+		t.Fatal(n)
+	}
+}
+
+func Test_Server_ProxyProtocol(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	gconfig.Global.TcpServer.IP = "127.0.0.1"
+	gconfig.Global.TcpServer.Port = int32(port)
+	gconfig.Global.TcpServer.MaxMsgChanLen = 16
+
+	proxy, err := gnet.NewProxyProtocol([]string{"127.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataPack := NewDataPack()
+	server := NewServer()
+	server.SetDataPack(dataPack)
+	server.SetProxyProtocol(proxy)
+	server.GetRouter().Group("tcp").AddRoute("addr", func(req *gnet.Request, msg *types.Int64Value) {
+		_ = req.Reply(&types.StringValue{Value: req.GetConnection().RemoteAddr().String()})
+	})
+	server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp4", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	msgId := gnet.RouteItemMgr.GetMsgId("google.protobuf.Int64Value")
+	data, _ := dataPack.Pack(gnet.NewMsg(msgId, nil))
+	_, _ = conn.Write(append([]byte("PROXY TCP4 203.0.113.7 127.0.0.1 40000 443\r\n"), data...))
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	msg, err := gnet.ReadMsg(dataPack, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &types.StringValue{}
+	if err := resp.Unmarshal(msg.GetData()); err != nil || resp.Value != "203.0.113.7:40000" {
+		t.Fatal(err, resp.Value)
+	}
+}
+
+// newTestCert 生成127.0.0.1的自签名证书
+func newTestCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gserver"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func Test_Server_TLS(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+
+	gconfig.Global.TcpServer.MaxMsgChanLen = 16
+
+	cert, pool := newTestCert(t)
+	dataPack := NewDataPack()
+	dataPack.SetSeqEnabled(true)
+
+	server := NewServer()
+	server.SetDataPack(dataPack)
+	server.SetListener(l)
+	server.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}})
+	server.GetRouter().Group("tcp").AddRoute("tls", func(req *gnet.Request, msg *types.UInt64Value) {
+		_, ok := req.GetConnection().GetNetConnection().(*tls.Conn)
+		if !ok {
+			_ = req.ReplyError(fmt.Errorf("not tls"))
+			return
+		}
+		_ = req.Reply(&types.UInt64Value{Value: msg.Value + 1})
+	})
+	server.Start()
+	defer server.Stop()
+
+	client := NewClient("1", "tcp-client", "127.0.0.1", int32(port))
+	client.SetDataPack(dataPack)
+	client.SetTLSConfig(&tls.Config{RootCAs: pool})
+	client.Run()
+	defer client.Stop()
+
+	msgId := gnet.RouteItemMgr.GetMsgId("google.protobuf.UInt64Value")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp := &types.UInt64Value{}
+	if err := client.Call(ctx, msgId, &types.UInt64Value{Value: 41}, resp); err != nil || resp.Value != 42 {
+		t.Fatal(err, resp.Value)
+	}
+
+	// 明文链接无法完成TLS握手
+	conn, err := net.Dial("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	data, _ := dataPack.Pack(gnet.NewMsg(msgId, nil))
+	_, _ = conn.Write(data)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := gnet.ReadMsg(dataPack, conn); err == nil {
+		t.Fatal("plaintext connection should fail")
+	}
+}
+
+func Test_Server_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gserver.sock")
+	gconfig.Global.TcpServer.MaxMsgChanLen = 16
+
+	dataPack := NewDataPack()
+	dataPack.SetSeqEnabled(true)
+
+	server := NewServer()
+	server.SetDataPack(dataPack)
+	server.SetUnixSocket(path)
+	server.GetAdmission().SetMaxConnPerIp(1)
+	server.GetRouter().Group("tcp").AddRoute("unix", func(req *gnet.Request, msg *types.UInt32Value) {
+		_ = req.Reply(&types.UInt32Value{Value: msg.Value * 2})
+	})
+	server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	msgId := gnet.RouteItemMgr.GetMsgId("google.protobuf.UInt32Value")
+	// Unix socket链接没有IP，不受单IP连接数限制
+	for i := 0; i < 2; i++ {
+		client := NewClient("1", "unix-client", "", 0)
+		client.SetDataPack(dataPack)
+		client.SetUnixSocket(path)
+		client.Run()
+		defer client.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		resp := &types.UInt32Value{}
+		err := client.Call(ctx, msgId, &types.UInt32Value{Value: 21}, resp)
+		cancel()
+		if err != nil || resp.Value != 42 {
+			t.Fatal(err, resp.Value)
+		}
+	}
+}
+
+func Test_Server_ShutdownDuringProxyHeader(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gconfig.Global.TcpServer.MaxMsgChanLen = 16
+
+	proxy, err := gnet.NewProxyProtocol([]string{"127.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var started int32
+	server := NewServer()
+	server.SetListener(l)
+	server.SetProxyProtocol(proxy)
+	server.SetOnConnStart(func(conn gnet.IConnection) {
+		atomic.StoreInt32(&started, 1)
+	})
+	server.Start()
+
+	conn, err := net.Dial("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	// PROXY头部读取期间关闭服务器，之后到达的链接不会被加入
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = conn.Write([]byte("PROXY TCP4 203.0.113.7 127.0.0.1 40000 443\r\n"))
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("connection should be closed")
+	}
+	if server.GetConnMgr().Len() != 0 || atomic.LoadInt32(&started) != 0 {
+		t.Fatal(server.GetConnMgr().Len(), atomic.LoadInt32(&started))
+	}
+}
+
+func Test_Server_ListenError(t *testing.T) {
+	// 证书加载失败时返回错误
+	server := NewServer()
+	server.certFile, server.keyFile = "not-exist.crt", "not-exist.key"
+	if err := server.Listen(); err == nil {
+		t.Fatal("certificate load error ignored")
+	}
+
+	// PROXY protocol配置错误时返回错误, 不静默关闭
+	gconfig.Global.TcpServer.ProxyProtocol = true
+	gconfig.Global.TcpServer.TrustedProxies = []string{"not-a-cidr"}
+	server = NewServer()
+	gconfig.Global.TcpServer.ProxyProtocol = false
+	gconfig.Global.TcpServer.TrustedProxies = nil
+	if err := server.Listen(); err == nil {
+		t.Fatal("proxy protocol error ignored")
+	}
+
+	// 端口已被占用时返回错误
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	server = NewServer()
+	server.ip, server.port = "127.0.0.1", int32(l.Addr().(*net.TCPAddr).Port)
+	if err := server.Listen(); err == nil {
+		t.Fatal("listen error ignored")
+	}
+}
+
+func Test_Server_UnixSocketStale(t *testing.T) {
+	dir := t.TempDir()
+
+	// 残留的socket文件被清理
+	stale := filepath.Join(dir, "stale.sock")
+	l, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = l.Close()
+	server := NewServer()
+	server.SetUnixSocket(stale)
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	_ = server.GetListener().Close()
+
+	// 普通文件不被删除
+	file := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(file, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server = NewServer()
+	server.SetUnixSocket(file)
+	if err := server.Listen(); err == nil {
+		t.Fatal("regular file removed")
+	}
+	if data, err := ioutil.ReadFile(file); err != nil || string(data) != "{}" {
+		t.Fatal(err)
+	}
+
+	// 运行中实例的socket文件不被删除
+	live := filepath.Join(dir, "live.sock")
+	l, err = net.Listen("unix", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	server = NewServer()
+	server.SetUnixSocket(live)
+	if err := server.Listen(); err == nil {
+		t.Fatal("live socket removed")
+	}
+	if conn, err := net.Dial("unix", live); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = conn.Close()
+	}
+}
+
+func Test_Server_SecureHandshakeFail(t *testing.T) {
+	gconfig.Global.TcpServer.IP = "127.0.0.1"
+	gconfig.Global.TcpServer.Port = 0
+	gconfig.Global.TcpServer.MaxMsgChanLen = 16
+
+	var started, stopped int32
+	server := NewServer()
+	server.SetSecure(true)
+	server.GetAdmission().SetMaxConnPerIp(1)
+	server.SetOnConnStart(func(conn gnet.IConnection) { atomic.AddInt32(&started, 1) })
+	server.SetOnConnStop(func(conn gnet.IConnection) { atomic.AddInt32(&stopped, 1) })
+	server.Start()
+	defer server.Stop()
+
+	// 握手失败的链接不触发OnConnStart/OnConnStop，并释放占用的连接数
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp4", server.GetListener().Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := server.GetDataPack().Pack(gnet.NewMsg(1, []byte("gserver")))
+		_, _ = conn.Write(data)
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err == nil {
+			t.Fatal("connection not closed")
+		}
+		_ = conn.Close()
+	}
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&started) != 0 || atomic.LoadInt32(&stopped) != 0 || server.GetConnMgr().Len() != 0 || server.GetAdmission().GetConnNum() != 0 {
+		t.Fatal(started, stopped, server.GetConnMgr().Len(), server.GetAdmission().GetConnNum())
+	}
+}
+
+func Test_Server_Metrics(t *testing.T) {
+	gconfig.Global.TcpServer.IP = "127.0.0.1"
+	gconfig.Global.TcpServer.Port = 0
+	gconfig.Global.TcpServer.MaxMsgChanLen = 16
+
+	registered := func(id uint32) bool {
+		for _, s := range gnet.MetricsMgr.GetConnStats() {
+			if s.Id == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 同名服务器分别注册，停止后取消注册
+	server := NewServer()
+	other := NewServer()
+	if server.metricsId == other.metricsId || !registered(server.metricsId) || !registered(other.metricsId) {
+		t.Fatal(server.metricsId, other.metricsId)
+	}
+	server.Start()
+	other.Start()
+	server.Stop()
+	if registered(server.metricsId) || !registered(other.metricsId) {
+		t.Fatal("stopped server should be unregistered")
+	}
+	if err := other.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if registered(other.metricsId) {
+		t.Fatal("shutdown server should be unregistered")
+	}
+}
@@ -1,10 +1,12 @@
 package gwebsocket
 
 import (
+	"context"
 	"fmt"
 	"github.com/Ravior/gserver/internal/empty"
 	"github.com/Ravior/gserver/net/gnet"
 	"github.com/Ravior/gserver/os/glog"
+	"github.com/golang/protobuf/proto"
 	"github.com/gorilla/websocket"
 )
 
@@ -15,17 +17,22 @@ var (
 )
 
 type Client struct {
-	name        string
-	id          string
-	scheme      string
-	remotePath  string
-	remoteIP    string
-	remotePort  int32
-	router      *gnet.Router
-	msgHandler  *gnet.MsgHandler
-	connMgr     *gnet.ConnManager
-	onConnStart func(conn gnet.IConnection)
-	onConnStop  func(conn gnet.IConnection)
+	name            string
+	id              string
+	scheme          string
+	remotePath      string
+	remoteIP        string
+	remotePort      int32
+	router          *gnet.Router
+	msgHandler      *gnet.MsgHandler
+	callMgr         *gnet.CallMgr
+	dataPack        gnet.IDataPack
+	connMgr         *gnet.ConnManager
+	reconnector     *gnet.Reconnector // 断线重连组件(未设置重连策略时为nil)
+	onConnStart     func(conn gnet.IConnection)
+	onConnStop      func(conn gnet.IConnection)
+	onReconnect     gnet.ConnCallback      // 重连成功Hook函数
+	onReconnectFail gnet.ReconnectFailFunc // 达到最大重连次数Hook函数
 }
 
 func NewClient(clientName string, clientId string, remoteIP string, remotePort int32) *Client {
@@ -37,8 +44,11 @@ func NewClient(clientName string, clientId string, remoteIP string, remotePort i
 		router:     &gnet.Router{},
 		msgHandler: gnet.NewMsgHandler(defaultWorkerPoolSize, defaultWorkerTaskSize),
 		connMgr:    gnet.NewConnManager(),
+		callMgr:    gnet.NewCallMgr(),
+		dataPack:   NewDataPack(),
 	}
 	client.msgHandler.SetRouter(client.router)
+	client.msgHandler.SetCallMgr(client.callMgr)
 	return client
 }
 
@@ -91,6 +101,10 @@ func (c *Client) Start() {
 
 // Stop 关闭
 func (c *Client) Stop() {
+	// 先停止重连，避免链接断开后再次触发重连
+	if c.reconnector != nil {
+		c.reconnector.Stop()
+	}
 	c.msgHandler.StopWorkerPool()
 	c.connMgr.ClearConn()
 }
@@ -98,19 +112,31 @@ func (c *Client) Stop() {
 func (c *Client) Run() {
 	c.Start()
 
+	if _, err := c.dial(); err != nil {
+		// 开启了断线重连，按重连策略继续尝试链接
+		if c.reconnector != nil {
+			c.reconnector.Trigger()
+			return
+		}
+		conn := NewConnection(c, nil, 0, c.msgHandler, defaultMaxMsgChanLen)
+		c.CallOnConnStop(conn)
+	}
+}
+
+// dial 链接服务器并启动链接
+func (c *Client) dial() (gnet.IConnection, error) {
 	addr := fmt.Sprintf("%s://%s:%d%s", c.GetSchema(), c.GetHost(), c.GetPort(), c.GetRemotePath())
 	connServer, _, err := websocket.DefaultDialer.Dial(addr, nil)
 	if err != nil {
 		glog.Warnf("WebSocket客户端链接失败，错误消息:%v", err.Error())
-		conn := NewConnection(c, nil, 0, c.msgHandler, defaultMaxMsgChanLen)
-		c.CallOnConnStop(conn)
-		return
+		return nil, err
 	}
 
 	// 保证Client的时候只有一个Conn
 	c.connMgr.ClearConn()
 	conn := NewConnection(c, connServer, 0, c.msgHandler, defaultMaxMsgChanLen)
 	conn.Start()
+	return conn, nil
 }
 
 func (c *Client) GetRouter() *gnet.Router {
@@ -126,6 +152,67 @@ func (c *Client) GetConn() gnet.IConnection {
 	}
 }
 
+// Call 发送请求并阻塞等待匹配的响应消息，直到响应到达或者ctx超时(需开启封包格式的序列号扩展包头)
+func (c *Client) Call(ctx context.Context, msgId uint32, req proto.Message, resp proto.Message) error {
+	return c.callMgr.Call(ctx, c.GetConn(), msgId, req, resp)
+}
+
+// SendMsg 发送消息，开启断线重连且配置了缓存时，断线期间的消息将在重连成功后发送
+func (c *Client) SendMsg(msgId uint32, data []byte) error {
+	if c.reconnector != nil {
+		return c.reconnector.Send(c.GetConn(), msgId, data)
+	}
+	conn := c.GetConn()
+	if conn == nil {
+		return gnet.ErrCallNoConn
+	}
+	return conn.SendMsg(msgId, data)
+}
+
+// SetReconnectPolicy 设置断线重连策略(需在Run之前设置，nil表示不重连)
+func (c *Client) SetReconnectPolicy(policy *gnet.ReconnectPolicy) {
+	if policy == nil {
+		c.reconnector = nil
+		return
+	}
+	c.reconnector = gnet.NewReconnector(policy, c.dial, c.CallOnReconnect, c.CallOnReconnectFail)
+}
+
+// SetOnReconnect 设置重连成功Hook函数(在发送断线期间缓存的消息之前调用，可用于重新登录)
+func (c *Client) SetOnReconnect(connCallback gnet.ConnCallback) {
+	c.onReconnect = connCallback
+}
+
+// SetOnReconnectFail 设置达到最大重连次数Hook函数
+func (c *Client) SetOnReconnectFail(failCallback gnet.ReconnectFailFunc) {
+	c.onReconnectFail = failCallback
+}
+
+// CallOnReconnect 调用重连成功Hook函数
+func (c *Client) CallOnReconnect(conn gnet.IConnection) {
+	if c.onReconnect != nil {
+		glog.Infof("Client CallOnReconnect, ConnId:%d, Addr:%s", conn.GetConnID(), conn.RemoteAddr())
+		c.onReconnect(conn)
+	}
+}
+
+// CallOnReconnectFail 调用达到最大重连次数Hook函数
+func (c *Client) CallOnReconnectFail(attempts int, err error) {
+	if c.onReconnectFail != nil {
+		c.onReconnectFail(attempts, err)
+	}
+}
+
+// GetDataPack 获取封包格式
+func (c *Client) GetDataPack() gnet.IDataPack {
+	return c.dataPack
+}
+
+// SetDataPack 设置封包格式
+func (c *Client) SetDataPack(dataPack gnet.IDataPack) {
+	c.dataPack = dataPack
+}
+
 func (c *Client) GetConnMgr() *gnet.ConnManager {
 	return c.connMgr
 }
@@ -146,8 +233,14 @@ func (c *Client) CallOnConnStart(conn gnet.IConnection) {
 }
 
 func (c *Client) CallOnConnStop(conn gnet.IConnection) {
+	// 链接断开，取消全部等待中的请求
+	c.callMgr.CancelAll()
 	if c.onConnStop != nil {
 		glog.Infof("Client CallOnConnStop, ConnId:%d, Addr:%s", conn.GetConnID(), conn.RemoteAddr())
 		c.onConnStop(conn)
 	}
+	// 开启了断线重连，链接断开后自动重连
+	if c.reconnector != nil {
+		c.reconnector.Trigger()
+	}
 }
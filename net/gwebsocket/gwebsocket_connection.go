@@ -7,23 +7,25 @@ import (
 	"github.com/Ravior/gserver/net/gnet"
 	"github.com/Ravior/gserver/os/glog"
 	"github.com/gorilla/websocket"
-	"io"
 	"net"
 	"sync/atomic"
 	"time"
 )
 
 type Connection struct {
+	gnet.ConnProperty                    // 链接自定义属性
 	connID            uint32             // 当前链接的ID, 也可以称作为SessionID，ID全局唯一
 	isClosed          int32              // 当前链接的关闭状态(采用原子操作处理)
-	msgChan           chan []byte        // 缓冲管道，用于读、写两个goroutine之间的消息通信
+	pending           int32              // 缓冲管道中还未写出的消息数量
+	msgChan           chan gnet.Buffer   // 缓冲管道，用于读、写两个goroutine之间的消息通信
 	socket            gnet.ISocket       // 当前链接关联的Socket
 	conn              *websocket.Conn    // 当前链接的TCP套接字
 	msgHandler        *gnet.MsgHandler   // 消息处理模块
+	dataPack          gnet.IDataPack     // 封包格式
+	heartBeat         *gnet.HeartBeat    // 心跳组件
+	textMode          bool               // 文本帧模式(JSON信封)
 	ctx               context.Context    // 告知该链接已经退出/停止的channel
 	cancel            context.CancelFunc // cancelFunc
-	lastHeartBeatTime time.Time          // 最后一次心跳时间
-	heartBeatTimer    *time.Timer        // 心跳定时器
 }
 
 // NewConnection 创建新的链接对象
@@ -34,8 +36,13 @@ func NewConnection(socket gnet.ISocket, conn *websocket.Conn, connID uint32, msg
 		connID:     connID,
 		isClosed:   0,
 		msgHandler: msgHandler,
-		msgChan:    make(chan []byte, maxMsgChanLen),
+		dataPack:   socket.GetDataPack(),
+		msgChan:    make(chan gnet.Buffer, maxMsgChanLen),
 	}
+	// 加入链接管理器后可能在Start之前被Stop(如Shutdown、顶号)，ctx需提前创建
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	// 默认开启读空闲检测
+	c.heartBeat = gnet.NewHeartBeat(c, gnet.HeartBeatOption{ReadIdle: gnet.HeartBeatTime * time.Second})
 
 	if conn != nil {
 		// 将新创建的Conn添加到链接管理器
@@ -64,10 +71,14 @@ func (c *Connection) StartWriter() {
 		case data, ok := <-c.msgChan:
 			if ok {
 				// 有数据要写给客户端
-				if err := c.conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				err := c.conn.WriteMessage(c.frameType(), data.B)
+				data.Release()
+				if err != nil {
 					glog.Warnf("Connection write message has error: %s, ConnId:%d, Addr:%s 即将断开", err.Error(), c.connID, c.RemoteAddr())
 					return
 				}
+				atomic.AddInt32(&c.pending, -1)
+				c.heartBeat.OnWrite()
 			} else {
 				glog.Warnf("MsgChan has been closed, ConnId:%d, Addr:%s 即将断开", c.connID, c.RemoteAddr())
 				break
@@ -104,37 +115,19 @@ func (c *Connection) StartReader() {
 				return
 			}
 
-			if msgType == websocket.TextMessage {
+			// 非文本帧模式不接收文本帧
+			if msgType == websocket.TextMessage && !c.textMode {
+				glog.Warnf("Connection receive text message in binary mode, ConnId:%d, Addr:%s 即将断开", c.connID, c.RemoteAddr())
 				return
 			}
 
-			// 读取客户端的Msg head
-			headData := make([]byte, MsgPack.GetHeadLen())
-
-			if _, err := io.ReadFull(msgReader, headData); err != nil {
-				glog.Errorf("Connection read head message has error: %s, ConnId:%d, Addr:%s 即将断开", err.Error(), c.connID, c.RemoteAddr())
-				return
-			}
-
-			// 普通socket拆包，得到nameLen 和 dataLen 放在msg中
-			msg, err := MsgPack.Unpack(headData)
+			// 按封包格式读取客户端的Msg
+			msg, err := gnet.ReadMsg(c.dataPack, msgReader)
 			if err != nil {
-				glog.Errorf("Connection unpack message fail，err:%s, ConnId:%d, Addr:%s 即将断开", err.Error(), c.connID, c.RemoteAddr())
+				glog.Errorf("Connection read message has error: %s, ConnId:%d, Addr:%s 即将断开", err.Error(), c.connID, c.RemoteAddr())
 				return
 			}
 
-			// 根据 dateLen 读取
-			var data []byte
-			if msg.GetDataLen() > 0 {
-				data = make([]byte, msg.GetDataLen())
-				if _, err := io.ReadFull(msgReader, data); err != nil {
-					glog.Errorf("Connection read body message fail，err:%s, ConnId:%d, Addr:%s 即将断开", err.Error(), c.connID, c.RemoteAddr())
-					return
-				}
-			}
-
-			msg.SetData(data)
-
 			// 保持链接
 			c.KeepAlive()
 
@@ -154,7 +147,6 @@ func (c *Connection) GetProtocolType() gnet.ProtocolType {
 
 func (c *Connection) Start() {
 	if c.conn != nil {
-		c.ctx, c.cancel = context.WithCancel(context.Background())
 		// 开启一个Go协程，从客户端读取数据
 		go c.StartReader()
 		// 开启一个Go协程，写回数据到客户端
@@ -167,7 +159,7 @@ func (c *Connection) Start() {
 	}
 }
 
-//Stop 停止连接，结束当前连接状态
+// Stop 停止连接，结束当前连接状态
 func (c *Connection) Stop() {
 	glog.Debugf("停止连接, ConnId:%d, Addr:%s", c.connID, c.RemoteAddr())
 
@@ -180,12 +172,7 @@ func (c *Connection) Stop() {
 
 	c.cancel()
 
-	if c.heartBeatTimer != nil {
-		c.heartBeatTimer.Stop()
-	}
-
-	// 关闭该链接全部管道
-	close(c.msgChan)
+	// 缓冲管道不关闭，写协程通过ctx退出，避免并发发送消息时向已关闭的管道写入
 
 	// 关闭socket链接
 	_ = c.conn.Close()
@@ -194,7 +181,7 @@ func (c *Connection) Stop() {
 	c.socket.GetConnMgr().Remove(c)
 
 	// 触发Socket中Conn Stop钩子方法(放在go内，防止回调出现死锁）
-	go c.socket.CallOnConnStop(c)
+	c.socket.GetConnMgr().GoCallback(c, c.socket.CallOnConnStop)
 }
 
 func (c *Connection) GetConnID() uint32 {
@@ -213,6 +200,13 @@ func (c *Connection) GetTcpConnection() *net.TCPConn {
 	return nil
 }
 
+func (c *Connection) GetNetConnection() net.Conn {
+	if c.conn != nil {
+		return c.conn.UnderlyingConn()
+	}
+	return nil
+}
+
 func (c *Connection) GetWsConnection() *websocket.Conn {
 	return c.conn
 }
@@ -228,11 +222,90 @@ func (c *Connection) RemoteAddr() net.Addr {
 	return nil
 }
 
+// GetDataPack 获取链接的封包格式
+func (c *Connection) GetDataPack() gnet.IDataPack {
+	return c.dataPack
+}
+
+// SetDataPack 设置链接的封包格式(需在Start之前设置)
+func (c *Connection) SetDataPack(dataPack gnet.IDataPack) {
+	c.dataPack = dataPack
+}
+
 func (c *Connection) SendMsg(msgId uint32, data []byte) error {
+	return c.SendSeqMsg(msgId, 0, data)
+}
+
+// SendSeqMsg 发送携带请求序列号的消息
+func (c *Connection) SendSeqMsg(msgId uint32, seqId uint32, data []byte) error {
 	if data == nil || msgId == 0 {
 		return errors.New("connection send nil msg")
 	}
 
+	// 将data封包，并且发送
+	p := gnet.NewMsg(msgId, data).WithSeqId(seqId)
+	msg, err := gnet.PackBuffer(c.dataPack, p)
+	if err != nil {
+		glog.Errorf("Connection pack message fail，msgId:%d, msgData:%v, err:%s, ConnId:%d, Addr:%s", msgId, data, err.Error(), c.connID, c.RemoteAddr())
+		return errors.New(fmt.Sprintf("connection pack message fail, err:%v", err))
+	}
+
+	if err := c.writeMsgChan(msgId, msg); err != nil {
+		return err
+	}
+	gnet.MetricsMgr.OnSend(msgId, len(data))
+	return nil
+}
+
+// SendPackedMsg 发送已按链接封包格式封包好的数据(广播时只封包一次)
+func (c *Connection) SendPackedMsg(data []byte) error {
+	if data == nil {
+		return errors.New("connection send nil msg")
+	}
+	return c.writeMsgChan(0, gnet.NewBuffer(data))
+}
+
+// SetTextMode 设置文本帧模式(需在Start之前设置)，每一帧为一条JSON信封消息，消息体使用JsonCodec编解码，响应以文本帧写回
+func (c *Connection) SetTextMode(textMode bool) {
+	c.textMode = textMode
+	if textMode {
+		dp := gnet.NewJsonDataPack()
+		dp.SetMaxPacketSize(defaultMaxPacketSize)
+		c.dataPack = dp
+		gnet.SetCodec(c, gnet.JsonCodec)
+	}
+}
+
+// IsTextMode 是否为文本帧模式
+func (c *Connection) IsTextMode() bool {
+	return c.textMode
+}
+
+// frameType 写出消息使用的帧类型
+func (c *Connection) frameType() int {
+	if c.textMode {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
+
+// Flush 等待缓冲管道中的数据全部写出(链接关闭或ctx超时返回)
+func (c *Connection) Flush(ctx context.Context) error {
+	return gnet.WaitUntil(ctx, func() bool {
+		return c.IsClosed() || atomic.LoadInt32(&c.pending) <= 0
+	})
+}
+
+// writeMsgChan 将封包好的数据写入缓冲管道
+func (c *Connection) writeMsgChan(msgId uint32, msg gnet.Buffer) error {
+	// 未写入缓冲管道的数据放回缓冲池
+	queued := false
+	defer func() {
+		if !queued {
+			msg.Release()
+		}
+	}()
+
 	if c.msgChan == nil || c.conn == nil || c.ctx == nil {
 		return errors.New("msg chan/conn/ctx is nil")
 	}
@@ -251,14 +324,6 @@ func (c *Connection) SendMsg(msgId uint32, data []byte) error {
 		}
 	}()
 
-	// 将data封包，并且发送
-	p := gnet.NewMsg(msgId, data)
-	msg, err := MsgPack.Pack(p)
-	if err != nil {
-		glog.Errorf("Connection pack message fail，msgId:%d, msgData:%v, err:%s, ConnId:%d, Addr:%s", msgId, data, err.Error(), c.connID, c.RemoteAddr())
-		return errors.New(fmt.Sprintf("connection pack message fail, err:%v", err))
-	}
-
 	// 如果channel已经写满，则直接关闭链接
 	if len(c.msgChan) >= cap(c.msgChan) {
 		defer c.Stop()
@@ -267,11 +332,15 @@ func (c *Connection) SendMsg(msgId uint32, data []byte) error {
 	}
 
 	// 避免阻塞
+	atomic.AddInt32(&c.pending, 1)
 	select {
 	case c.msgChan <- msg:
+		queued = true
 	case <-c.ctx.Done():
 		glog.Infof("Connection Context Done, ConnId:%d, Addr:%s", c.connID, c.RemoteAddr())
+		atomic.AddInt32(&c.pending, -1)
 	default:
+		atomic.AddInt32(&c.pending, -1)
 		glog.Warnf("Connection Send Msg Error, I/O Buff Is Full Or Can't Write Msg To Client, MsgId:%d, ConnId:%d, Addr:%s", msgId, c.connID, c.RemoteAddr())
 		return errors.New("I/O Buff Is Full Or Can't Write Msg To Client")
 	}
@@ -279,41 +348,22 @@ func (c *Connection) SendMsg(msgId uint32, data []byte) error {
 	return nil
 }
 
+// SetHeartBeat 设置心跳配置(需在Start之前设置)
+func (c *Connection) SetHeartBeat(option gnet.HeartBeatOption) {
+	c.heartBeat.SetOption(option)
+}
+
 // StartHeartBeatCheck 定时检测心跳包
 func (c *Connection) StartHeartBeatCheck() {
-	c.heartBeatTimer = time.NewTimer(gnet.HeartBeatTime * time.Second)
-	for {
-		select {
-		case <-c.heartBeatTimer.C:
-			if !c.IsAlive() {
-				// 心跳检测失败，结束连接
-				glog.Warnf("连接已关闭或者太久没有心跳, ConnId:%d, Addr:%s", c.connID, c.RemoteAddr())
-				c.Stop()
-				return
-			}
-			c.heartBeatTimer.Reset(gnet.HeartBeatTime * time.Second)
-		case <-c.ctx.Done():
-			glog.Infof("Connection Context Done, StopHeartBeatCheck, ConnId:%d, Addr:%s", c.connID, c.RemoteAddr())
-			if c.heartBeatTimer != nil {
-				c.heartBeatTimer.Stop()
-				c.Stop()
-				return
-			}
-		}
-	}
-
+	c.heartBeat.Run(c.ctx)
 }
 
 // IsAlive 判断是否活跃链接
 func (c *Connection) IsAlive() bool {
-	now := time.Now()
-	if now.Sub(c.lastHeartBeatTime) > gnet.HeartBeatTime*time.Second {
-		return false
-	}
-	return true
+	return c.heartBeat.IsAlive()
 }
 
 // KeepAlive 更新心跳
 func (c *Connection) KeepAlive() {
-	c.lastHeartBeatTime = time.Now()
+	c.heartBeat.KeepAlive()
 }
@@ -1,6 +1,9 @@
 package gwebsocket
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/Ravior/gserver/net/gnet"
 	"github.com/Ravior/gserver/os/glog"
@@ -9,7 +12,8 @@ import (
 	"github.com/gorilla/websocket"
 	"net"
 	"net/http"
-	"os"
+	"net/url"
+	"strings"
 	"sync/atomic"
 	"time"
 )
@@ -18,6 +22,35 @@ import (
 // 参数值参考PitaYa
 const IOBufferBytesSize = 4096
 
+var defaultMaxPacketSize uint32 = 10000
+
+// NewDataPack 创建默认封包格式 dataLen(4字节)|msgId(4字节)|body
+func NewDataPack() *gnet.DataPack {
+	dp := gnet.NewDataPack()
+	dp.SetMaxPacketSize(defaultMaxPacketSize)
+	return dp
+}
+
+// MsgPack 默认封包格式
+//
+// Deprecated: 封包格式已由每个Server/Client独立设置，修改MsgPack不会影响Server/Client，
+// 使用 NewDataPack 创建并通过 SetDataPack 设置
+var MsgPack = NewDataPack()
+
+// NewMsgPack 创建默认封包格式
+//
+// Deprecated: 使用 NewDataPack 代替
+func NewMsgPack() *gnet.DataPack {
+	return NewDataPack()
+}
+
+// NewCompressDataPack 创建支持消息体压缩的封包格式 dataLen(4字节)|msgId(4字节)|flags(2字节)|body
+func NewCompressDataPack(compressor gnet.ICompressor) *gnet.CompressDataPack {
+	dp := gnet.NewCompressDataPack(compressor)
+	dp.SetMaxPacketSize(defaultMaxPacketSize)
+	return dp
+}
+
 type Server struct {
 	name          string                                                 // 服务器名称
 	id            string                                                 // 服务器ID
@@ -25,17 +58,31 @@ type Server struct {
 	ip            string                                                 // Host
 	certFile      string                                                 // SSL证书文件路径
 	keyFile       string                                                 // SSL密钥文件路径
+	tlsConfig     *tls.Config                                            // TLS配置(Listen时由证书文件加载)
 	port          int32                                                  // 端口
 	connID        uint32                                                 // 链接ID
 	exit          chan bool                                              // 退出通道
-	listener      *net.TCPListener                                       // 服务器TCP监听器
+	listener      net.Listener                                           // 服务器监听器(可由调用方提供)
+	httpServer    *http.Server                                           // Http服务器
+	mux           *http.ServeMux                                         // 调用方提供的ServeMux(为nil时使用独立的ServeMux)
+	path          string                                                 // WebSocket路径
+	upgrader      *websocket.Upgrader                                    // Http升级WebSocket协议的配置
+	proxy         *gnet.ProxyProtocol                                    // PROXY protocol解析(为nil表示不开启)
+	proxyErr      error                                                  // PROXY protocol配置错误(Listen时返回)
 	connMgr       *gnet.ConnManager                                      // 链接管理器
 	router        *gnet.Router                                           // 消息路由器
 	msgHandler    *gnet.MsgHandler                                       // 当前Server的消息管理模块，用来绑定消息ID和对应的处理方法
+	dataPack      gnet.IDataPack                                         // 封包格式
+	heartBeat     gnet.HeartBeatOption                                   // 链接心跳配置
+	textMode      bool                                                   // 是否使用文本帧模式(JSON信封)
 	onConnCheck   func(resp http.ResponseWriter, req *http.Request) bool // WebSocket链接校验判断
 	onConnUpgrade func(conn *Connection, req *http.Request)              // Http协议升级为WebSocket协议触发的Hook函数
 	onConnStart   gnet.ConnCallback                                      // 有新的客户端链接时触发的Hook函数
 	onConnStop    gnet.ConnCallback                                      // 当客户端链接断开时触发的Hook函数
+	closing       int32                                                  // 是否正在关闭(采用原子操作处理)
+	closingId     uint32                                                 // 服务器关闭时广播给客户端的消息ID
+	closingMsg    []byte                                                 // 服务器关闭时广播给客户端的消息
+	metricsId     uint32                                                 // 链接数量指标的注册ID
 }
 
 func NewServer() *Server {
@@ -50,7 +97,23 @@ func NewServer() *Server {
 		connMgr:    gnet.NewConnManager(),
 		exit:       make(chan bool, 1),
 		router:     &gnet.Router{},
+		dataPack:   NewDataPack(),
 		msgHandler: gnet.NewMsgHandler(gconfig.Global.WsServer.WorkerPoolSize, gconfig.Global.WsServer.WorkerTaskLen),
+		heartBeat:  gnet.NewHeartBeatOption(gconfig.Global.WsServer.ReadIdle, gconfig.Global.WsServer.WriteIdle, gconfig.Global.WsServer.PingMsgId),
+		textMode:   gconfig.Global.WsServer.TextMode,
+		path:       gconfig.Global.WsServer.Path,
+		upgrader:   NewUpgrader(),
+	}
+	if server.path == "" {
+		server.path = "/"
+	}
+	if len(gconfig.Global.WsServer.AllowOrigins) > 0 {
+		server.upgrader.CheckOrigin = AllowOrigins(gconfig.Global.WsServer.AllowOrigins...)
+	}
+	server.upgrader.EnableCompression = gconfig.Global.WsServer.EnableCompression
+	// 未配置读空闲超时则使用默认心跳时长
+	if server.heartBeat.ReadIdle <= 0 {
+		server.heartBeat.ReadIdle = gnet.HeartBeatTime * time.Second
 	}
 	server.msgHandler.SetRouter(server.router)
 
@@ -59,18 +122,105 @@ func NewServer() *Server {
 		glog.Infof("Server Online:%d", server.connMgr.Len())
 	})
 
+	if gconfig.Global.WsServer.ProxyProtocol {
+		// 配置错误时不能静默关闭PROXY protocol(负载均衡的头部会被当作消息解析)，由Listen返回错误
+		server.proxy, server.proxyErr = gnet.NewProxyProtocol(gconfig.Global.WsServer.TrustedProxies)
+	}
+	server.metricsId = gnet.MetricsMgr.RegisterConnMgr("websocket", server.name, server.connMgr)
 	return server
 }
 
-// http升级websocket协议的配置
-var wsUpgrader = websocket.Upgrader{
-	HandshakeTimeout: 2 * time.Second,   // 设置2秒钟超时时间
-	ReadBufferSize:   IOBufferBytesSize, // io 操作的缓存大小，如果不指定就会自动分配
-	WriteBufferSize:  IOBufferBytesSize, // 写数据操作的缓存池，如果没有设置值，write buffers 将会分配到链接生命周期里
-	// 允许所有CORS跨域请求
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+const (
+	codecSubprotocolPrefix = "gserver."     // 选择消息体编解码器的子协议前缀
+	textSubprotocol        = "gserver.text" // 选择文本帧模式的子协议
+)
+
+// NewUpgrader 创建默认的Http升级WebSocket协议配置(允许所有跨域请求)，可修改后通过SetUpgrader设置
+func NewUpgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		HandshakeTimeout: 2 * time.Second,   // 设置2秒钟超时时间
+		ReadBufferSize:   IOBufferBytesSize, // io 操作的缓存大小，如果不指定就会自动分配
+		WriteBufferSize:  IOBufferBytesSize, // 写数据操作的缓存池，如果没有设置值，write buffers 将会分配到链接生命周期里
+		// 客户端可通过子协议选择消息体编解码器
+		Subprotocols: []string{codecSubprotocolPrefix + gnet.CodecProtobuf, codecSubprotocolPrefix + gnet.CodecJson, textSubprotocol},
+		// 允许所有CORS跨域请求
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
+}
+
+// AllowOrigins 创建跨域校验函数，只允许指定的Origin(如 https://game.example.com 或 game.example.com，"*"表示全部允许)，
+// 未携带Origin的请求(非浏览器客户端)直接允许
+func AllowOrigins(origins ...string) func(r *http.Request) bool {
+	allowed := make(map[string]struct{}, len(origins))
+	for _, origin := range origins {
+		allowed[strings.ToLower(strings.TrimSuffix(origin, "/"))] = struct{}{}
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if _, ok := allowed["*"]; ok {
+			return true
+		}
+		origin = strings.ToLower(origin)
+		if _, ok := allowed[origin]; ok {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		_, ok := allowed[u.Host]
+		return ok
+	}
+}
+
+// SetUpgrader 设置Http升级WebSocket协议的配置(跨域校验、子协议、压缩等)，需在Start之前设置
+func (s *Server) SetUpgrader(upgrader *websocket.Upgrader) {
+	s.upgrader = upgrader
+}
+
+// GetUpgrader 获取Http升级WebSocket协议的配置
+func (s *Server) GetUpgrader() *websocket.Upgrader {
+	return s.upgrader
+}
+
+// SetServeMux 设置挂载的ServeMux和路径，Start时将Server注册到该ServeMux(可与其他Http服务共用端口)，
+// 未设置Listener时由调用方负责监听端口，需在Start之前设置
+func (s *Server) SetServeMux(mux *http.ServeMux, path string) {
+	s.mux = mux
+	if path != "" {
+		s.path = path
+	}
+}
+
+// SetPath 设置WebSocket路径，需在Start之前设置
+func (s *Server) SetPath(path string) {
+	s.path = path
+}
+
+// SetListener 设置监听器(如已绑定端口的net.Listener)，需在Start之前设置
+func (s *Server) SetListener(listener net.Listener) {
+	s.listener = listener
+}
+
+// SetProxyProtocol 设置PROXY protocol解析，链接的RemoteAddr为头部中的客户端真实地址(为nil表示不开启)
+// 需在Start之前设置，只对Server自身监听(或SetListener提供)的端口生效，挂载到调用方ServeMux时由调用方处理
+func (s *Server) SetProxyProtocol(proxy *gnet.ProxyProtocol) {
+	s.proxy, s.proxyErr = proxy, nil
+}
+
+// GetProxyProtocol 获取PROXY protocol解析
+func (s *Server) GetProxyProtocol() *gnet.ProxyProtocol {
+	return s.proxy
+}
+
+// ServeHTTP 实现http.Handler，处理WebSocket升级请求
+func (s *Server) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	s.wsHandler(resp, req)
 }
 
 // SetOnConnCheck 设置链接检查函数
@@ -85,6 +235,11 @@ func (s *Server) SetOnConnUpgrade(onConnUpgrade func(conn *Connection, req *http
 
 func (s *Server) wsHandler(resp http.ResponseWriter, req *http.Request) {
 	glog.Debugf("收到WebSocket链接请求,Addr:%s", req.RemoteAddr)
+	// 服务器正在关闭，不再接收新链接
+	if atomic.LoadInt32(&s.closing) == 1 {
+		resp.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
 	if s.onConnCheck != nil {
 		// 如果校验失败则不进行链接
 		if s.onConnCheck(resp, req) == false {
@@ -102,7 +257,7 @@ func (s *Server) wsHandler(resp http.ResponseWriter, req *http.Request) {
 	}
 
 	// 应答客户端告知升级连接为websocket
-	conn, err := wsUpgrader.Upgrade(resp, req, nil)
+	conn, err := s.upgrader.Upgrade(resp, req, nil)
 	if err != nil {
 		glog.Warnf("WebSocket升级协议失败, Err:%v, Addr:%s", err, req.RemoteAddr)
 		return
@@ -112,6 +267,15 @@ func (s *Server) wsHandler(resp http.ResponseWriter, req *http.Request) {
 	atomic.AddUint32(&s.connID, 1)
 	// 创建链接对象
 	dealConn := NewConnection(s, conn, s.connID, s.msgHandler, gconfig.Global.WsServer.MaxMsgChanLen)
+	dealConn.SetHeartBeat(s.heartBeat)
+	// 握手时选择消息体编解码器(可在onConnUpgrade中重新设置)
+	if codec, ok := negotiateCodec(conn, req); ok {
+		gnet.SetCodec(dealConn, codec)
+	}
+	// 服务器开启文本帧模式，或者客户端通过子协议选择文本帧模式
+	if s.textMode || conn.Subprotocol() == textSubprotocol {
+		dealConn.SetTextMode(true)
+	}
 
 	if s.onConnUpgrade != nil {
 		// 执行链接升级回调
@@ -124,6 +288,14 @@ func (s *Server) wsHandler(resp http.ResponseWriter, req *http.Request) {
 	go dealConn.Start()
 }
 
+// negotiateCodec 根据握手协商的子协议(gserver.json)或者查询参数(codec=json)选择消息体编解码器
+func negotiateCodec(conn *websocket.Conn, req *http.Request) (gnet.ICodec, bool) {
+	if name := strings.TrimPrefix(conn.Subprotocol(), codecSubprotocolPrefix); name != "" {
+		return gnet.GetCodecByName(name)
+	}
+	return gnet.GetCodecByName(req.URL.Query().Get("codec"))
+}
+
 // GetName 获取服务器名称
 func (s *Server) GetName() string {
 	return s.name
@@ -156,49 +328,141 @@ func (s *Server) Run() {
 	}
 }
 
-// Start 启动服务器
+// Start 启动服务器，监听失败时记录错误并退出进程(需要处理启动错误时先调用Listen)
+// 设置了ServeMux时将Server注册到该ServeMux，未设置Listener时不监听端口(由调用方负责监听)
 func (s *Server) Start() {
 	glog.Debugf("Server: %s StartWork", s.GetName())
-	// 开启一个Go协程去监听服务器端口
-	go func() {
-		// 启动消息Worker工作池
-		s.msgHandler.StartWorkerPool()
+	// 先于监听注册，调用方的ServeMux可能已经在处理请求
+	if s.mux != nil {
+		s.mux.Handle(s.path, s)
+	}
 
-		// 获取一个TCP的Addr
-		addr, err := net.ResolveTCPAddr(s.ipVersion, fmt.Sprintf("%s:%d", s.ip, s.port))
-		if err != nil {
-			fmt.Println("服务器地址格式错误, Error:", err)
-			os.Exit(0)
-		}
+	// 启动消息Worker工作池
+	s.msgHandler.StartWorkerPool()
 
-		http.HandleFunc("/", s.wsHandler)
+	if s.mux != nil && s.listener == nil {
+		glog.Debugf("Websocket Server mounted on ServeMux. Path:%s", s.path)
+		return
+	}
+
+	// 在Start返回前完成监听，启动失败不会被静默忽略
+	if err := s.Listen(); err != nil {
+		glog.Fatalf("Server: %s start fail, Error:%s", s.GetName(), err.Error())
+	}
+	listener := s.listener
+	if s.proxy != nil {
+		listener = gnet.NewProxyListener(listener, s.proxy)
+	}
 
-		// 监听服务器地址
-		if s.certFile != "" && s.keyFile != "" {
-			glog.Debugf("Websocket Server StartWork. URL:wss://%s, certFile = %s, keyFile = %s", addr.String(), s.certFile, s.keyFile)
-			err = http.ListenAndServeTLS(addr.String(), s.certFile, s.keyFile, nil)
+	var handler http.Handler = s.mux
+	if s.mux == nil {
+		mux := http.NewServeMux()
+		mux.Handle(s.path, s)
+		handler = mux
+	}
+	s.httpServer = &http.Server{Handler: handler, TLSConfig: s.tlsConfig}
+
+	// 开启一个Go协程去处理Http请求
+	go func() {
+		var err error
+		if s.tlsConfig != nil {
+			glog.Debugf("Websocket Server StartWork. URL:wss://%s%s, certFile = %s, keyFile = %s", listener.Addr().String(), s.path, s.certFile, s.keyFile)
+			err = s.httpServer.ServeTLS(listener, "", "")
 		} else {
-			glog.Debugf("Websocket Server StartWork. URL:ws://%s", addr.String())
-			err = http.ListenAndServe(addr.String(), nil)
+			glog.Debugf("Websocket Server StartWork. URL:ws://%s%s", listener.Addr().String(), s.path)
+			err = s.httpServer.Serve(listener)
 		}
 
-		if err != nil {
-			fmt.Println("服务器启动失败, Error:", err)
-			os.Exit(0)
+		// 服务器关闭时返回 http.ErrServerClosed
+		if err != nil && err != http.ErrServerClosed {
+			glog.Errorf("Websocket Server serve has error: %s", err.Error())
 		}
 	}()
 }
 
+// Listen 加载证书并监听服务器地址，失败时返回错误；已监听(或SetListener设置了监听器)时直接返回
+// 需在Start之前调用，未调用时由Start调用
+func (s *Server) Listen() error {
+	if s.proxyErr != nil {
+		return errors.New(fmt.Sprintf("load proxy protocol fail, Error:%s", s.proxyErr.Error()))
+	}
+	if s.tlsConfig == nil && s.certFile != "" && s.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+		if err != nil {
+			return errors.New(fmt.Sprintf("load server certificate fail, Error:%s", err.Error()))
+		}
+		s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	if s.listener != nil {
+		return nil
+	}
+	// 获取一个TCP的Addr
+	addr, err := net.ResolveTCPAddr(s.ipVersion, fmt.Sprintf("%s:%d", s.ip, s.port))
+	if err != nil {
+		return err
+	}
+	// 监听服务器地址
+	listener, err := net.ListenTCP(s.ipVersion, addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	return nil
+}
+
 // Stop 停止服务器
 func (s *Server) Stop() {
+	if !atomic.CompareAndSwapInt32(&s.closing, 0, 1) {
+		return
+	}
+	gnet.MetricsMgr.UnregisterConnMgr(s.metricsId)
 	// 关闭worker工作池
 	s.msgHandler.StopWorkerPool()
 	s.connMgr.ClearConn()
-	_ = s.listener.Close()
+	if s.httpServer != nil {
+		_ = s.httpServer.Close()
+	}
 
 	s.exit <- true
 }
 
+// SetClosingMsg 设置服务器关闭(Shutdown)时广播给客户端的消息
+func (s *Server) SetClosingMsg(msgId uint32, data []byte) {
+	s.closingId = msgId
+	s.closingMsg = data
+}
+
+// Shutdown 优雅关闭服务器: 停止接收新链接、广播关闭消息、等待队列中的消息处理完成以及缓冲管道中的数据写出、
+// 停止全部链接并执行OnConnStop。全部完成后返回，ctx超时/取消后不再等待并返回ctx的错误
+func (s *Server) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&s.closing, 0, 1) {
+		return errors.New("server is closing")
+	}
+	defer gnet.MetricsMgr.UnregisterConnMgr(s.metricsId)
+
+	var err error
+	// 停止接收新链接(已升级为WebSocket的链接不受影响)
+	if s.httpServer != nil {
+		err = s.httpServer.Shutdown(ctx)
+	}
+
+	// 广播服务器关闭消息
+	if s.closingId > 0 {
+		s.connMgr.BroadcastMsg(s.closingId, s.closingMsg)
+	}
+
+	if drainErr := gnet.DrainConns(ctx, s.connMgr, s.msgHandler); err == nil {
+		err = drainErr
+	}
+
+	// 关闭worker工作池
+	s.msgHandler.StopWorkerPool()
+
+	s.exit <- true
+	return err
+}
+
 func (s *Server) GetRouter() *gnet.Router {
 	return s.router
 }
@@ -208,6 +472,56 @@ func (s *Server) GetConnMgr() *gnet.ConnManager {
 	return s.connMgr
 }
 
+// GetDataPack 获取封包格式
+func (s *Server) GetDataPack() gnet.IDataPack {
+	return s.dataPack
+}
+
+// SetDataPack 设置封包格式，新建链接将使用该格式
+func (s *Server) SetDataPack(dataPack gnet.IDataPack) {
+	s.dataPack = dataPack
+}
+
+// GetHeartBeat 获取链接心跳配置
+func (s *Server) GetHeartBeat() gnet.HeartBeatOption {
+	return s.heartBeat
+}
+
+// SetHeartBeat 设置链接心跳配置，新建链接将使用该配置
+func (s *Server) SetHeartBeat(option gnet.HeartBeatOption) {
+	s.heartBeat = option
+}
+
+// SetTextMode 设置是否使用文本帧模式(JSON信封)，适用于浏览器客户端
+func (s *Server) SetTextMode(textMode bool) {
+	s.textMode = textMode
+}
+
+// SetRateLimiter 设置链接限流器(nil表示不限流)
+func (s *Server) SetRateLimiter(limiter *gnet.RateLimiter) {
+	s.msgHandler.SetLimiter(limiter)
+}
+
+// SetOverflow 设置Worker队列溢出处理策略
+func (s *Server) SetOverflow(option gnet.OverflowOption) {
+	s.msgHandler.SetOverflow(option)
+}
+
+// SetOnQueueEvent 设置Worker队列高水位/溢出事件Hook函数
+func (s *Server) SetOnQueueEvent(onQueueEvent gnet.QueueEventFunc) {
+	s.msgHandler.SetOnQueueEvent(onQueueEvent)
+}
+
+// SetDispatchKey 设置消息分发Key函数，Key相同的消息由同一个Worker按顺序处理(需在Start之前设置)
+func (s *Server) SetDispatchKey(dispatchKey gnet.DispatchKeyFunc) {
+	s.msgHandler.SetDispatchKey(dispatchKey)
+}
+
+// SetWorldMsgIds 设置由单独的world worker串行处理的消息ID(需在Start之前设置)
+func (s *Server) SetWorldMsgIds(msgIds ...uint32) {
+	s.msgHandler.SetWorldMsgIds(msgIds...)
+}
+
 // SetOnConnStart 设置服务器有新的链接Hook函数
 func (s *Server) SetOnConnStart(connCallback gnet.ConnCallback) {
 	s.onConnStart = connCallback
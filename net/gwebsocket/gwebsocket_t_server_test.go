@@ -0,0 +1,178 @@
+package gwebsocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Ravior/gserver/net/gnet"
+	"github.com/Ravior/gserver/util/gconfig"
+	"github.com/gogo/protobuf/types"
+	"github.com/gorilla/websocket"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Server_TextMode(t *testing.T) {
+	// 获取一个空闲TCP端口
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	gconfig.Global.WsServer.IP = "127.0.0.1"
+	gconfig.Global.WsServer.Port = int32(port)
+	gconfig.Global.WsServer.MaxMsgChanLen = 16
+
+	server := NewServer()
+	server.SetTextMode(true)
+	server.GetRouter().Group("web").AddRoute("echo", func(req *gnet.Request, msg *types.StringValue) (*types.StringValue, error) {
+		return &types.StringValue{Value: msg.Value + "!"}, nil
+	})
+	server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://127.0.0.1:%d/", port), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"route":"web.echo","seq":1,"data":"gserver"}`)); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	frameType, data, err := conn.ReadMessage()
+	if err != nil || frameType != websocket.TextMessage {
+		t.Fatal(err, frameType)
+	}
+
+	envelope := &gnet.JsonEnvelope{}
+	if err := json.Unmarshal(data, envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Route != "web.echo" || envelope.Seq != 1 || string(envelope.Data) != `"gserver!"` {
+		t.Fatal(string(data))
+	}
+}
+
+func Test_Server_ServeMux(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(resp http.ResponseWriter, req *http.Request) {
+		_, _ = resp.Write([]byte("ok"))
+	})
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	server := NewServer()
+	server.SetServeMux(mux, "/ws")
+	server.GetUpgrader().CheckOrigin = AllowOrigins("https://game.example.com")
+	server.Start()
+	defer server.Stop()
+
+	resp, err := http.Get(httpServer.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "ok" {
+		t.Fatal(string(body))
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/ws"
+	header := http.Header{}
+	header.Set("Origin", "https://game.example.com")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	header.Set("Origin", "https://evil.example.com")
+	if _, _, err := websocket.DefaultDialer.Dial(wsURL, header); err == nil {
+		t.Fatal("origin should be rejected")
+	}
+}
+
+func Test_Server_ProxyProtocol(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := gnet.NewProxyProtocol([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remoteAddr := make(chan string, 1)
+	server := NewServer()
+	server.SetListener(l)
+	server.SetProxyProtocol(proxy)
+	server.SetOnConnStart(func(conn gnet.IConnection) {
+		remoteAddr <- conn.RemoteAddr().String()
+	})
+	server.Start()
+	defer server.Stop()
+
+	dialer := websocket.Dialer{
+		NetDial: func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			if err == nil {
+				_, err = conn.Write([]byte("PROXY TCP4 198.51.100.9 127.0.0.1 50000 80\r\n"))
+			}
+			return conn, err
+		},
+	}
+	conn, _, err := dialer.Dial(fmt.Sprintf("ws://%s/", l.Addr().String()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case addr := <-remoteAddr:
+		if addr != "198.51.100.9:50000" {
+			t.Fatal(addr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnConnStart timeout")
+	}
+}
+
+func Test_Server_ListenError(t *testing.T) {
+	// 证书加载失败时返回错误
+	server := NewServer()
+	server.certFile, server.keyFile = "not-exist.crt", "not-exist.key"
+	if err := server.Listen(); err == nil {
+		t.Fatal("certificate load error ignored")
+	}
+
+	// PROXY protocol配置错误时返回错误, 不静默关闭
+	gconfig.Global.WsServer.ProxyProtocol = true
+	gconfig.Global.WsServer.TrustedProxies = []string{"not-a-cidr"}
+	server = NewServer()
+	gconfig.Global.WsServer.ProxyProtocol = false
+	gconfig.Global.WsServer.TrustedProxies = nil
+	if err := server.Listen(); err == nil {
+		t.Fatal("proxy protocol error ignored")
+	}
+
+	// 端口已被占用时返回错误
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	server = NewServer()
+	server.ip, server.port = "127.0.0.1", int32(l.Addr().(*net.TCPAddr).Port)
+	if err := server.Listen(); err == nil {
+		t.Fatal("listen error ignored")
+	}
+}
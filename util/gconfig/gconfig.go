@@ -42,28 +42,70 @@ type RedisConfig struct {
 // TcpServerConfig Tcp服务器配置
 type TcpServerConfig struct {
 	addr
-	MaxConn        int32  // 当前服务器允许的最大链接数
-	WorkerPoolSize uint32 // 业务工作Worker池的数量
-	WorkerTaskLen  uint32 // 业务工作Worker对应负责的任务队列最大任务存储数量
-	MaxMsgChanLen  uint32 // MsgBuffChan长度
+	MaxConn        int32    // 当前服务器允许的最大链接数
+	WorkerPoolSize uint32   // 业务工作Worker池的数量
+	WorkerTaskLen  uint32   // 业务工作Worker对应负责的任务队列最大任务存储数量
+	MaxMsgChanLen  uint32   // MsgBuffChan长度
+	ReadIdle       int      // 读空闲超时(秒)，超过该时长未收到客户端数据则断开链接(0表示不检测)
+	WriteIdle      int      // 写空闲时长(秒)，超过该时长未发送数据则主动发送心跳消息(0表示不发送)
+	PingMsgId      uint32   // 服务器主动发送的心跳消息ID(0表示不发送)
+	Secure         bool     // 是否开启加密传输(ECDH握手+AES-GCM，客户端需同时开启)
+	MaxConnPerIp   int32    // 单IP允许的最大链接数(0表示不限制)
+	AllowCIDRs     []string // 允许接入的IP段(如 10.0.0.0/8，为空表示不限制)
+	DenyCIDRs      []string // 禁止接入的IP段，优先于AllowCIDRs
+	AuthTimeout    int      // 登录超时(秒)，链接建立后超过该时长未绑定用户则断开(0表示不检测)
+	ProxyProtocol  bool     // 是否解析PROXY protocol(v1/v2)头部获取客户端真实地址(部署在负载均衡之后时开启)
+	TrustedProxies []string // 可信上游(负载均衡)IP段，只解析来自可信上游的头部
+	Network        string   // 监听网络类型: tcp4(默认)、tcp(IPv4/IPv6双栈)、tcp6、unix
+	UnixSocket     string   // Unix socket文件路径(Network为unix时使用)
+	CertFile       string   // SSL证书地址(与KeyFile同时设置时开启TLS)
+	KeyFile        string   // SSL证书密钥地址
 }
 
 // WsServerConfig Websocket服务器配置
 type WsServerConfig struct {
+	addr
+	MaxConn           int32    // 当前服务器允许的最大链接数
+	WorkerPoolSize    uint32   // 业务工作Worker池的数量
+	WorkerTaskLen     uint32   // 业务工作Worker对应负责的任务队列最大任务存储数量
+	MaxMsgChanLen     uint32   // MsgBuffChan长度
+	ReadIdle          int      // 读空闲超时(秒)，超过该时长未收到客户端数据则断开链接(0表示使用默认心跳时长)
+	WriteIdle         int      // 写空闲时长(秒)，超过该时长未发送数据则主动发送心跳消息(0表示不发送)
+	PingMsgId         uint32   // 服务器主动发送的心跳消息ID(0表示不发送)
+	CertFile          string   // SSL证书地址
+	KeyFile           string   // SSL证书密钥地址
+	TextMode          bool     // 是否使用文本帧模式，每一帧为JSON信封 {"id":..., "route":"group.name", "data":{...}}
+	Path              string   // WebSocket路径(默认为"/")
+	AllowOrigins      []string // 允许跨域的Origin列表(为空表示全部允许)
+	EnableCompression bool     // 是否开启消息压缩(permessage-deflate)
+	ProxyProtocol     bool     // 是否解析PROXY protocol(v1/v2)头部获取客户端真实地址(部署在负载均衡之后时开启)
+	TrustedProxies    []string // 可信上游(负载均衡)IP段，只解析来自可信上游的头部
+}
+
+// KcpServerConfig Kcp(可靠UDP)服务器配置
+type KcpServerConfig struct {
 	addr
 	MaxConn        int32  // 当前服务器允许的最大链接数
 	WorkerPoolSize uint32 // 业务工作Worker池的数量
 	WorkerTaskLen  uint32 // 业务工作Worker对应负责的任务队列最大任务存储数量
 	MaxMsgChanLen  uint32 // MsgBuffChan长度
-	CertFile       string // SSL证书地址
-	KeyFile        string // SSL证书密钥地址
+	NoDelay        bool   // 是否开启nodelay模式
+	Interval       uint32 // 内部flush间隔(毫秒)
+	Resend         int    // 快速重传阈值(0表示关闭)
+	NoCongestion   bool   // 是否关闭拥塞控制
+	SndWnd         uint32 // 发送窗口
+	RcvWnd         uint32 // 接收窗口
+	Mtu            int    // 最大传输单元
+	HeartBeat      int    // 心跳间隔(秒)
+	Timeout        int    // 会话超时时长(秒)
 }
 
 // HttpServerConfig Http服务器配置
 type HttpServerConfig struct {
 	addr
-	CertFile string // SSL证书地址
-	KeyFile  string // SSL证书密钥地址
+	CertFile    string // SSL证书地址
+	KeyFile     string // SSL证书密钥地址
+	MetricsPath string // 网络层指标(Prometheus文本格式)的访问路径，如"/metrics"(为空表示不开启)
 }
 
 // RpcServerConfig RPC服务器配置
@@ -110,6 +152,7 @@ type Config struct {
 
 	TcpServer  TcpServerConfig  // TCP服务器配置
 	WsServer   WsServerConfig   // WebSocket服务器配置
+	KcpServer  KcpServerConfig  // KCP服务器配置
 	HttpServer HttpServerConfig // HTTP服务器配置
 	RpcServer  RpcServerConfig  // RPC服务器配置
 	Console    ConsoleConfig    // 控制台配置